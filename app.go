@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"time"
 	"tpm-bunker/internal/agent"
 	"tpm-bunker/internal/api"
@@ -34,6 +35,9 @@ func (a *App) startup(ctx context.Context) {
 	tpmMgr := tpm.NewManager(initCtx)
 	client := api.NewAPIClient(initCtx)
 	a.agent = agent.NewAgent(ctx, tpmMgr, client)
+	a.agent.SetNotifier(func(event string, data interface{}) {
+		runtime.EventsEmit(a.ctx, event, data)
+	})
 }
 
 // GetTPMStatus - chamado pelo frontend
@@ -85,23 +89,40 @@ func (a *App) AuthLogin() bool {
 	return a.agent.AuthLogin(ctx)
 }
 
-// GetOperations - chamado pelo frontend
-func (a *App) GetOperations() ([]byte, error) {
-	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
+// ListOperations - chamado pelo frontend
+func (a *App) ListOperations(filter types.OperationFilter) (*types.OperationPage, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 2*time.Minute)
 	defer cancel()
 
-	// Adicione logs
-	response, err := a.agent.GetOperations(ctx)
+	page, err := a.agent.ListOperations(ctx, filter)
 	if err != nil {
-		log.Printf("Erro em GetOperations: %v", err)
+		log.Printf("Erro em ListOperations: %v", err)
 		return nil, err
 	}
 
-	return response, nil
+	return page, nil
 }
 
 // EncryptFile - chamado pelo frontend
-func (a *App) EncryptFile(filePath string) error {
+func (a *App) EncryptFile(filePath string) (*types.EncryptionSummary, error) {
+	return a.encryptFile(filePath, nil)
+}
+
+// EncryptFileFor - chamado pelo frontend
+func (a *App) EncryptFileFor(filePath string, recipients []string) (*types.EncryptionSummary, error) {
+	if recipients == nil {
+		recipients = []string{}
+	}
+	return a.encryptFile(filePath, recipients)
+}
+
+// encryptFile encripta para os destinatários informados ou, se recipients
+// for nil, para os destinatários padrão da configuração
+func (a *App) encryptFile(filePath string, recipients []string) (*types.EncryptionSummary, error) {
 	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
 	defer cancel()
 
@@ -112,38 +133,120 @@ func (a *App) EncryptFile(filePath string) error {
 	}()
 
 	if a.agent == nil {
-		return fmt.Errorf("agent não inicializado")
+		return nil, fmt.Errorf("agent não inicializado")
 	}
 
 	initialized := a.agent.IsDeviceInitialized(ctx)
 	if !initialized {
-		return fmt.Errorf("device não inicializado. Aguarde a inicialização")
+		return nil, fmt.Errorf("device não inicializado. Aguarde a inicialização")
+	}
+
+	type encryptResult struct {
+		summary *types.EncryptionSummary
+		err     error
 	}
 
-	done := make(chan error, 1)
+	done := make(chan encryptResult, 1)
 	go func() {
 		defer close(done)
 		encryptCtx, encryptCancel := context.WithTimeout(ctx, 9*time.Minute)
 		defer encryptCancel()
 
-		_, err := a.agent.Encrypt(encryptCtx, filePath)
+		var summary *types.EncryptionSummary
+		var err error
+		if recipients == nil {
+			summary, err = a.agent.Encrypt(encryptCtx, filePath)
+		} else {
+			summary, err = a.agent.EncryptFor(encryptCtx, filePath, recipients)
+		}
 		if err != nil {
-			done <- fmt.Errorf("erro ao encriptar: %w", err)
+			done <- encryptResult{err: fmt.Errorf("erro ao encriptar: %w", err)}
 			return
 		}
-		done <- nil
+		done <- encryptResult{summary: summary}
 	}()
 
 	select {
-	case err := <-done:
-		return err
+	case result := <-done:
+		return result.summary, result.err
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
+	}
+}
+
+// EncryptFiles - chamado pelo frontend
+func (a *App) EncryptFiles(filePaths []string) (*types.BatchResult, error) {
+	return a.encryptFiles(filePaths, nil)
+}
+
+// EncryptFilesFor - chamado pelo frontend
+func (a *App) EncryptFilesFor(filePaths []string, recipients []string) (*types.BatchResult, error) {
+	if recipients == nil {
+		recipients = []string{}
+	}
+	return a.encryptFiles(filePaths, recipients)
+}
+
+// encryptFiles encripta um lote para os destinatários informados ou, se
+// recipients for nil, para os destinatários padrão da configuração
+func (a *App) encryptFiles(filePaths []string, recipients []string) (*types.BatchResult, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 2*time.Hour)
+	defer cancel()
+
+	if !a.agent.IsDeviceInitialized(ctx) {
+		return nil, fmt.Errorf("device não inicializado. Aguarde a inicialização")
+	}
+
+	return a.agent.EncryptFiles(ctx, filePaths, recipients)
+}
+
+// CancelOperation - chamado pelo frontend
+func (a *App) CancelOperation(id string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.CancelOperation(id)
+}
+
+// CancelBatch - chamado pelo frontend
+func (a *App) CancelBatch(batchID string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.CancelBatch(batchID)
+}
+
+// VaultFile - chamado pelo frontend
+func (a *App) VaultFile(filePath string, recipients []string) (*types.VaultResult, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 20*time.Minute)
+	defer cancel()
+
+	if !a.agent.IsDeviceInitialized(ctx) {
+		return nil, fmt.Errorf("device não inicializado. Aguarde a inicialização")
 	}
+	return a.agent.VaultAndRemove(ctx, filePath, recipients)
 }
 
 // DecryptFile - chamado pelo frontend
 func (a *App) DecryptFile(operationID string) error {
+	_, err := a.decryptFile(operationID, "")
+	return err
+}
+
+// DecryptFileTo - chamado pelo frontend
+func (a *App) DecryptFileTo(operationID string, destDir string) (*types.DecryptResult, error) {
+	return a.decryptFile(operationID, destDir)
+}
+
+func (a *App) decryptFile(operationID string, destDir string) (*types.DecryptResult, error) {
 	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
 	defer cancel()
 
@@ -156,17 +259,21 @@ func (a *App) DecryptFile(operationID string) error {
 
 	// Verifica se o agent está inicializado
 	if a.agent == nil {
-		return fmt.Errorf("agent não inicializado")
+		return nil, fmt.Errorf("agent não inicializado")
 	}
 
 	// Verifica se o dispositivo está inicializado
 	initialized := a.agent.IsDeviceInitialized(ctx)
 	if !initialized {
-		return fmt.Errorf("device não inicializado. Aguarde a inicialização")
+		return nil, fmt.Errorf("device não inicializado. Aguarde a inicialização")
 	}
 
 	// Canal para resultado da operação assíncrona
-	done := make(chan error, 1)
+	type outcome struct {
+		result *types.DecryptResult
+		err    error
+	}
+	done := make(chan outcome, 1)
 	go func() {
 		defer close(done)
 
@@ -175,28 +282,522 @@ func (a *App) DecryptFile(operationID string) error {
 		defer decryptCancel()
 
 		// Chama a função de decriptação do agent
-		filePath, err := a.agent.Decrypt(decryptCtx, operationID)
+		result, err := a.agent.DecryptTo(decryptCtx, operationID, destDir)
 		if err != nil {
-			done <- fmt.Errorf("erro ao decriptar: %w", err)
+			done <- outcome{err: fmt.Errorf("erro ao decriptar: %w", err)}
 			return
 		}
 
 		// Notifica o frontend sobre o sucesso e o caminho do arquivo
-		runtime.EventsEmit(a.ctx, "decryption_complete", map[string]string{
-			"status": "success",
-			"path":   filePath,
+		runtime.EventsEmit(a.ctx, "decryption_complete", map[string]interface{}{
+			"status":             "success",
+			"path":               result.Path,
+			"skipped_attributes": result.SkippedAttributes,
 		})
 
-		done <- nil
+		done <- outcome{result: result}
 	}()
 
 	// Aguarda conclusão ou timeout
 	select {
-	case err := <-done:
-		return err
+	case o := <-done:
+		return o.result, o.err
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
+	}
+}
+
+// DecryptFileAs - chamado pelo frontend
+func (a *App) DecryptFileAs(operationID string, destPath string) (*types.DecryptResult, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
+	defer cancel()
+
+	result, err := a.agent.DecryptToPath(ctx, operationID, destPath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao decriptar: %w", err)
+	}
+
+	runtime.EventsEmit(a.ctx, "decryption_complete", map[string]interface{}{
+		"status":             "success",
+		"path":               result.Path,
+		"skipped_attributes": result.SkippedAttributes,
+	})
+	return result, nil
+}
+
+// OpenFile - chamado pelo frontend
+func (a *App) OpenFile(operationID string) (*types.OpenedFile, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
+	defer cancel()
+	return a.agent.Open(ctx, operationID)
+}
+
+// CloseOpenedFile - chamado pelo frontend
+func (a *App) CloseOpenedFile(id string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.CloseOpened(id)
+}
+
+// serveAssets atende as requisições do servidor de assets que não são
+// arquivos da interface, como os conteúdos abertos por OpenFile. Não é
+// exportado para não ser exposto ao frontend como binding.
+func (a *App) serveAssets(w http.ResponseWriter, r *http.Request) {
+	if a.agent == nil {
+		http.Error(w, "agent não inicializado", http.StatusServiceUnavailable)
+		return
+	}
+	a.agent.ServeOpened(w, r)
+}
+
+// DecryptFileTemporary - chamado pelo frontend
+func (a *App) DecryptFileTemporary(operationID string, ttlMinutes int) (*types.ScratchCopy, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
+	defer cancel()
+	return a.agent.DecryptTemporary(ctx, operationID, time.Duration(ttlMinutes)*time.Minute)
+}
+
+// ListTemporaryCopies - chamado pelo frontend
+func (a *App) ListTemporaryCopies() []types.ScratchCopy {
+	if a.agent == nil {
+		return []types.ScratchCopy{}
 	}
+	return a.agent.ListTemporary()
+}
+
+// WipeTemporaryCopy - chamado pelo frontend
+func (a *App) WipeTemporaryCopy(path string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.WipeTemporary(path)
+}
+
+// ListFiles - chamado pelo frontend
+func (a *App) ListFiles() []types.LogicalFile {
+	if a.agent == nil {
+		return []types.LogicalFile{}
+	}
+	return a.agent.ListFiles()
+}
+
+// ListVersions - chamado pelo frontend
+func (a *App) ListVersions(fileID string) ([]types.FileVersion, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.ListVersions(fileID)
+}
+
+// RestoreVersion - chamado pelo frontend
+func (a *App) RestoreVersion(fileID string, version int, destDir string) (*types.DecryptResult, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
+	defer cancel()
+	return a.agent.RestoreVersion(ctx, fileID, version, destDir)
+}
+
+// SearchOperations - chamado pelo frontend
+func (a *App) SearchOperations(query string) ([]types.Operation, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
+	defer cancel()
+
+	return a.agent.SearchOperations(ctx, query)
+}
+
+// SetAnnotation - chamado pelo frontend
+func (a *App) SetAnnotation(operationID string, annotation types.Annotation) (*types.Annotation, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 2*time.Minute)
+	defer cancel()
+
+	if !a.agent.IsDeviceInitialized(ctx) {
+		return nil, fmt.Errorf("device não inicializado. Aguarde a inicialização")
+	}
+	return a.agent.SetAnnotation(ctx, operationID, annotation)
+}
+
+// ListTransfers - chamado pelo frontend
+func (a *App) ListTransfers() ([]types.Transfer, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.ListTransfers()
+}
+
+// ResumeTransfers - chamado pelo frontend
+func (a *App) ResumeTransfers() {
+	if a.agent == nil {
+		return
+	}
+	a.agent.ResumeTransfers()
+}
+
+// GetOutboxState - chamado pelo frontend
+func (a *App) GetOutboxState() types.OutboxState {
+	if a.agent == nil {
+		return types.OutboxState{}
+	}
+	return a.agent.OutboxState()
+}
+
+// ListWatchedFolders - chamado pelo frontend
+func (a *App) ListWatchedFolders() []types.WatchedFolder {
+	if a.agent == nil {
+		return nil
+	}
+	return a.agent.WatchedFolders()
+}
+
+// AddWatchedFolder - chamado pelo frontend
+func (a *App) AddWatchedFolder(folder types.WatchedFolder) (*types.WatchedFolder, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.AddWatchedFolder(folder)
+}
+
+// UpdateWatchedFolder - chamado pelo frontend
+func (a *App) UpdateWatchedFolder(folder types.WatchedFolder) (*types.WatchedFolder, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.UpdateWatchedFolder(folder)
+}
+
+// RemoveWatchedFolder - chamado pelo frontend
+func (a *App) RemoveWatchedFolder(id string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.RemoveWatchedFolder(id)
+}
+
+// GetWatchActivity - chamado pelo frontend
+func (a *App) GetWatchActivity(id string) []types.WatchActivity {
+	if a.agent == nil {
+		return nil
+	}
+	return a.agent.WatchActivity(id)
+}
+
+// ListBackupJobs - chamado pelo frontend
+func (a *App) ListBackupJobs() []types.BackupJobStatus {
+	if a.agent == nil {
+		return nil
+	}
+	return a.agent.BackupJobs()
+}
+
+// AddBackupJob - chamado pelo frontend
+func (a *App) AddBackupJob(job types.BackupJob) (*types.BackupJob, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.AddBackupJob(job)
+}
+
+// UpdateBackupJob - chamado pelo frontend
+func (a *App) UpdateBackupJob(job types.BackupJob) (*types.BackupJob, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.UpdateBackupJob(job)
+}
+
+// RemoveBackupJob - chamado pelo frontend
+func (a *App) RemoveBackupJob(id string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.RemoveBackupJob(id)
+}
+
+// RunBackupJob - chamado pelo frontend. A execução continua em segundo
+// plano; o andamento chega pelo evento backup_report.
+func (a *App) RunBackupJob(id string) (*types.BackupReport, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.StartBackupJob(a.ctx, id)
+}
+
+// CancelBackupJob - chamado pelo frontend
+func (a *App) CancelBackupJob(id string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.CancelBackupJob(id)
+}
+
+// GetBackupReports - chamado pelo frontend
+func (a *App) GetBackupReports(id string) []types.BackupReport {
+	if a.agent == nil {
+		return nil
+	}
+	return a.agent.BackupReports(id)
+}
+
+// StartAudit - chamado pelo frontend. mode é quick ou full; vazio usa o
+// modo da configuração.
+func (a *App) StartAudit(mode string) (*types.AuditReport, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.StartAudit(a.ctx, mode)
+}
+
+// CancelAudit - chamado pelo frontend
+func (a *App) CancelAudit(auditID string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.CancelAudit(auditID)
+}
+
+// GetAuditReport - chamado pelo frontend
+func (a *App) GetAuditReport() *types.AuditReport {
+	if a.agent == nil {
+		return nil
+	}
+	return a.agent.AuditReport()
+}
+
+// RepairPackage - chamado pelo frontend
+func (a *App) RepairPackage(operationID string) (*types.EncryptionSummary, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 15*time.Minute)
+	defer cancel()
+	return a.agent.RepairPackage(ctx, operationID)
+}
+
+// GetSecurityEvents - chamado pelo frontend
+func (a *App) GetSecurityEvents(limit int) ([]types.SecurityEvent, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.SecurityEvents(limit)
+}
+
+// VerifySecurityLog - chamado pelo frontend
+func (a *App) VerifySecurityLog() (*types.SecurityLogVerification, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 2*time.Minute)
+	defer cancel()
+	return a.agent.VerifySecurityLog(ctx)
+}
+
+// ExportSecurityLog - chamado pelo frontend. Retorna o número de eventos
+// exportados, ou 0 se o usuário cancelar.
+func (a *App) ExportSecurityLog(format string) (int, error) {
+	if a.agent == nil {
+		return 0, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Minute)
+	defer cancel()
+
+	path, err := runtime.SaveFileDialog(ctx, runtime.SaveDialogOptions{
+		Title:                "Exportar registro de segurança",
+		DefaultFilename:      "tpm-bunker-security." + format,
+		CanCreateDirectories: true,
+	})
+	if err != nil || path == "" {
+		return 0, err
+	}
+	return a.agent.ExportSecurityLog(path, format)
+}
+
+// GetDeviceFingerprint - chamado pelo frontend
+func (a *App) GetDeviceFingerprint() (string, error) {
+	if a.agent == nil {
+		return "", fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Second)
+	defer cancel()
+	return a.agent.DeviceFingerprint(ctx)
+}
+
+// GetDeviceEncryptionFingerprint - chamado pelo frontend
+func (a *App) GetDeviceEncryptionFingerprint() (string, error) {
+	if a.agent == nil {
+		return "", fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Second)
+	defer cancel()
+	return a.agent.DeviceEncryptionFingerprint(ctx)
+}
+
+// ListTrustedDevices - chamado pelo frontend
+func (a *App) ListTrustedDevices() ([]types.TrustedDevice, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.TrustedDevices(), nil
+}
+
+// TrustDevice - chamado pelo frontend
+func (a *App) TrustDevice(uuid string, fingerprint string, encryptFingerprint string, name string) (*types.TrustedDevice, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
+	defer cancel()
+	return a.agent.TrustDevice(ctx, uuid, fingerprint, encryptFingerprint, name)
+}
+
+// UntrustDevice - chamado pelo frontend
+func (a *App) UntrustDevice(uuid string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.UntrustDevice(uuid)
+}
+
+// CancelTransfer - chamado pelo frontend
+func (a *App) CancelTransfer(id string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+	return a.agent.CancelTransfer(id)
+}
+
+// DeleteFile - chamado pelo frontend
+func (a *App) DeleteFile(operationID string) (bool, error) {
+	results, err := a.DeleteFiles([]string{operationID})
+	if err != nil || len(results) == 0 {
+		return false, err
+	}
+	if results[0].Error != "" {
+		return false, fmt.Errorf("%s", results[0].Error)
+	}
+	return true, nil
+}
+
+// DeleteFiles - chamado pelo frontend. Pede confirmação antes de remover;
+// se o usuário cancelar, retorna nil.
+func (a *App) DeleteFiles(operationIDs []string) ([]types.DeleteResult, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+	if len(operationIDs) == 0 {
+		return nil, nil
+	}
+
+	message := "O arquivo selecionado será removido permanentemente do servidor."
+	if len(operationIDs) > 1 {
+		message = fmt.Sprintf("%d arquivos serão removidos permanentemente do servidor.", len(operationIDs))
+	}
+	answer, err := runtime.MessageDialog(a.ctx, runtime.MessageDialogOptions{
+		Type:          runtime.QuestionDialog,
+		Title:         "Excluir",
+		Message:       message + " Deseja continuar?",
+		Buttons:       []string{"Excluir", "Cancelar"},
+		DefaultButton: "Cancelar",
+		CancelButton:  "Cancelar",
+	})
+	if err != nil {
+		return nil, err
+	}
+	// No Windows os botões personalizados são ignorados e a resposta é "Yes"
+	if answer != "Excluir" && answer != "Yes" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Minute)
+	defer cancel()
+
+	if !a.agent.IsDeviceInitialized(ctx) {
+		return nil, fmt.Errorf("device não inicializado. Aguarde a inicialização")
+	}
+	return a.agent.DeleteMany(ctx, operationIDs), nil
+}
+
+// ShareFile - chamado pelo frontend
+func (a *App) ShareFile(operationID string, deviceUUID string) (*types.Grant, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 2*time.Minute)
+	defer cancel()
+	return a.agent.Share(ctx, operationID, deviceUUID)
+}
+
+// RevokeShare - chamado pelo frontend
+func (a *App) RevokeShare(operationID string, deviceUUID string) error {
+	if a.agent == nil {
+		return fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 2*time.Minute)
+	defer cancel()
+	return a.agent.Revoke(ctx, operationID, deviceUUID)
+}
+
+// ListShares - chamado pelo frontend
+func (a *App) ListShares(operationID string) ([]types.Grant, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
+	defer cancel()
+	return a.agent.ListGrants(ctx, operationID)
+}
+
+// SignFile - chamado pelo frontend
+func (a *App) SignFile(filePath string) (string, error) {
+	if a.agent == nil {
+		return "", fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Minute)
+	defer cancel()
+	return a.agent.SignFile(ctx, filePath)
+}
+
+// VerifyFile - chamado pelo frontend
+func (a *App) VerifyFile(filePath string, bundlePath string) (*types.SignatureVerification, error) {
+	if a.agent == nil {
+		return nil, fmt.Errorf("agent não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Minute)
+	defer cancel()
+	return a.agent.VerifyFile(ctx, filePath, bundlePath)
 }
 
 // SelectFile - chamado pelo frontend
@@ -221,8 +822,68 @@ func (a *App) SelectFile() (string, error) {
 	return runtime.OpenFileDialog(ctx, options)
 }
 
+// SelectFiles - chamado pelo frontend
+func (a *App) SelectFiles() ([]string, error) {
+	if a.ctx == nil {
+		return nil, fmt.Errorf("contexto da aplicação não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Minute)
+	defer cancel()
+
+	options := runtime.OpenDialogOptions{
+		Title: "Selecione os arquivos para criptografar",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "Todos os arquivos",
+				Pattern:     "*.*",
+			},
+		},
+	}
+
+	return runtime.OpenMultipleFilesDialog(ctx, options)
+}
+
+// SelectDirectory - chamado pelo frontend
+func (a *App) SelectDirectory(title string) (string, error) {
+	if a.ctx == nil {
+		return "", fmt.Errorf("contexto da aplicação não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Minute)
+	defer cancel()
+
+	if title == "" {
+		title = "Selecione uma pasta"
+	}
+
+	return runtime.OpenDirectoryDialog(ctx, runtime.OpenDialogOptions{
+		Title:                title,
+		CanCreateDirectories: true,
+	})
+}
+
+// SelectSavePath - chamado pelo frontend
+func (a *App) SelectSavePath(defaultName string) (string, error) {
+	if a.ctx == nil {
+		return "", fmt.Errorf("contexto da aplicação não inicializado")
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Minute)
+	defer cancel()
+
+	return runtime.SaveFileDialog(ctx, runtime.SaveDialogOptions{
+		Title:                "Salvar arquivo decriptado",
+		DefaultFilename:      defaultName,
+		CanCreateDirectories: true,
+	})
+}
+
 func (a *App) shutdown(ctx context.Context) {
 	if a.cancel != nil {
 		a.cancel()
 	}
+	if a.agent != nil {
+		a.agent.Close()
+	}
 }
@@ -2,24 +2,136 @@
 // This file is automatically generated. DO NOT EDIT
 import {types} from '../models';
 
+export function AddBackupJob(arg1:types.BackupJob):Promise<types.BackupJob>;
+
+export function AddWatchedFolder(arg1:types.WatchedFolder):Promise<types.WatchedFolder>;
+
 export function AuthLogin():Promise<boolean>;
 
+export function CancelAudit(arg1:string):Promise<void>;
+
+export function CancelBackupJob(arg1:string):Promise<void>;
+
+export function CancelBatch(arg1:string):Promise<void>;
+
+export function CancelOperation(arg1:string):Promise<void>;
+
+export function CancelTransfer(arg1:string):Promise<void>;
+
 export function CheckConnection():Promise<boolean>;
 
 export function CheckTPMPresence():Promise<boolean>;
 
+export function CloseOpenedFile(arg1:string):Promise<void>;
+
 export function DecryptFile(arg1:string):Promise<void>;
 
-export function EncryptFile(arg1:string):Promise<void>;
+export function DecryptFileAs(arg1:string,arg2:string):Promise<types.DecryptResult>;
+
+export function DecryptFileTemporary(arg1:string,arg2:number):Promise<types.ScratchCopy>;
+
+export function DecryptFileTo(arg1:string,arg2:string):Promise<types.DecryptResult>;
+
+export function DeleteFile(arg1:string):Promise<boolean>;
+
+export function DeleteFiles(arg1:Array<string>):Promise<Array<types.DeleteResult>>;
+
+export function EncryptFile(arg1:string):Promise<types.EncryptionSummary>;
+
+export function EncryptFileFor(arg1:string,arg2:Array<string>):Promise<types.EncryptionSummary>;
+
+export function EncryptFiles(arg1:Array<string>):Promise<types.BatchResult>;
+
+export function EncryptFilesFor(arg1:Array<string>,arg2:Array<string>):Promise<types.BatchResult>;
+
+export function ExportSecurityLog(arg1:string):Promise<number>;
+
+export function GetAuditReport():Promise<types.AuditReport>;
+
+export function GetBackupReports(arg1:string):Promise<Array<types.BackupReport>>;
+
+export function GetDeviceEncryptionFingerprint():Promise<string>;
+
+export function GetDeviceFingerprint():Promise<string>;
 
 export function GetDeviceInfo():Promise<types.DeviceInfo>;
 
-export function GetOperations():Promise<Array<number>>;
+export function GetOutboxState():Promise<types.OutboxState>;
+
+export function GetSecurityEvents(arg1:number):Promise<Array<types.SecurityEvent>>;
 
 export function GetTPMStatus():Promise<types.TPMStatus>;
 
+export function GetWatchActivity(arg1:string):Promise<Array<types.WatchActivity>>;
+
 export function InitializeDevice():Promise<types.DeviceInfo>;
 
 export function IsDeviceInitialized():Promise<boolean>;
 
+export function ListBackupJobs():Promise<Array<types.BackupJobStatus>>;
+
+export function ListFiles():Promise<Array<types.LogicalFile>>;
+
+export function ListOperations(arg1:types.OperationFilter):Promise<types.OperationPage>;
+
+export function ListShares(arg1:string):Promise<Array<types.Grant>>;
+
+export function ListTemporaryCopies():Promise<Array<types.ScratchCopy>>;
+
+export function ListTransfers():Promise<Array<types.Transfer>>;
+
+export function ListTrustedDevices():Promise<Array<types.TrustedDevice>>;
+
+export function ListVersions(arg1:string):Promise<Array<types.FileVersion>>;
+
+export function ListWatchedFolders():Promise<Array<types.WatchedFolder>>;
+
+export function OpenFile(arg1:string):Promise<types.OpenedFile>;
+
+export function RemoveBackupJob(arg1:string):Promise<void>;
+
+export function RemoveWatchedFolder(arg1:string):Promise<void>;
+
+export function RepairPackage(arg1:string):Promise<types.EncryptionSummary>;
+
+export function RestoreVersion(arg1:string,arg2:number,arg3:string):Promise<types.DecryptResult>;
+
+export function ResumeTransfers():Promise<void>;
+
+export function RevokeShare(arg1:string,arg2:string):Promise<void>;
+
+export function RunBackupJob(arg1:string):Promise<types.BackupReport>;
+
+export function SearchOperations(arg1:string):Promise<Array<types.Operation>>;
+
+export function SelectDirectory(arg1:string):Promise<string>;
+
 export function SelectFile():Promise<string>;
+
+export function SelectFiles():Promise<Array<string>>;
+
+export function SelectSavePath(arg1:string):Promise<string>;
+
+export function SetAnnotation(arg1:string,arg2:types.Annotation):Promise<types.Annotation>;
+
+export function ShareFile(arg1:string,arg2:string):Promise<types.Grant>;
+
+export function SignFile(arg1:string):Promise<string>;
+
+export function StartAudit(arg1:string):Promise<types.AuditReport>;
+
+export function TrustDevice(arg1:string,arg2:string,arg3:string,arg4:string):Promise<types.TrustedDevice>;
+
+export function UntrustDevice(arg1:string):Promise<void>;
+
+export function UpdateBackupJob(arg1:types.BackupJob):Promise<types.BackupJob>;
+
+export function UpdateWatchedFolder(arg1:types.WatchedFolder):Promise<types.WatchedFolder>;
+
+export function VaultFile(arg1:string,arg2:Array<string>):Promise<types.VaultResult>;
+
+export function VerifyFile(arg1:string,arg2:string):Promise<types.SignatureVerification>;
+
+export function VerifySecurityLog():Promise<types.SecurityLogVerification>;
+
+export function WipeTemporaryCopy(arg1:string):Promise<void>;
@@ -2,10 +2,38 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddBackupJob(arg1) {
+  return window['go']['main']['App']['AddBackupJob'](arg1);
+}
+
+export function AddWatchedFolder(arg1) {
+  return window['go']['main']['App']['AddWatchedFolder'](arg1);
+}
+
 export function AuthLogin() {
   return window['go']['main']['App']['AuthLogin']();
 }
 
+export function CancelAudit(arg1) {
+  return window['go']['main']['App']['CancelAudit'](arg1);
+}
+
+export function CancelBackupJob(arg1) {
+  return window['go']['main']['App']['CancelBackupJob'](arg1);
+}
+
+export function CancelBatch(arg1) {
+  return window['go']['main']['App']['CancelBatch'](arg1);
+}
+
+export function CancelOperation(arg1) {
+  return window['go']['main']['App']['CancelOperation'](arg1);
+}
+
+export function CancelTransfer(arg1) {
+  return window['go']['main']['App']['CancelTransfer'](arg1);
+}
+
 export function CheckConnection() {
   return window['go']['main']['App']['CheckConnection']();
 }
@@ -14,26 +42,90 @@ export function CheckTPMPresence() {
   return window['go']['main']['App']['CheckTPMPresence']();
 }
 
+export function CloseOpenedFile(arg1) {
+  return window['go']['main']['App']['CloseOpenedFile'](arg1);
+}
+
 export function DecryptFile(arg1) {
   return window['go']['main']['App']['DecryptFile'](arg1);
 }
 
+export function DecryptFileAs(arg1, arg2) {
+  return window['go']['main']['App']['DecryptFileAs'](arg1, arg2);
+}
+
+export function DecryptFileTemporary(arg1, arg2) {
+  return window['go']['main']['App']['DecryptFileTemporary'](arg1, arg2);
+}
+
+export function DecryptFileTo(arg1, arg2) {
+  return window['go']['main']['App']['DecryptFileTo'](arg1, arg2);
+}
+
+export function DeleteFile(arg1) {
+  return window['go']['main']['App']['DeleteFile'](arg1);
+}
+
+export function DeleteFiles(arg1) {
+  return window['go']['main']['App']['DeleteFiles'](arg1);
+}
+
 export function EncryptFile(arg1) {
   return window['go']['main']['App']['EncryptFile'](arg1);
 }
 
+export function EncryptFileFor(arg1, arg2) {
+  return window['go']['main']['App']['EncryptFileFor'](arg1, arg2);
+}
+
+export function EncryptFiles(arg1) {
+  return window['go']['main']['App']['EncryptFiles'](arg1);
+}
+
+export function EncryptFilesFor(arg1, arg2) {
+  return window['go']['main']['App']['EncryptFilesFor'](arg1, arg2);
+}
+
+export function ExportSecurityLog(arg1) {
+  return window['go']['main']['App']['ExportSecurityLog'](arg1);
+}
+
+export function GetAuditReport() {
+  return window['go']['main']['App']['GetAuditReport']();
+}
+
+export function GetBackupReports(arg1) {
+  return window['go']['main']['App']['GetBackupReports'](arg1);
+}
+
+export function GetDeviceEncryptionFingerprint() {
+  return window['go']['main']['App']['GetDeviceEncryptionFingerprint']();
+}
+
+export function GetDeviceFingerprint() {
+  return window['go']['main']['App']['GetDeviceFingerprint']();
+}
+
 export function GetDeviceInfo() {
   return window['go']['main']['App']['GetDeviceInfo']();
 }
 
-export function GetOperations() {
-  return window['go']['main']['App']['GetOperations']();
+export function GetOutboxState() {
+  return window['go']['main']['App']['GetOutboxState']();
+}
+
+export function GetSecurityEvents(arg1) {
+  return window['go']['main']['App']['GetSecurityEvents'](arg1);
 }
 
 export function GetTPMStatus() {
   return window['go']['main']['App']['GetTPMStatus']();
 }
 
+export function GetWatchActivity(arg1) {
+  return window['go']['main']['App']['GetWatchActivity'](arg1);
+}
+
 export function InitializeDevice() {
   return window['go']['main']['App']['InitializeDevice']();
 }
@@ -42,6 +134,138 @@ export function IsDeviceInitialized() {
   return window['go']['main']['App']['IsDeviceInitialized']();
 }
 
+export function ListBackupJobs() {
+  return window['go']['main']['App']['ListBackupJobs']();
+}
+
+export function ListFiles() {
+  return window['go']['main']['App']['ListFiles']();
+}
+
+export function ListOperations(arg1) {
+  return window['go']['main']['App']['ListOperations'](arg1);
+}
+
+export function ListShares(arg1) {
+  return window['go']['main']['App']['ListShares'](arg1);
+}
+
+export function ListTemporaryCopies() {
+  return window['go']['main']['App']['ListTemporaryCopies']();
+}
+
+export function ListTransfers() {
+  return window['go']['main']['App']['ListTransfers']();
+}
+
+export function ListTrustedDevices() {
+  return window['go']['main']['App']['ListTrustedDevices']();
+}
+
+export function ListVersions(arg1) {
+  return window['go']['main']['App']['ListVersions'](arg1);
+}
+
+export function ListWatchedFolders() {
+  return window['go']['main']['App']['ListWatchedFolders']();
+}
+
+export function OpenFile(arg1) {
+  return window['go']['main']['App']['OpenFile'](arg1);
+}
+
+export function RemoveBackupJob(arg1) {
+  return window['go']['main']['App']['RemoveBackupJob'](arg1);
+}
+
+export function RemoveWatchedFolder(arg1) {
+  return window['go']['main']['App']['RemoveWatchedFolder'](arg1);
+}
+
+export function RepairPackage(arg1) {
+  return window['go']['main']['App']['RepairPackage'](arg1);
+}
+
+export function RestoreVersion(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RestoreVersion'](arg1, arg2, arg3);
+}
+
+export function ResumeTransfers() {
+  return window['go']['main']['App']['ResumeTransfers']();
+}
+
+export function RevokeShare(arg1, arg2) {
+  return window['go']['main']['App']['RevokeShare'](arg1, arg2);
+}
+
+export function RunBackupJob(arg1) {
+  return window['go']['main']['App']['RunBackupJob'](arg1);
+}
+
+export function SearchOperations(arg1) {
+  return window['go']['main']['App']['SearchOperations'](arg1);
+}
+
+export function SelectDirectory(arg1) {
+  return window['go']['main']['App']['SelectDirectory'](arg1);
+}
+
 export function SelectFile() {
   return window['go']['main']['App']['SelectFile']();
 }
+
+export function SelectFiles() {
+  return window['go']['main']['App']['SelectFiles']();
+}
+
+export function SelectSavePath(arg1) {
+  return window['go']['main']['App']['SelectSavePath'](arg1);
+}
+
+export function SetAnnotation(arg1, arg2) {
+  return window['go']['main']['App']['SetAnnotation'](arg1, arg2);
+}
+
+export function ShareFile(arg1, arg2) {
+  return window['go']['main']['App']['ShareFile'](arg1, arg2);
+}
+
+export function SignFile(arg1) {
+  return window['go']['main']['App']['SignFile'](arg1);
+}
+
+export function StartAudit(arg1) {
+  return window['go']['main']['App']['StartAudit'](arg1);
+}
+
+export function TrustDevice(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['TrustDevice'](arg1, arg2, arg3, arg4);
+}
+
+export function UntrustDevice(arg1) {
+  return window['go']['main']['App']['UntrustDevice'](arg1);
+}
+
+export function UpdateBackupJob(arg1) {
+  return window['go']['main']['App']['UpdateBackupJob'](arg1);
+}
+
+export function UpdateWatchedFolder(arg1) {
+  return window['go']['main']['App']['UpdateWatchedFolder'](arg1);
+}
+
+export function VaultFile(arg1, arg2) {
+  return window['go']['main']['App']['VaultFile'](arg1, arg2);
+}
+
+export function VerifyFile(arg1, arg2) {
+  return window['go']['main']['App']['VerifyFile'](arg1, arg2);
+}
+
+export function VerifySecurityLog() {
+  return window['go']['main']['App']['VerifySecurityLog']();
+}
+
+export function WipeTemporaryCopy(arg1) {
+  return window['go']['main']['App']['WipeTemporaryCopy'](arg1);
+}
@@ -1,8 +1,358 @@
 export namespace types {
 	
+	export class Annotation {
+	    tags: string[];
+	    notes: string;
+	    classification: string;
+	    updated_by: string;
+	    updated_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Annotation(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.tags = source["tags"];
+	        this.notes = source["notes"];
+	        this.classification = source["classification"];
+	        this.updated_by = source["updated_by"];
+	        this.updated_at = source["updated_at"];
+	    }
+	}
+	export class AuditReport {
+	    audit_id: string;
+	    mode: string;
+	    started_at: string;
+	    finished_at: string;
+	    running: boolean;
+	    cancelled: boolean;
+	    total: number;
+	    checked: number;
+	    passed: number;
+	    corrupted: number;
+	    missing: number;
+	    errors: number;
+	    error: string;
+	    results: AuditResult[];
+	
+	    static createFrom(source: any = {}) {
+	        return new AuditReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.audit_id = source["audit_id"];
+	        this.mode = source["mode"];
+	        this.started_at = source["started_at"];
+	        this.finished_at = source["finished_at"];
+	        this.running = source["running"];
+	        this.cancelled = source["cancelled"];
+	        this.total = source["total"];
+	        this.checked = source["checked"];
+	        this.passed = source["passed"];
+	        this.corrupted = source["corrupted"];
+	        this.missing = source["missing"];
+	        this.errors = source["errors"];
+	        this.error = source["error"];
+	        this.results = this.convertValues(source["results"], AuditResult);
+	    }
+	
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class AuditResult {
+	    operation_id: string;
+	    file_name: string;
+	    status: string;
+	    method: string;
+	    error: string;
+	    local_path: string;
+	    repaired: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new AuditResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation_id = source["operation_id"];
+	        this.file_name = source["file_name"];
+	        this.status = source["status"];
+	        this.method = source["method"];
+	        this.error = source["error"];
+	        this.local_path = source["local_path"];
+	        this.repaired = source["repaired"];
+	    }
+	}
+	export class BackupFileError {
+	    path: string;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupFileError(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.error = source["error"];
+	    }
+	}
+	export class BackupJob {
+	    id: string;
+	    name: string;
+	    path: string;
+	    include: string[];
+	    exclude: string[];
+	    time: string;
+	    weekdays: number[];
+	    keep_versions: number;
+	    keep_days: number;
+	    enabled: boolean;
+	    created_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupJob(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.path = source["path"];
+	        this.include = source["include"];
+	        this.exclude = source["exclude"];
+	        this.time = source["time"];
+	        this.weekdays = source["weekdays"];
+	        this.keep_versions = source["keep_versions"];
+	        this.keep_days = source["keep_days"];
+	        this.enabled = source["enabled"];
+	        this.created_at = source["created_at"];
+	    }
+	}
+	export class BackupJobStatus {
+	    job: BackupJob;
+	    last_run: string;
+	    next_run: string;
+	    running: boolean;
+	    last_report?: BackupReport;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupJobStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.job = this.convertValues(source["job"], BackupJob);
+	        this.last_run = source["last_run"];
+	        this.next_run = source["next_run"];
+	        this.running = source["running"];
+	        this.last_report = this.convertValues(source["last_report"], BackupReport);
+	    }
+	
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class BackupReport {
+	    run_id: string;
+	    job_id: string;
+	    trigger: string;
+	    started_at: string;
+	    finished_at: string;
+	    running: boolean;
+	    scanned: number;
+	    unchanged: number;
+	    uploaded: number;
+	    queued: number;
+	    failed: number;
+	    pruned: number;
+	    bytes: number;
+	    errors: BackupFileError[];
+	    cancelled: boolean;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.run_id = source["run_id"];
+	        this.job_id = source["job_id"];
+	        this.trigger = source["trigger"];
+	        this.started_at = source["started_at"];
+	        this.finished_at = source["finished_at"];
+	        this.running = source["running"];
+	        this.scanned = source["scanned"];
+	        this.unchanged = source["unchanged"];
+	        this.uploaded = source["uploaded"];
+	        this.queued = source["queued"];
+	        this.failed = source["failed"];
+	        this.pruned = source["pruned"];
+	        this.bytes = source["bytes"];
+	        this.errors = this.convertValues(source["errors"], BackupFileError);
+	        this.cancelled = source["cancelled"];
+	        this.error = source["error"];
+	    }
+	
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class BatchFileResult {
+	    path: string;
+	    summary?: EncryptionSummary;
+	    error: string;
+	    cancelled: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new BatchFileResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.summary = this.convertValues(source["summary"], EncryptionSummary);
+	        this.error = source["error"];
+	        this.cancelled = source["cancelled"];
+	    }
+	
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class BatchResult {
+	    batch_id: string;
+	    results: BatchFileResult[];
+	    cancelled: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new BatchResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.batch_id = source["batch_id"];
+	        this.results = this.convertValues(source["results"], BatchFileResult);
+	        this.cancelled = source["cancelled"];
+	    }
+	
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class DecryptResult {
+	    path: string;
+	    skipped_attributes: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new DecryptResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.skipped_attributes = source["skipped_attributes"];
+	    }
+	}
+	export class DeleteResult {
+	    operation_id: string;
+	    deleted: boolean;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DeleteResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation_id = source["operation_id"];
+	        this.deleted = source["deleted"];
+	        this.error = source["error"];
+	    }
+	}
 	export class DeviceInfo {
 	    UUID: string;
 	    PublicKey: string;
+	    EncryptionKey: string;
 	    EK: number[];
 	    AIK: number[];
 	
@@ -14,10 +364,385 @@ export namespace types {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.UUID = source["UUID"];
 	        this.PublicKey = source["PublicKey"];
+	        this.EncryptionKey = source["EncryptionKey"];
 	        this.EK = source["EK"];
 	        this.AIK = source["AIK"];
 	    }
 	}
+	export class EncryptionSummary {
+	    operation_id: string;
+	    file_name: string;
+	    compression: string;
+	    original_size: number;
+	    stored_size: number;
+	    compression_ratio: number;
+	    recipients: string[];
+	    ciphertext_size: number;
+	    padding: string;
+	    padding_overhead: number;
+	    deduplicated: boolean;
+	    file_id: string;
+	    version: number;
+	    queued: boolean;
+	    transfer_id: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new EncryptionSummary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation_id = source["operation_id"];
+	        this.file_name = source["file_name"];
+	        this.compression = source["compression"];
+	        this.original_size = source["original_size"];
+	        this.stored_size = source["stored_size"];
+	        this.compression_ratio = source["compression_ratio"];
+	        this.recipients = source["recipients"];
+	        this.ciphertext_size = source["ciphertext_size"];
+	        this.padding = source["padding"];
+	        this.padding_overhead = source["padding_overhead"];
+	        this.deduplicated = source["deduplicated"];
+	        this.file_id = source["file_id"];
+	        this.version = source["version"];
+	        this.queued = source["queued"];
+	        this.transfer_id = source["transfer_id"];
+	    }
+	}
+	export class FileVersion {
+	    file_id: string;
+	    version: number;
+	    operation_id: string;
+	    previous_operation_id: string;
+	    file_name: string;
+	    size: number;
+	    created_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FileVersion(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.file_id = source["file_id"];
+	        this.version = source["version"];
+	        this.operation_id = source["operation_id"];
+	        this.previous_operation_id = source["previous_operation_id"];
+	        this.file_name = source["file_name"];
+	        this.size = source["size"];
+	        this.created_at = source["created_at"];
+	    }
+	}
+	export class Grant {
+	    operation_id: string;
+	    device_uuid: string;
+	    key_id: string;
+	    granted_by: string;
+	    created_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Grant(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operation_id = source["operation_id"];
+	        this.device_uuid = source["device_uuid"];
+	        this.key_id = source["key_id"];
+	        this.granted_by = source["granted_by"];
+	        this.created_at = source["created_at"];
+	    }
+	}
+	export class LogicalFile {
+	    file_id: string;
+	    path: string;
+	    versions: FileVersion[];
+	    reserved: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LogicalFile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.file_id = source["file_id"];
+	        this.path = source["path"];
+	        this.versions = this.convertValues(source["versions"], FileVersion);
+	        this.reserved = source["reserved"];
+	    }
+	
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class OpenedFile {
+	    id: string;
+	    file_name: string;
+	    mime_type: string;
+	    size: number;
+	    url: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new OpenedFile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.file_name = source["file_name"];
+	        this.mime_type = source["mime_type"];
+	        this.size = source["size"];
+	        this.url = source["url"];
+	    }
+	}
+	export class Operation {
+	    id: string;
+	    operation_type: string;
+	    status: string;
+	    error_message: string;
+	    created_at: string;
+	    updated_at: string;
+	    file_name: string;
+	    file_size: number;
+	    kind: string;
+	    original_size: number;
+	    mime_type: string;
+	    file_id: string;
+	    version: number;
+	    tags: string[];
+	    notes: string;
+	    classification: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Operation(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.operation_type = source["operation_type"];
+	        this.status = source["status"];
+	        this.error_message = source["error_message"];
+	        this.created_at = source["created_at"];
+	        this.updated_at = source["updated_at"];
+	        this.file_name = source["file_name"];
+	        this.file_size = source["file_size"];
+	        this.kind = source["kind"];
+	        this.original_size = source["original_size"];
+	        this.mime_type = source["mime_type"];
+	        this.file_id = source["file_id"];
+	        this.version = source["version"];
+	        this.tags = source["tags"];
+	        this.notes = source["notes"];
+	        this.classification = source["classification"];
+	    }
+	}
+	export class OperationFilter {
+	    type: string;
+	    status: string;
+	    from: string;
+	    to: string;
+	    name: string;
+	    tag: string;
+	    classification: string;
+	    sort: string;
+	    page: number;
+	    page_size: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new OperationFilter(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.status = source["status"];
+	        this.from = source["from"];
+	        this.to = source["to"];
+	        this.name = source["name"];
+	        this.tag = source["tag"];
+	        this.classification = source["classification"];
+	        this.sort = source["sort"];
+	        this.page = source["page"];
+	        this.page_size = source["page_size"];
+	    }
+	}
+	export class OperationPage {
+	    operations: Operation[];
+	    total: number;
+	    page: number;
+	    page_size: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new OperationPage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.operations = this.convertValues(source["operations"], Operation);
+	        this.total = source["total"];
+	        this.page = source["page"];
+	        this.page_size = source["page_size"];
+	    }
+	
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class OutboxState {
+	    pending: number;
+	    syncing: boolean;
+	    online: boolean;
+	    last_error: string;
+	    next_attempt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new OutboxState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.pending = source["pending"];
+	        this.syncing = source["syncing"];
+	        this.online = source["online"];
+	        this.last_error = source["last_error"];
+	        this.next_attempt = source["next_attempt"];
+	    }
+	}
+	export class ScratchCopy {
+	    path: string;
+	    operation_id: string;
+	    file_name: string;
+	    created_at: string;
+	    expires_at: string;
+	    remaining_seconds: number;
+	    skipped_attributes: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ScratchCopy(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.operation_id = source["operation_id"];
+	        this.file_name = source["file_name"];
+	        this.created_at = source["created_at"];
+	        this.expires_at = source["expires_at"];
+	        this.remaining_seconds = source["remaining_seconds"];
+	        this.skipped_attributes = source["skipped_attributes"];
+	    }
+	}
+	export class SecurityEvent {
+	    seq: number;
+	    time: string;
+	    type: string;
+	    outcome: string;
+	    device_uuid: string;
+	    operation_id: string;
+	    target: string;
+	    detail: string;
+	    prev_hash: string;
+	    hash: string;
+	    signature: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SecurityEvent(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.seq = source["seq"];
+	        this.time = source["time"];
+	        this.type = source["type"];
+	        this.outcome = source["outcome"];
+	        this.device_uuid = source["device_uuid"];
+	        this.operation_id = source["operation_id"];
+	        this.target = source["target"];
+	        this.detail = source["detail"];
+	        this.prev_hash = source["prev_hash"];
+	        this.hash = source["hash"];
+	        this.signature = source["signature"];
+	    }
+	}
+	export class SecurityLogVerification {
+	    valid: boolean;
+	    entries: number;
+	    checkpoints: number;
+	    last_checkpoint_seq: number;
+	    unanchored: number;
+	    problems: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SecurityLogVerification(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.valid = source["valid"];
+	        this.entries = source["entries"];
+	        this.checkpoints = source["checkpoints"];
+	        this.last_checkpoint_seq = source["last_checkpoint_seq"];
+	        this.unanchored = source["unanchored"];
+	        this.problems = source["problems"];
+	    }
+	}
+	export class SignatureVerification {
+	    valid: boolean;
+	    signer_uuid: string;
+	    signed_at: string;
+	    file_digest: string;
+	    key_source: string;
+	    trusted: boolean;
+	    signer_fingerprint: string;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SignatureVerification(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.valid = source["valid"];
+	        this.signer_uuid = source["signer_uuid"];
+	        this.signed_at = source["signed_at"];
+	        this.file_digest = source["file_digest"];
+	        this.key_source = source["key_source"];
+	        this.trusted = source["trusted"];
+	        this.signer_fingerprint = source["signer_fingerprint"];
+	        this.error = source["error"];
+	    }
+	}
 	export class TPMStatus {
 	    available: boolean;
 	    initialized: boolean;
@@ -32,6 +757,151 @@ export namespace types {
 	        this.initialized = source["initialized"];
 	    }
 	}
+	export class Transfer {
+	    id: string;
+	    direction: string;
+	    file_name: string;
+	    operation_id: string;
+	    size: number;
+	    chunks_done: number;
+	    chunk_count: number;
+	    complete: boolean;
+	    active: boolean;
+	    created_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Transfer(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.direction = source["direction"];
+	        this.file_name = source["file_name"];
+	        this.operation_id = source["operation_id"];
+	        this.size = source["size"];
+	        this.chunks_done = source["chunks_done"];
+	        this.chunk_count = source["chunk_count"];
+	        this.complete = source["complete"];
+	        this.active = source["active"];
+	        this.created_at = source["created_at"];
+	    }
+	}
+	export class TrustedDevice {
+	    uuid: string;
+	    name: string;
+	    fingerprint: string;
+	    sign_key: string;
+	    encrypt_fingerprint: string;
+	    encrypt_key: string;
+	    added_at: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TrustedDevice(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.uuid = source["uuid"];
+	        this.name = source["name"];
+	        this.fingerprint = source["fingerprint"];
+	        this.sign_key = source["sign_key"];
+	        this.encrypt_fingerprint = source["encrypt_fingerprint"];
+	        this.encrypt_key = source["encrypt_key"];
+	        this.added_at = source["added_at"];
+	    }
+	}
+	export class VaultResult {
+	    summary: EncryptionSummary;
+	    verified: boolean;
+	    source_digest: string;
+	    removed: boolean;
+	    overwritten: boolean;
+	    filesystem: string;
+	    warning: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new VaultResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.summary = this.convertValues(source["summary"], EncryptionSummary);
+	        this.verified = source["verified"];
+	        this.source_digest = source["source_digest"];
+	        this.removed = source["removed"];
+	        this.overwritten = source["overwritten"];
+	        this.filesystem = source["filesystem"];
+	        this.warning = source["warning"];
+	    }
+	
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class WatchActivity {
+	    folder_id: string;
+	    path: string;
+	    action: string;
+	    operation_id: string;
+	    message: string;
+	    time: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new WatchActivity(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.folder_id = source["folder_id"];
+	        this.path = source["path"];
+	        this.action = source["action"];
+	        this.operation_id = source["operation_id"];
+	        this.message = source["message"];
+	        this.time = source["time"];
+	    }
+	}
+	export class WatchedFolder {
+	    id: string;
+	    path: string;
+	    include: string[];
+	    exclude: string[];
+	    recursive: boolean;
+	    stable_seconds: number;
+	    remove_originals: boolean;
+	    enabled: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new WatchedFolder(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.path = source["path"];
+	        this.include = source["include"];
+	        this.exclude = source["exclude"];
+	        this.recursive = source["recursive"];
+	        this.stable_seconds = source["stable_seconds"];
+	        this.remove_originals = source["remove_originals"];
+	        this.enabled = source["enabled"];
+	    }
+	}
 
 }
 
@@ -7,7 +7,9 @@ toolchain go1.23.2
 require (
 	github.com/google/go-tpm v0.9.3
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.17.11
 	github.com/wailsapp/wails/v2 v2.9.2
+	golang.org/x/sys v0.29.0
 )
 
 require (
@@ -34,7 +36,6 @@ require (
 	github.com/wailsapp/mimetype v1.4.1 // indirect
 	golang.org/x/crypto v0.32.0 // indirect
 	golang.org/x/net v0.34.0 // indirect
-	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 )
 
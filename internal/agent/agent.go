@@ -1,31 +1,110 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/config"
 	"tpm-bunker/internal/tpm"
 	"tpm-bunker/internal/types"
 )
 
 type Agent struct {
-	ctx    context.Context
-	tpmMgr *tpm.Manager
-	client *api.APIClient
+	ctx     context.Context
+	tpmMgr  *tpm.Manager
+	client  *api.APIClient
+	config  *config.Config
+	scratch *scratchStore
+
+	// Metadados de pacotes já decriptados nesta sessão
+	metadata metadataCache
+
+	// Conteúdos abertos em memória para visualização
+	opened openedStore
+
+	// Chaves locais e etiquetas de deduplicação
+	secrets secretStore
+	dedup   dedupCache
+
+	// Histórico de versões dos arquivos lógicos
+	versions versionStore
+
+	// Listagem de operações sincronizada com a API
+	operations operationCache
+
+	// Envios e recebimentos em partes e a fila de saída
+	transfers transferStore
+	outbox    *outbox
+
+	// Operações e lotes em andamento, canceláveis pelo ID
+	running cancelStore
+
+	// Pastas vigiadas
+	watcher *watcher
+
+	// Backups agendados
+	backups *backupScheduler
+
+	// Auditoria de integridade dos pacotes armazenados
+	audits *auditor
+
+	// Registro local de eventos de segurança
+	securityLog *securityLog
+
+	// Destino dos eventos do agente
+	notifyMutex sync.Mutex
+	notify      func(event string, data interface{})
 }
 
 func NewAgent(ctx context.Context, tpmMgr *tpm.Manager, client *api.APIClient) *Agent {
-	return &Agent{
-		ctx:    ctx,
-		tpmMgr: tpmMgr,
-		client: client,
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("Aviso: usando configuração padrão: %v", err)
+	}
+
+	scratch, err := openScratchStore()
+	if err != nil {
+		log.Printf("Aviso: cópias temporárias desativadas: %v", err)
+	} else {
+		go scratch.run(ctx)
+	}
+
+	a := &Agent{
+		ctx:     ctx,
+		tpmMgr:  tpmMgr,
+		client:  client,
+		config:  cfg,
+		scratch: scratch,
+		outbox:  newOutbox(),
+		watcher: newWatcher(),
+		backups: newBackupScheduler(),
+		audits:  newAuditor(),
+
+		securityLog: newSecurityLog(),
+	}
+	go a.runOutbox(ctx)
+	go a.runWatcher(ctx)
+	go a.runBackups(ctx)
+	go a.runAudits(ctx)
+	go a.runSecurityLog(ctx)
+	return a
+}
+
+// deviceHeader retorna os cabeçalhos que identificam o dispositivo na API
+func (a *Agent) deviceHeader() map[string]string {
+	return map[string]string{
+		"X-Device-UUID": a.tpmMgr.DeviceUUID,
 	}
 }
 
@@ -35,7 +114,9 @@ func (a *Agent) GetTPMStatus(ctx context.Context) (*types.TPMStatus, error) {
 }
 
 // InitializeDevice inicializa o dispositivo com TPM pela primeira vez
-func (a *Agent) InitializeDevice(ctx context.Context) (*types.DeviceInfo, error) {
+func (a *Agent) InitializeDevice(ctx context.Context) (_ *types.DeviceInfo, err error) {
+	defer func() { a.logEvent(EventInit, err, types.SecurityEvent{}) }()
+
 	// Criamos um timeout específico para inicialização
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
@@ -66,11 +147,18 @@ func (a *Agent) InitializeDevice(ctx context.Context) (*types.DeviceInfo, error)
 		return nil, fmt.Errorf("erro ao obter chave pública: %w", err)
 	}
 
+	// Obter chave pública de encriptação
+	encryptionKey, err := a.tpmMgr.GetEncryptionKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter chave de encriptação: %w", err)
+	}
+
 	deviceInfo := &types.DeviceInfo{
-		UUID:      uuid,
-		PublicKey: pubKey,
-		AIK:       a.tpmMgr.AIK,
-		EK:        a.tpmMgr.EK,
+		UUID:          uuid,
+		PublicKey:     pubKey,
+		EncryptionKey: encryptionKey,
+		AIK:           a.tpmMgr.AIK,
+		EK:            a.tpmMgr.EK,
 	}
 
 	// Verifica a conexão com a API
@@ -114,11 +202,21 @@ func (a *Agent) AuthLogin(ctx context.Context) bool {
 	defer cancel()
 
 	fmt.Printf("Realizando login na API...")
-	if err := a.client.Login(loginCtx, deviceInfo.UUID, a.tpmMgr.EK); err != nil {
+	err = a.client.Login(loginCtx, deviceInfo.UUID, a.tpmMgr.EK)
+	a.logEvent(EventLogin, err, types.SecurityEvent{})
+	if err != nil {
 		log.Printf("Falha no login: %v", err)
 		return false
 	}
 
+	if err := a.publishEncryptionKey(ctx); err != nil {
+		log.Printf("Aviso: chave de encriptação não publicada: %v", err)
+	}
+
+	// Com a sessão aberta, envia a fila de saída e retoma a auditoria
+	a.outbox.wake()
+	a.audits.wake()
+
 	return true
 }
 
@@ -140,9 +238,11 @@ func (a *Agent) GetDeviceInfo(ctx context.Context) (*types.DeviceInfo, error) {
 	default:
 		uuid, _ := a.tpmMgr.GetDeviceUUID(ctx)
 		pubKey, _ := a.tpmMgr.GetPublicKey(ctx)
+		encryptionKey, _ := a.tpmMgr.GetEncryptionKey(ctx)
 		return &types.DeviceInfo{
-			UUID:      uuid,
-			PublicKey: pubKey,
+			UUID:          uuid,
+			PublicKey:     pubKey,
+			EncryptionKey: encryptionKey,
 		}, nil
 	}
 }
@@ -174,137 +274,493 @@ func (a *Agent) CheckConnection(ctx context.Context) bool {
 	return hasConnection
 }
 
-// GetOperations recupera as operações entre Agente e API
-func (a *Agent) GetOperations(ctx context.Context) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
-	defer cancel()
-
-	// Verifica cancelamento
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-		header := map[string]string{
-			"X-Device-UUID": a.tpmMgr.DeviceUUID,
-		}
+// Encrypt encripta um arquivo ou diretório e o envia para a API. Além deste
+// dispositivo, os destinatários padrão da configuração também poderão abri-lo.
+func (a *Agent) Encrypt(ctx context.Context, filePath string) (*types.EncryptionSummary, error) {
+	return a.EncryptFor(ctx, filePath, a.config.DefaultRecipients)
+}
 
-		// Envia para API com timeout específico
-		apiCtx, apiCancel := context.WithTimeout(ctx, 2*time.Minute)
-		defer apiCancel()
-		log.Printf("Realizando get de operações")
-		return a.client.SendRequest(apiCtx, http.MethodGet, "operations/", header, nil)
-	}
+// EncryptFor encripta um arquivo ou diretório para este dispositivo e para os
+// dispositivos informados, buscando suas chaves no registro da API. O
+// andamento é publicado em eventos de progresso; cancelada antes do fim do
+// envio, a operação não deixa pacote no servidor nem na fila de saída.
+func (a *Agent) EncryptFor(ctx context.Context, filePath string, recipientUUIDs []string) (*types.EncryptionSummary, error) {
+	return a.encryptFor(ctx, filePath, recipientUUIDs, "")
 }
 
-// Encrypt encripta um arquivo e o envia para a API
-func (a *Agent) Encrypt(ctx context.Context, filePath string) ([]byte, error) {
+// encryptFor implementa EncryptFor. Pacotes de um backup agendado (jobID)
+// seguem a retenção do job em vez da global.
+func (a *Agent) encryptFor(ctx context.Context, filePath string, recipientUUIDs []string, jobID string) (_ *types.EncryptionSummary, err error) {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
+	ctx, p := a.track(ctx, "encrypt", filePath)
+	defer p.finish(&err)
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
-		encryptKey, err := a.tpmMgr.Client.RetrieveRSADecryptKey(ctx)
+		recipients, err := a.resolveRecipients(ctx, recipientUUIDs)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get encryption key: %w", err)
+			return nil, fmt.Errorf("failed to resolve recipients: %w", err)
+		}
+
+		summary, transfer, err := a.encryptToOutbox(ctx, filePath, recipients, jobID)
+		if err != nil || transfer == nil {
+			return summary, err
 		}
 
-		result, err := EncryptFile(ctx, filePath, encryptKey, a.tpmMgr)
+		// A transferência chega reservada por createUpload: o worker da fila
+		// não a envia enquanto ela é entregue aqui, e um cancelamento a
+		// descarta antes que qualquer registro chegue ao servidor
+		err = a.deliver(ctx, summary, transfer)
 		if err != nil {
-			return nil, fmt.Errorf("encryption error: %w", err)
+			if p.wasCancelled() {
+				a.discardTransfer(transfer)
+				a.transfers.release(transfer.ID)
+				return nil, err
+			}
+			if errors.Is(err, errTransferRejected) {
+				a.transfers.release(transfer.ID)
+				return nil, err
+			}
+			// Expirou durante o envio; o worker continua de onde parou
+			summary.Queued = true
 		}
 
-		payload := &api.EncryptionRequest{
-			EncryptedData:    result.EncryptedData,
-			EncryptedKey:     result.EncryptedSymmetricKey,
-			DigitalSignature: result.DigitalSignature,
-			HashOriginal:     result.HashOriginal,
-			Metadata:         result.Metadata,
+		a.transfers.release(transfer.ID)
+		if summary.Queued {
+			a.outbox.wake()
 		}
+		return summary, nil
+	}
+}
+
+// encryptToOutbox encripta um arquivo ou diretório e grava o pacote na fila
+// de saída, registrando o evento de segurança. Um arquivo já armazenado é
+// reconhecido pela deduplicação e retorna apenas o resumo, sem transferência.
+// A transferência retorna reservada, e quem chama a libera para o worker.
+func (a *Agent) encryptToOutbox(ctx context.Context, filePath string, recipients []Recipient, jobID string) (*types.EncryptionSummary, *transferState, error) {
+	summary, transfer, err := a.encryptPackage(ctx, filePath, recipients, jobID)
+
+	// A operação de um pacote novo só existe após o envio, registrado à
+	// parte por sendClaimed
+	event := types.SecurityEvent{Target: filePath}
+	switch {
+	case summary != nil && summary.Deduplicated:
+		event.OperationID = summary.OperationID
+		event.Detail = "conteúdo já armazenado"
+	case transfer != nil:
+		event.Detail = "pacote na fila de saída"
+	}
+	a.logEvent(EventEncrypt, err, event)
+
+	return summary, transfer, err
+}
+
+func (a *Agent) encryptPackage(ctx context.Context, filePath string, recipients []Recipient, jobID string) (*types.EncryptionSummary, *transferState, error) {
+	encryptKey, err := a.tpmMgr.Client.RetrieveRSADecryptKey(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get encryption key: %w", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat input: %w", err)
+	}
 
-		header := map[string]string{
-			"X-Device-UUID": a.tpmMgr.DeviceUUID,
+	if !validPadding(a.config.Padding) {
+		return nil, nil, fmt.Errorf("política de padding desconhecida: %s", a.config.Padding)
+	}
+
+	var tag string
+	if a.config.Deduplicate {
+		summary, dedupTag, err := a.findDuplicate(ctx, filePath, info, recipients)
+		if err != nil {
+			log.Printf("Aviso: deduplicação indisponível: %v", err)
+		} else if summary != nil {
+			return summary, nil, nil
 		}
+		tag = dedupTag
+	}
+
+	// Novos envios do mesmo caminho são versões do mesmo arquivo lógico
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve path: %w", err)
+	}
+	version := a.versions.next(absPath)
+
+	opts := &PackageOptions{
+		Compression: a.config.Compression,
+		Recipients:  recipients,
+		Padding:     a.config.Padding,
+		Version:     version,
+	}
+
+	// O pacote é cifrado direto na fila de saída em disco. Sem conexão, a
+	// encriptação conclui assim mesmo e o worker envia depois.
+	transfer, out, err := a.createUpload()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var result *EncryptionResult
+	if info.IsDir() {
+		result, err = EncryptDirectory(ctx, filePath, encryptKey, a.tpmMgr, opts, out)
+	} else {
+		result, err = EncryptFile(ctx, filePath, encryptKey, a.tpmMgr, opts, out)
+	}
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("erro ao gravar pacote para envio: %w", closeErr)
+	}
+	if err != nil {
+		a.dropUpload(transfer)
+		return nil, nil, fmt.Errorf("encryption error: %w", err)
+	}
+
+	if tag != "" {
+		result.Metadata["dedup_tag"] = tag
+	}
 
-		apiCtx, apiCancel := context.WithTimeout(ctx, 2*time.Minute)
-		defer apiCancel()
+	summary := &types.EncryptionSummary{
+		FileName:        result.FileName,
+		Compression:     result.Compression,
+		OriginalSize:    result.OriginalSize,
+		StoredSize:      result.CompressedSize,
+		CiphertextSize:  result.CiphertextSize,
+		Padding:         opts.Padding,
+		PaddingOverhead: result.PaddingOverhead,
+		FileID:          version.FileID,
+		Version:         version.Version,
+	}
+	for _, wk := range result.WrappedKeys {
+		summary.Recipients = append(summary.Recipients, wk.DeviceUUID)
+	}
+	if result.CompressedSize > 0 {
+		summary.CompressionRatio = float64(result.OriginalSize) / float64(result.CompressedSize)
+	}
 
-		return a.client.EncryptRequest(apiCtx, http.MethodPost, "operations/store_data/", header, payload)
+	if err := a.queueUpload(transfer, out, result, summary, absPath, version, jobID); err != nil {
+		return nil, nil, err
 	}
+	return summary, transfer, nil
+}
+
+// deliver tenta enviar agora um pacote da fila de saída, já reservado por
+// quem chama, que o libera para o worker depois. Sem conexão ou com
+// falha de rede ou do servidor, o pacote fica na fila e summary.Queued é
+// marcado. Um pacote recusado pela API (4xx) é retirado da fila e o erro,
+// com errTransferRejected, é retornado; também retorna erro se ctx terminar
+// antes do fim do envio.
+func (a *Agent) deliver(ctx context.Context, summary *types.EncryptionSummary, transfer *transferState) error {
+	checkCtx, checkCancel := context.WithTimeout(ctx, 10*time.Second)
+	online := a.client.CheckConnection(checkCtx)
+	checkCancel()
+
+	var err error
+	if online {
+		err = a.sendClaimed(ctx, transfer)
+	} else {
+		err = fmt.Errorf("sem conexão com a API")
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if api.IsClientError(err) {
+			a.discardTransfer(transfer)
+			return fmt.Errorf("%w: %s: %w", errTransferRejected, summary.FileName, err)
+		}
+		log.Printf("Arquivo %s na fila de saída: %v", summary.FileName, err)
+		summary.Queued = true
+		return nil
+	}
+
+	log.Printf("Arquivo %s armazenado como versão %d (compressão %s, taxa %.2fx, padding %d bytes)",
+		summary.FileName, summary.Version, summary.Compression, summary.CompressionRatio, summary.PaddingOverhead)
+	return nil
+}
+
+// Decrypt recupera e descriptografa um arquivo usando um operation_id,
+// salvando o resultado no diretório padrão
+func (a *Agent) Decrypt(ctx context.Context, operationID string) (*types.DecryptResult, error) {
+	return a.DecryptTo(ctx, operationID, "")
 }
 
-// Decrypt recupera e descriptografa um arquivo usando um operation_id
-func (a *Agent) Decrypt(ctx context.Context, operationID string) (string, error) {
+// DecryptTo recupera e descriptografa um pacote no diretório destDir, sem
+// sobrescrever arquivos existentes. Pacotes de diretório são restaurados
+// como uma nova pasta dentro de destDir. Se destDir for vazio, usa o
+// diretório configurado ou a pasta Downloads.
+func (a *Agent) DecryptTo(ctx context.Context, operationID string, destDir string) (_ *types.DecryptResult, err error) {
 	// Timeout específico para decriptação
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
+	ctx, p := a.track(ctx, "decrypt", operationID)
+	defer p.finish(&err)
+
+	result, response, err := a.retrievePackage(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if destDir == "" {
+		destDir = a.defaultDecryptDir()
+	}
+
+	// Caminho completo do arquivo, sem sobrescrever arquivo existente
+	filePath := filepath.Join(destDir, packageFileName(result, response, operationID))
+	filePath = ensureUniqueFilePath(filePath)
+
+	skipped, err := writeDecrypted(ctx, result, filePath, a.config.RestorePolicy)
+	if err != nil {
+		return nil, err
+	}
+	return &types.DecryptResult{Path: filePath, SkippedAttributes: skipped}, nil
+}
+
+// DecryptToPath recupera e descriptografa um pacote exatamente em destPath,
+// normalmente escolhido pelo usuário em um diálogo de salvamento. Um arquivo
+// existente em destPath é substituído.
+func (a *Agent) DecryptToPath(ctx context.Context, operationID string, destPath string) (_ *types.DecryptResult, err error) {
+	if destPath == "" {
+		return nil, fmt.Errorf("caminho de destino não informado")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	ctx, p := a.track(ctx, "decrypt", operationID)
+	defer p.finish(&err)
+
+	result, _, err := a.retrievePackage(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped, err := writeDecrypted(ctx, result, destPath, a.config.RestorePolicy)
+	if err != nil {
+		return nil, err
+	}
+	return &types.DecryptResult{Path: destPath, SkippedAttributes: skipped}, nil
+}
+
+// Open recupera e descriptografa um pacote apenas em memória, para
+// visualização. O conteúdo decriptado nunca é gravado em disco: fica no
+// agente e é servido em partes em OpenedPathPrefix + ID até CloseOpened.
+// Pacotes de diretório não podem ser abertos dessa forma e são recusados
+// pelo cabeçalho, antes da descompressão.
+func (a *Agent) Open(ctx context.Context, operationID string) (_ *types.OpenedFile, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	ctx, p := a.track(ctx, "decrypt", operationID)
+	defer p.finish(&err)
+
+	header, body, response, err := a.fetchEnvelope(ctx, operationID)
+	if err == nil && header.Kind == PackageKindDirectory {
+		err = fmt.Errorf("pacotes de diretório não podem ser abertos em memória")
+	}
+	var result *DecryptionResult
+	if err == nil {
+		result, err = decompressEnvelope(header, body)
+	}
+	a.logDecrypt(operationID, response, err)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := packageFileName(result, response, operationID)
+	var mimeType string
+	if result.Header.Attributes != nil {
+		mimeType = result.Header.Attributes.MimeType
+	}
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(fileName))
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(result.DecryptedData)
+	}
+
+	id := a.opened.add(&openedFile{
+		fileName: fileName,
+		mimeType: mimeType,
+		openedAt: time.Now(),
+		data:     result.DecryptedData,
+	})
+	return &types.OpenedFile{
+		ID:       id,
+		FileName: fileName,
+		MimeType: mimeType,
+		Size:     int64(len(result.DecryptedData)),
+		URL:      OpenedPathPrefix + id,
+	}, nil
+}
+
+// retrievePackage baixa um pacote da API, verifica sua assinatura e o
+// descriptografa em memória, registrando o evento de segurança
+func (a *Agent) retrievePackage(ctx context.Context, operationID string) (*DecryptionResult, *types.DecryptResponse, error) {
+	result, response, err := a.fetchPackage(ctx, operationID)
+	a.logDecrypt(operationID, response, err)
+	return result, response, err
+}
+
+// logDecrypt registra no registro de segurança a decriptação de um pacote
+func (a *Agent) logDecrypt(operationID string, response *types.DecryptResponse, err error) {
+	event := types.SecurityEvent{OperationID: operationID}
+	if response != nil {
+		event.Target = response.FileName
+		if response.SignerUUID != "" {
+			event.Detail = "assinado por " + response.SignerUUID
+		}
+	}
+	a.logEvent(EventDecrypt, err, event)
+}
+
+func (a *Agent) fetchPackage(ctx context.Context, operationID string) (*DecryptionResult, *types.DecryptResponse, error) {
+	header, body, response, err := a.fetchEnvelope(ctx, operationID)
+	if err != nil {
+		return nil, response, err
+	}
+
+	result, err := decompressEnvelope(header, body)
+	if err != nil {
+		return nil, response, fmt.Errorf("erro na decriptação: %w", err)
+	}
+	return result, response, nil
+}
+
+// fetchEnvelope baixa um pacote, verifica sua assinatura e o decripta,
+// devolvendo o cabeçalho e o corpo ainda comprimido. A resposta da API é
+// devolvida mesmo em caso de erro, se já tiver sido recebida.
+func (a *Agent) fetchEnvelope(ctx context.Context, operationID string) (*PackageHeader, []byte, *types.DecryptResponse, error) {
 	// Verifica cancelamento
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
+		return nil, nil, nil, ctx.Err()
 	default:
-		// Headers para a requisição
-		header := map[string]string{
-			"X-Device-UUID": a.tpmMgr.DeviceUUID,
-		}
+	}
 
-		// Contexto específico para a requisição API
-		apiCtx, apiCancel := context.WithTimeout(ctx, 2*time.Minute)
-		defer apiCancel()
+	// Recupera os dados encriptados em partes, retomando um recebimento
+	// anterior se houver
+	log.Printf("Recuperando dados da operação: %s", operationID)
+	response, err := a.downloadChunked(ctx, operationID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("erro ao recuperar dados da API: %w", err)
+	}
 
-		// Faz a requisição para recuperar os dados encriptados
-		log.Printf("Recuperando dados da operação: %s", operationID)
-		response, err := a.client.DecryptRequest(apiCtx, http.MethodGet, "operations/retrieve_data/", header, operationID)
-		if err != nil {
-			return "", fmt.Errorf("erro ao recuperar dados da API: %w", err)
-		}
+	// Contexto específico para decriptação
+	decryptCtx, decryptCancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer decryptCancel()
 
-		// Contexto específico para decriptação
-		decryptCtx, decryptCancel := context.WithTimeout(ctx, 5*time.Minute)
-		defer decryptCancel()
+	signerKey, err := a.signerKey(decryptCtx, response.SignerUUID)
+	if err != nil {
+		return nil, nil, response, fmt.Errorf("erro ao obter chave do assinante: %w", err)
+	}
 
-		// Descriptografa os dados
-		log.Printf("Iniciando processo de decriptação")
-		result, err := DecryptFile(decryptCtx, response, a.tpmMgr)
-		if err != nil {
-			return "", fmt.Errorf("erro na decriptação: %w", err)
-		}
+	// Descriptografa os dados
+	log.Printf("Iniciando processo de decriptação")
+	header, body, err := decryptEnvelope(decryptCtx, response, a.tpmMgr, signerKey)
+	if err != nil {
+		return nil, nil, response, fmt.Errorf("erro na decriptação: %w", err)
+	}
+	return header, body, response, nil
+}
 
-		if !result.Verified {
-			return "", fmt.Errorf("falha na verificação da assinatura digital")
-		}
+// packageFileName retorna o nome original do conteúdo do pacote. Se o nome
+// não estiver disponível, usa um nome padrão.
+func packageFileName(result *DecryptionResult, response *types.DecryptResponse, operationID string) string {
+	fileName := filepath.Base(result.Header.FileName)
+	if result.Header.FileName == "" {
+		fileName = filepath.Base(response.FileName)
+	}
+	if response.FileName == "" && result.Header.FileName == "" ||
+		fileName == "." || fileName == string(filepath.Separator) {
+		fileName = fmt.Sprintf("decrypted_file_%s_%s",
+			operationID,
+			time.Now().Format("20060102_150405"))
+	}
+	return fileName
+}
 
-		// Obter caminho da pasta Downloads
-		downloadPath, err := getDownloadsPath()
-		if err != nil {
-			return "", fmt.Errorf("erro ao obter pasta de downloads: %w", err)
+// writeDecrypted grava o conteúdo decriptado em path, restaurando a árvore
+// no caso de pacotes de diretório e os metadados do arquivo original
+// conforme a política de restauração. Retorna os metadados que não puderam
+// ser restaurados.
+func writeDecrypted(ctx context.Context, result *DecryptionResult, path string, policy string) ([]string, error) {
+	if result.Header.Kind == PackageKindDirectory {
+		if result.Header.Archive != archiveFormatTar {
+			return nil, fmt.Errorf("formato de arquivo não suportado: %s", result.Header.Archive)
 		}
-
-		// Se o nome do arquivo não estiver disponível, usar um nome padrão
-		fileName := response.FileName
-		if fileName == "" {
-			fileName = fmt.Sprintf("decrypted_file_%s_%s",
-				operationID,
-				time.Now().Format("20060102_150405"))
+		progressFrom(ctx).setPhase(PhaseWrite, 0)
+		_, statErr := os.Lstat(path)
+		if err := extractArchive(ctx, bytes.NewReader(result.DecryptedData), path); err != nil {
+			// Interrompida (por cancelamento, por exemplo), a restauração
+			// não deixa uma árvore incompleta no lugar de uma que não existia
+			if os.IsNotExist(statErr) {
+				os.RemoveAll(path)
+			}
+			return nil, fmt.Errorf("erro ao restaurar diretório: %w", err)
 		}
 
-		// Caminho completo do arquivo
-		filePath := filepath.Join(downloadPath, fileName)
+		log.Printf("Diretório restaurado com sucesso em: %s", path)
+		return nil, nil
+	}
 
-		// Garantir que não sobrescreva arquivo existente
-		filePath = ensureUniqueFilePath(filePath)
+	// Salvar arquivo. O conteúdo vai para um temporário novo, criado com
+	// 0600 no mesmo diretório, que substitui o destino só depois de
+	// completo; gravar direto sobre um arquivo existente manteria as
+	// permissões dele.
+	p := progressFrom(ctx)
+	p.setPhase(PhaseWrite, int64(len(result.DecryptedData)))
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao salvar arquivo: %w", err)
+	}
+	_, err = tmp.Write(result.DecryptedData)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("erro ao salvar arquivo: %w", err)
+	}
+	p.add(int64(len(result.DecryptedData)))
 
-		// Salvar arquivo
-		err = os.WriteFile(filePath, result.DecryptedData, 0600)
-		if err != nil {
-			return "", fmt.Errorf("erro ao salvar arquivo: %w", err)
-		}
+	skipped, err := restoreAttributes(tmp.Name(), result.Header.Attributes, policy)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("erro ao restaurar metadados: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("erro ao salvar arquivo: %w", err)
+	}
 
-		log.Printf("Arquivo salvo com sucesso em: %s", filePath)
-		return filePath, nil
+	log.Printf("Arquivo salvo com sucesso em: %s", path)
+	return skipped, nil
+}
+
+// defaultDecryptDir retorna o diretório configurado para arquivos
+// decriptados, a pasta Downloads ou, na falta dela, a pasta home
+func (a *Agent) defaultDecryptDir() string {
+	if a.config.DecryptDir != "" {
+		return a.config.DecryptDir
+	}
+
+	downloadPath, err := getDownloadsPath()
+	if err == nil {
+		return downloadPath
+	}
+
+	log.Printf("Aviso: %v; usando a pasta home", err)
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "."
 	}
+	return homeDir
 }
 
 // getDownloadsPath retorna o caminho da pasta Downloads do usuário
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	// annotationKeyLabel deriva da chave do pacote a chave das anotações
+	annotationKeyLabel = "tpm-bunker-annotation-v1"
+
+	maxTags      = 32
+	maxTagLength = 64
+	maxNotesSize = 16 * 1024
+)
+
+// Níveis de classificação aceitos, do menos ao mais restrito
+var classificationLevels = []string{"public", "internal", "confidential", "secret"}
+
+// annotationDigest calcula o hash assinado de uma anotação. Ele liga o
+// conteúdo cifrado à operação, ao dispositivo e ao instante da edição.
+func annotationDigest(operationID string, record *api.AnnotationRecord) [32]byte {
+	sealedHash := sha256.Sum256([]byte(record.Sealed))
+	msg := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n", annotationKeyLabel, operationID, record.SignerUUID, record.SignedAt, hex.EncodeToString(sealedHash[:]))
+	return sha256.Sum256([]byte(msg))
+}
+
+// normalizeAnnotation valida a anotação e remove etiquetas vazias ou
+// repetidas
+func normalizeAnnotation(ann *types.Annotation) error {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range ann.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return fmt.Errorf("etiqueta muito longa: %s", tag)
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTags {
+		return fmt.Errorf("no máximo %d etiquetas por arquivo", maxTags)
+	}
+	ann.Tags = tags
+
+	if len(ann.Notes) > maxNotesSize {
+		return fmt.Errorf("notas excedem %d bytes", maxNotesSize)
+	}
+
+	ann.Classification = strings.ToLower(strings.TrimSpace(ann.Classification))
+	if ann.Classification != "" && !containsString(classificationLevels, ann.Classification) {
+		return fmt.Errorf("classificação inválida: %s", ann.Classification)
+	}
+	return nil
+}
+
+// SetAnnotation substitui as etiquetas, notas e classificação de um
+// pacote. A anotação é cifrada com a chave do pacote, de forma que apenas
+// dispositivos com acesso a ele possam lê-la, e assinada pelo TPM.
+func (a *Agent) SetAnnotation(ctx context.Context, operationID string, ann types.Annotation) (*types.Annotation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	if err := normalizeAnnotation(&ann); err != nil {
+		return nil, err
+	}
+	ann.UpdatedBy = a.tpmMgr.DeviceUUID
+	ann.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	symmetricKey, err := a.packageKey(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(symmetricKey)
+
+	plaintext, err := json.Marshal(ann)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar anotações: %w", err)
+	}
+	aead, err := labeledAEAD(symmetricKey, annotationKeyLabel)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar cifra de anotações: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("erro ao gerar nonce: %w", err)
+	}
+
+	record := &api.AnnotationRecord{
+		Sealed:     base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(operationID))),
+		SignerUUID: ann.UpdatedBy,
+		SignedAt:   ann.UpdatedAt,
+	}
+	digest := annotationDigest(operationID, record)
+	signature, err := a.tpmMgr.Client.SignData(ctx, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("erro ao assinar anotações: %w", err)
+	}
+	record.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	if err := a.client.SetAnnotation(ctx, a.deviceHeader(), operationID, record); err != nil {
+		return nil, err
+	}
+
+	a.operations.acceptAnnotation(operationID, ann.UpdatedAt)
+	if a.operations.annotate(operationID, &ann) {
+		if err := a.saveSearchIndex(ctx); err != nil {
+			log.Printf("Aviso: erro ao gravar índice de busca: %v", err)
+		}
+	}
+	return &ann, nil
+}
+
+// openAnnotation verifica a assinatura de uma anotação e a decifra. Só o
+// dono do pacote anota: dispositivos com quem ele foi compartilhado podem
+// lê-lo, mas não alterar suas etiquetas, notas e classificação.
+func (a *Agent) openAnnotation(ctx context.Context, operationID, ownerUUID string, record *api.AnnotationRecord, key func() ([]byte, error)) (*types.Annotation, error) {
+	if record.SignerUUID != ownerUUID {
+		return nil, fmt.Errorf("assinadas pelo dispositivo %s, que não é o dono do pacote", record.SignerUUID)
+	}
+	signature, err := base64.StdEncoding.DecodeString(record.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("assinatura mal formada")
+	}
+	signerKey, err := a.signerKey(ctx, record.SignerUUID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter chave do assinante: %w", err)
+	}
+	digest := annotationDigest(operationID, record)
+	if err := rsa.VerifyPKCS1v15(signerKey, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("assinatura digital inválida")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(record.Sealed)
+	if err != nil {
+		return nil, fmt.Errorf("anotações mal formadas: %w", err)
+	}
+	symmetricKey, err := key()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := labeledAEAD(symmetricKey, annotationKeyLabel)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("anotações truncadas")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(operationID))
+	if err != nil {
+		return nil, fmt.Errorf("anotações inválidas: %w", err)
+	}
+
+	var ann types.Annotation
+	if err := json.Unmarshal(plaintext, &ann); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar anotações: %w", err)
+	}
+	if ann.UpdatedBy != record.SignerUUID || ann.UpdatedAt != record.SignedAt {
+		return nil, fmt.Errorf("anotações não correspondem à assinatura")
+	}
+	return &ann, nil
+}
+
+// applyAnnotation copia a anotação para a operação
+func applyAnnotation(op *types.Operation, ann *types.Annotation) {
+	op.Tags = ann.Tags
+	op.Notes = ann.Notes
+	op.Classification = ann.Classification
+}
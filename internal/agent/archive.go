@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const archiveFormatTar = "tar"
+
+// archiveDirectory escreve em w um tar da árvore em root, preservando caminhos
+// relativos, permissões, datas de modificação e links simbólicos
+func archiveDirectory(ctx context.Context, root string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("erro ao calcular caminho relativo: %w", err)
+		}
+		if rel == "." {
+			return nil
+		}
+
+		// WalkDir não segue links simbólicos, então Info equivale a Lstat
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("erro ao ler informações de %s: %w", path, err)
+		}
+
+		var link string
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return fmt.Errorf("erro ao ler link simbólico %s: %w", path, err)
+			}
+		case !info.Mode().IsRegular() && !info.IsDir():
+			log.Printf("[Archive] Ignorando arquivo especial: %s", path)
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("erro ao criar cabeçalho tar para %s: %w", path, err)
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		// PAX preserva nomes longos e datas com precisão abaixo de segundos
+		hdr.Format = tar.FormatPAX
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("erro ao gravar cabeçalho tar: %w", err)
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("erro ao abrir %s: %w", path, err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("erro ao arquivar %s: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// extractArchive restaura em dest a árvore gravada por archiveDirectory.
+// Links simbólicos são criados somente ao final, para que nenhuma entrada
+// seja escrita através deles, e os diretórios recebem permissões e datas
+// depois de preenchidos.
+func extractArchive(ctx context.Context, r io.Reader, dest string) error {
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return fmt.Errorf("erro ao criar diretório de destino: %w", err)
+	}
+
+	type pending struct {
+		path    string
+		mode    fs.FileMode
+		modTime time.Time
+		link    string
+	}
+	var dirs, links []pending
+
+	tr := tar.NewReader(r)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("erro ao ler arquivo tar: %w", err)
+		}
+
+		target, err := archiveTarget(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := hdr.FileInfo().Mode().Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return fmt.Errorf("erro ao criar diretório %s: %w", target, err)
+			}
+			dirs = append(dirs, pending{path: target, mode: mode, modTime: hdr.ModTime})
+
+		case tar.TypeReg:
+			if err := extractRegularFile(tr, target, mode); err != nil {
+				return err
+			}
+			if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+				log.Printf("[Archive] Não foi possível restaurar data de %s: %v", target, err)
+			}
+
+		case tar.TypeSymlink:
+			links = append(links, pending{path: target, link: hdr.Linkname})
+
+		default:
+			log.Printf("[Archive] Ignorando entrada não suportada: %s", hdr.Name)
+		}
+	}
+
+	for _, l := range links {
+		if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+			return fmt.Errorf("erro ao criar diretório %s: %w", filepath.Dir(l.path), err)
+		}
+		if err := os.Symlink(l.link, l.path); err != nil {
+			log.Printf("[Archive] Não foi possível criar link simbólico %s: %v", l.path, err)
+		}
+	}
+
+	// Ordem inversa: subdiretórios antes dos pais
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if err := os.Chmod(d.path, d.mode); err != nil {
+			log.Printf("[Archive] Não foi possível restaurar permissões de %s: %v", d.path, err)
+		}
+		if err := os.Chtimes(d.path, d.modTime, d.modTime); err != nil {
+			log.Printf("[Archive] Não foi possível restaurar data de %s: %v", d.path, err)
+		}
+	}
+
+	return nil
+}
+
+// archiveTarget resolve o caminho de uma entrada dentro de dest, rejeitando
+// caminhos absolutos ou que escapem do destino
+func archiveTarget(dest, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("caminho inválido no arquivo: %s", name)
+	}
+	return filepath.Join(dest, clean), nil
+}
+
+func extractRegularFile(r io.Reader, target string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return fmt.Errorf("erro ao criar diretório %s: %w", filepath.Dir(target), err)
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("erro ao criar %s: %w", target, err)
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("erro ao extrair %s: %w", target, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("erro ao fechar %s: %w", target, err)
+	}
+
+	return os.Chmod(target, mode)
+}
@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestArchiveTarget(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "dest")
+
+	tests := []struct {
+		name    string
+		entry   string
+		want    string
+		wantErr bool
+	}{
+		{name: "arquivo", entry: "a.txt", want: "a.txt"},
+		{name: "subdiretório", entry: "a/b/c.txt", want: "a/b/c.txt"},
+		{name: "diretório", entry: "a/b/", want: "a/b"},
+		{name: "ponto interno", entry: "a/./b", want: "a/b"},
+		{name: "volta dentro do destino", entry: "a/../b", want: "b"},
+		{name: "pai", entry: "..", wantErr: true},
+		{name: "escapa pelo pai", entry: "../x", wantErr: true},
+		{name: "escapa após subir", entry: "a/../../x", wantErr: true},
+		{name: "absoluto", entry: "/etc/passwd", wantErr: true},
+		{name: "nome com pontos", entry: "..a/b", want: "..a/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := archiveTarget(dest, tt.entry)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("archiveTarget(%q) = %q, esperado erro", tt.entry, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("archiveTarget(%q): %v", tt.entry, err)
+			}
+			if want := filepath.Join(dest, filepath.FromSlash(tt.want)); got != want {
+				t.Fatalf("archiveTarget(%q) = %q, esperado %q", tt.entry, got, want)
+			}
+		})
+	}
+}
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	link     string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Mode:     0644,
+			Size:     int64(len(e.body)),
+			Linkname: e.link,
+		}
+		if e.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtractArchive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("links simbólicos exigem privilégios no Windows")
+	}
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		wantErr bool
+		// Arquivos esperados no destino, relativos a ele
+		files map[string]string
+		// Caminhos, relativos ao diretório pai do destino, que não podem
+		// existir depois da extração
+		absent []string
+	}{
+		{
+			name: "árvore comum",
+			entries: []tarEntry{
+				{name: "docs/", typeflag: tar.TypeDir},
+				{name: "docs/a.txt", typeflag: tar.TypeReg, body: "a"},
+				{name: "b.txt", typeflag: tar.TypeReg, body: "b"},
+			},
+			files: map[string]string{"docs/a.txt": "a", "b.txt": "b"},
+		},
+		{
+			name: "entrada com ..",
+			entries: []tarEntry{
+				{name: "../fora.txt", typeflag: tar.TypeReg, body: "x"},
+			},
+			wantErr: true,
+			absent:  []string{"fora.txt"},
+		},
+		{
+			name: "entrada absoluta",
+			entries: []tarEntry{
+				{name: "/fora.txt", typeflag: tar.TypeReg, body: "x"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "escrita através de link simbólico",
+			entries: []tarEntry{
+				{name: "link", typeflag: tar.TypeSymlink, link: ".."},
+				{name: "link/fora.txt", typeflag: tar.TypeReg, body: "x"},
+			},
+			// O link só seria criado ao final; o arquivo fica dentro do
+			// destino, em um diretório comum
+			files:  map[string]string{"link/fora.txt": "x"},
+			absent: []string{"fora.txt"},
+		},
+		{
+			name: "arquivo repetido",
+			entries: []tarEntry{
+				{name: "a.txt", typeflag: tar.TypeReg, body: "a"},
+				{name: "a.txt", typeflag: tar.TypeReg, body: "b"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "dest")
+
+			err := extractArchive(context.Background(), buildTar(t, tt.entries), dest)
+			if tt.wantErr && err == nil {
+				t.Fatal("esperado erro")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("extractArchive: %v", err)
+			}
+
+			for rel, want := range tt.files {
+				got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel)))
+				if err != nil {
+					t.Fatalf("%s: %v", rel, err)
+				}
+				if string(got) != want {
+					t.Fatalf("%s = %q, esperado %q", rel, got, want)
+				}
+			}
+			for _, rel := range tt.absent {
+				if _, err := os.Lstat(filepath.Join(parent, rel)); !os.IsNotExist(err) {
+					t.Fatalf("%s criado fora do destino", rel)
+				}
+			}
+		})
+	}
+}
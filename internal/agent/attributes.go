@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Políticas para atributos que não podem ser restaurados na plataforma atual
+const (
+	// RestoreBestEffort restaura o que for possível e registra o restante
+	RestoreBestEffort = "best_effort"
+	// RestoreStrict falha a decriptação se algum atributo suportado pela
+	// plataforma não puder ser restaurado. Atributos sem suporte na
+	// plataforma, como a data de criação no Linux, são apenas registrados.
+	RestoreStrict = "strict"
+	// RestoreNone não restaura nenhum atributo
+	RestoreNone = "none"
+)
+
+// errAttributeUnsupported indica um atributo que a plataforma não permite
+// restaurar
+var errAttributeUnsupported = errors.New("não suportado nesta plataforma")
+
+// errAttributeNotAllowed indica um atributo que nunca é restaurado de um
+// pacote, que pode ter sido assinado por outro dispositivo
+var errAttributeNotAllowed = errors.New("não permitido na restauração")
+
+// restorableXattr informa se um atributo estendido pode ser restaurado.
+// Apenas o espaço user.* é aceito: security.* e trusted.* alteram
+// rótulos e capacidades do arquivo.
+func restorableXattr(name string) bool {
+	return strings.HasPrefix(name, "user.")
+}
+
+// FileAttributes são os metadados do arquivo original. Eles viajam no
+// cabeçalho do pacote, cifrados junto com o conteúdo.
+type FileAttributes struct {
+	Mode       fs.FileMode       `json:"mode"`
+	Size       int64             `json:"size"`
+	MimeType   string            `json:"mime_type,omitempty"`
+	ModTime    time.Time         `json:"mod_time"`
+	AccessTime *time.Time        `json:"access_time,omitempty"`
+	BirthTime  *time.Time        `json:"birth_time,omitempty"`
+	Xattrs     map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// captureAttributes lê os metadados de um arquivo. data é uma amostra do
+// início do conteúdo, usada para detectar o tipo MIME.
+func captureAttributes(path string, data []byte) (*FileAttributes, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler informações de %s: %w", path, err)
+	}
+
+	attrs := &FileAttributes{
+		Mode:     info.Mode().Perm() | info.Mode()&(fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky),
+		Size:     info.Size(),
+		MimeType: mime.TypeByExtension(filepath.Ext(path)),
+		ModTime:  info.ModTime(),
+	}
+	if attrs.MimeType == "" {
+		attrs.MimeType = http.DetectContentType(data)
+	}
+
+	attrs.AccessTime, attrs.BirthTime, err = fileTimes(path)
+	if err != nil {
+		log.Printf("[Attributes] Não foi possível ler datas de %s: %v", path, err)
+	}
+
+	attrs.Xattrs, err = readXattrs(path)
+	if err != nil {
+		log.Printf("[Attributes] Não foi possível ler atributos estendidos de %s: %v", path, err)
+	}
+
+	return attrs, nil
+}
+
+// restoreAttributes aplica os metadados ao arquivo em path conforme a
+// política e retorna os atributos que não puderam ser restaurados
+func restoreAttributes(path string, attrs *FileAttributes, policy string) ([]string, error) {
+	if attrs == nil || policy == RestoreNone {
+		return nil, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != attrs.Size {
+		return nil, fmt.Errorf("tamanho restaurado (%d) difere do original (%d)", info.Size(), attrs.Size)
+	}
+
+	var skipped, failed []string
+	record := func(attr string, err error) {
+		msg := fmt.Sprintf("%s: %v", attr, err)
+		skipped = append(skipped, msg)
+		if !errors.Is(err, errAttributeUnsupported) && !errors.Is(err, errAttributeNotAllowed) {
+			failed = append(failed, msg)
+		}
+	}
+
+	// Atributos estendidos vêm antes das permissões, que podem tornar o
+	// arquivo somente leitura
+	names := make([]string, 0, len(attrs.Xattrs))
+	for name := range attrs.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !restorableXattr(name) {
+			record("xattr "+name, errAttributeNotAllowed)
+			continue
+		}
+		if err := writeXattr(path, name, attrs.Xattrs[name]); err != nil {
+			record("xattr "+name, err)
+		}
+	}
+
+	// Setuid, setgid e sticky não são restaurados: um pacote de outro
+	// dispositivo entregaria um executável setuid
+	if err := os.Chmod(path, attrs.Mode.Perm()); err != nil {
+		record("permissões", err)
+	}
+
+	atime := attrs.ModTime
+	if attrs.AccessTime != nil {
+		atime = *attrs.AccessTime
+	}
+	if err := os.Chtimes(path, atime, attrs.ModTime); err != nil {
+		record("datas", err)
+	}
+
+	if attrs.BirthTime != nil {
+		if err := setBirthTime(path, *attrs.BirthTime); err != nil {
+			record("data de criação", err)
+		}
+	}
+
+	if len(failed) > 0 && policy == RestoreStrict {
+		return skipped, fmt.Errorf("atributos não restaurados: %v", failed)
+	}
+	for _, s := range skipped {
+		log.Printf("[Attributes] %s: atributo não restaurado: %s", path, s)
+	}
+	return skipped, nil
+}
@@ -0,0 +1,26 @@
+//go:build darwin
+
+package agent
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileTimes retorna as datas de acesso e de criação de path
+func fileTimes(path string) (*time.Time, *time.Time, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return nil, nil, err
+	}
+
+	atime := time.Unix(st.Atim.Unix())
+	btime := time.Unix(st.Btim.Unix())
+	return &atime, &btime, nil
+}
+
+// setBirthTime não é suportado: alterar a data de criação exige setattrlist
+func setBirthTime(path string, t time.Time) error {
+	return errAttributeUnsupported
+}
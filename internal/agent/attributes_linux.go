@@ -0,0 +1,36 @@
+//go:build linux
+
+package agent
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileTimes retorna as datas de acesso e de criação de path. A data de
+// criação só está disponível em kernels e sistemas de arquivos com statx.
+func fileTimes(path string) (*time.Time, *time.Time, error) {
+	var st unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, path, 0, unix.STATX_ATIME|unix.STATX_BTIME, &st)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var atime, btime *time.Time
+	if st.Mask&unix.STATX_ATIME != 0 {
+		t := time.Unix(st.Atime.Sec, int64(st.Atime.Nsec))
+		atime = &t
+	}
+	if st.Mask&unix.STATX_BTIME != 0 {
+		t := time.Unix(st.Btime.Sec, int64(st.Btime.Nsec))
+		btime = &t
+	}
+	return atime, btime, nil
+}
+
+// setBirthTime não é suportado no Linux: a data de criação é definida pelo
+// kernel
+func setBirthTime(path string, t time.Time) error {
+	return errAttributeUnsupported
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !windows
+
+package agent
+
+import "time"
+
+// fileTimes não consegue ler datas além da modificação nesta plataforma
+func fileTimes(path string) (*time.Time, *time.Time, error) {
+	return nil, nil, nil
+}
+
+// readXattrs não lê atributos estendidos nesta plataforma
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func writeXattr(path, name string, value []byte) error {
+	return errAttributeUnsupported
+}
+
+func setBirthTime(path string, t time.Time) error {
+	return errAttributeUnsupported
+}
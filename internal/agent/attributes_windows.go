@@ -0,0 +1,53 @@
+//go:build windows
+
+package agent
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes retorna as datas de acesso e de criação de path
+func fileTimes(path string) (*time.Time, *time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	atime := time.Unix(0, data.LastAccessTime.Nanoseconds())
+	btime := time.Unix(0, data.CreationTime.Nanoseconds())
+	return &atime, &btime, nil
+}
+
+// setBirthTime altera a data de criação de path
+func setBirthTime(path string, t time.Time) error {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	h, err := syscall.CreateFile(name, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+
+	ctime := syscall.NsecToFiletime(t.UnixNano())
+	return syscall.SetFileTime(h, &ctime, nil, nil)
+}
+
+// readXattrs não lê atributos estendidos no Windows
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func writeXattr(path, name string, value []byte) error {
+	return errAttributeUnsupported
+}
@@ -0,0 +1,556 @@
+package agent
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// AuditProgressEvent é o evento com o relatório parcial de uma auditoria
+	AuditProgressEvent = "audit_progress"
+
+	auditFileName = "audit.json"
+
+	// auditCheckInterval é o intervalo entre verificações da auditoria
+	// automática
+	auditCheckInterval = time.Hour
+)
+
+// Modos de auditoria
+const (
+	AuditQuick = "quick"
+	AuditFull  = "full"
+)
+
+// Estados de um pacote auditado
+const (
+	AuditOK        = "ok"
+	AuditCorrupted = "corrupted"
+	AuditMissing   = "missing"
+	AuditError     = "error"
+)
+
+// auditState é o estado gravado em audit.json: o relatório da última
+// auditoria e quando uma auditoria chegou ao fim pela última vez
+type auditState struct {
+	LastCompleted string             `json:"last_completed,omitempty"`
+	Report        *types.AuditReport `json:"report,omitempty"`
+}
+
+// auditor guarda a auditoria em andamento; só uma roda de cada vez
+type auditor struct {
+	wakeup chan struct{}
+
+	mutex   sync.Mutex
+	current *types.AuditReport
+}
+
+func newAuditor() *auditor {
+	return &auditor{wakeup: make(chan struct{}, 1)}
+}
+
+// wake pede uma verificação imediata da auditoria automática
+func (au *auditor) wake() {
+	select {
+	case au.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (au *auditor) start(report *types.AuditReport) bool {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+	if au.current != nil {
+		return false
+	}
+	au.current = report
+	return true
+}
+
+func (au *auditor) finish() {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+	au.current = nil
+}
+
+// update altera o relatório em andamento e retorna uma cópia
+func (au *auditor) update(report *types.AuditReport, fn func(*types.AuditReport)) types.AuditReport {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+	fn(report)
+	c := *report
+	c.Results = append([]types.AuditResult(nil), report.Results...)
+	return c
+}
+
+func (au *auditor) snapshot() *types.AuditReport {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+	if au.current == nil {
+		return nil
+	}
+	c := *au.current
+	c.Results = append([]types.AuditResult(nil), au.current.Results...)
+	return &c
+}
+
+func auditStatePath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, auditFileName), nil
+}
+
+func loadAuditState() *auditState {
+	state := &auditState{}
+	path, err := auditStatePath()
+	if err != nil {
+		return state
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Aviso: erro ao ler estado da auditoria: %v", err)
+		}
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		log.Printf("Aviso: estado da auditoria inválido: %v", err)
+	}
+	return state
+}
+
+func saveAuditState(state *auditState) {
+	path, err := auditStatePath()
+	if err != nil {
+		log.Printf("Aviso: estado da auditoria não gravado: %v", err)
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Printf("Aviso: erro ao serializar estado da auditoria: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("Aviso: erro ao gravar estado da auditoria: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("Aviso: erro ao gravar estado da auditoria: %v", err)
+	}
+}
+
+// auditStatus classifica o resultado da verificação de um pacote. Apenas
+// falhas de assinatura ou de digest contam como corrupção; falhas de rede
+// ou de decriptação não dizem nada sobre o pacote.
+func auditStatus(err error) string {
+	var corrupt base64.CorruptInputError
+	switch {
+	case err == nil:
+		return AuditOK
+	case errors.Is(err, rsa.ErrVerification), errors.Is(err, errDigestMismatch), errors.As(err, &corrupt):
+		return AuditCorrupted
+	case errors.Is(err, errPackageNotFound):
+		return AuditMissing
+	default:
+		return AuditError
+	}
+}
+
+// AuditReport retorna o relatório da auditoria em andamento ou, se não
+// houver, o da última auditoria
+func (a *Agent) AuditReport() *types.AuditReport {
+	if current := a.audits.snapshot(); current != nil {
+		return current
+	}
+	return loadAuditState().Report
+}
+
+// StartAudit inicia em segundo plano uma auditoria de integridade de todos
+// os pacotes deste dispositivo. O andamento é publicado em eventos. Se mode
+// for vazio, usa o modo da configuração.
+func (a *Agent) StartAudit(ctx context.Context, mode string) (*types.AuditReport, error) {
+	if mode == "" {
+		mode = a.config.AuditMode
+	}
+	if mode != AuditQuick && mode != AuditFull {
+		return nil, fmt.Errorf("modo de auditoria desconhecido: %s", mode)
+	}
+
+	report := newAuditReport(mode)
+	if !a.audits.start(report) {
+		return nil, fmt.Errorf("já há uma auditoria em andamento")
+	}
+	c := *report
+	go a.runAudit(ctx, report)
+	return &c, nil
+}
+
+// CancelAudit cancela a auditoria em andamento
+func (a *Agent) CancelAudit(auditID string) error {
+	if !a.running.cancel(auditID) {
+		return fmt.Errorf("auditoria não encontrada: %s", auditID)
+	}
+	return nil
+}
+
+func newAuditReport(mode string) *types.AuditReport {
+	return &types.AuditReport{
+		AuditID:   uuid.NewString(),
+		Mode:      mode,
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+		Running:   true,
+	}
+}
+
+// runAudits é o worker da auditoria automática
+func (a *Agent) runAudits(ctx context.Context) {
+	ticker := time.NewTicker(auditCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		a.runDueAudit(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.audits.wakeup:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueAudit audita os pacotes se a última auditoria concluída for mais
+// antiga que o intervalo da configuração
+func (a *Agent) runDueAudit(ctx context.Context) {
+	interval := time.Duration(a.config.AuditIntervalHours) * time.Hour
+	if interval <= 0 {
+		return
+	}
+	if deviceUUID, _ := a.tpmMgr.GetDeviceUUID(ctx); deviceUUID == "" {
+		return
+	}
+	if last, err := time.Parse(time.RFC3339, loadAuditState().LastCompleted); err == nil && time.Since(last) < interval {
+		return
+	}
+	// Sem sessão ou sem conexão, a auditoria espera em vez de substituir o
+	// último relatório por um que não verificou nada
+	if err := a.syncOperations(ctx); err != nil {
+		return
+	}
+
+	mode := a.config.AuditMode
+	if mode != AuditFull {
+		mode = AuditQuick
+	}
+	report := newAuditReport(mode)
+	if !a.audits.start(report) {
+		return
+	}
+	a.runAudit(ctx, report)
+}
+
+// auditTarget é um pacote a auditar. Pacotes do histórico local ausentes
+// da listagem do servidor não são consultados: já se sabe que faltam.
+type auditTarget struct {
+	operationID string
+	fileName    string
+	listed      bool
+}
+
+// auditTargets reúne os pacotes armazenados segundo o servidor e os que
+// este dispositivo registrou no histórico de versões
+func (a *Agent) auditTargets() []auditTarget {
+	targets := make(map[string]*auditTarget)
+	for _, op := range a.operations.snapshot() {
+		if op.OperationType != "STORE" || op.Status != "COMPLETED" {
+			continue
+		}
+		targets[op.ID] = &auditTarget{operationID: op.ID, fileName: op.FileName, listed: true}
+	}
+	for _, f := range a.versions.list() {
+		for _, v := range f.Versions {
+			if _, ok := targets[v.OperationID]; !ok && v.OperationID != "" {
+				targets[v.OperationID] = &auditTarget{operationID: v.OperationID, fileName: v.FileName}
+			}
+		}
+	}
+
+	result := make([]auditTarget, 0, len(targets))
+	for _, t := range targets {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].operationID < result[j].operationID })
+	return result
+}
+
+// runAudit executa uma auditoria já marcada como em andamento
+func (a *Agent) runAudit(ctx context.Context, report *types.AuditReport) {
+	defer a.audits.finish()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.running.add(report.AuditID, cancel)
+	defer a.running.done(report.AuditID)
+
+	var lastEmit time.Time
+	publish := func(force bool, fn func(*types.AuditReport)) {
+		snapshot := a.audits.update(report, fn)
+		if force || time.Since(lastEmit) >= progressInterval {
+			lastEmit = time.Now()
+			a.emit(AuditProgressEvent, snapshot)
+		}
+	}
+	publish(true, func(*types.AuditReport) {})
+	log.Printf("Auditoria de integridade iniciada (%s)", report.Mode)
+
+	// Sem a listagem atualizada um pacote removido do servidor pareceria
+	// apenas ausente do cache
+	syncErr := a.syncOperations(ctx)
+	if syncErr != nil {
+		publish(true, func(r *types.AuditReport) { r.Error = "erro ao listar pacotes: " + syncErr.Error() })
+	} else {
+		targets := a.auditTargets()
+		publish(true, func(r *types.AuditReport) { r.Total = len(targets) })
+
+		for _, target := range targets {
+			if ctx.Err() != nil {
+				break
+			}
+			result := a.auditPackage(ctx, target, report.Mode)
+			if ctx.Err() != nil {
+				break
+			}
+			if result.Status != AuditOK {
+				result.LocalPath, _ = a.localCopy(result.OperationID)
+				log.Printf("Auditoria: pacote %s (%s): %s %s", result.OperationID, result.FileName, result.Status, result.Error)
+			}
+
+			publish(false, func(r *types.AuditReport) {
+				r.Checked++
+				switch result.Status {
+				case AuditOK:
+					r.Passed++
+				case AuditCorrupted:
+					r.Corrupted++
+				case AuditMissing:
+					r.Missing++
+				default:
+					r.Errors++
+				}
+				if result.Status != AuditOK {
+					r.Results = append(r.Results, result)
+				}
+			})
+		}
+	}
+
+	final := a.audits.update(report, func(r *types.AuditReport) {
+		r.Running = false
+		r.Cancelled = ctx.Err() != nil
+		r.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	})
+
+	state := loadAuditState()
+	state.Report = &final
+	if !final.Cancelled && syncErr == nil {
+		state.LastCompleted = final.FinishedAt
+	}
+	saveAuditState(state)
+
+	a.emit(AuditProgressEvent, final)
+	log.Printf("Auditoria de integridade concluída: %d verificados, %d íntegros, %d corrompidos, %d ausentes, %d erros",
+		final.Checked, final.Passed, final.Corrupted, final.Missing, final.Errors)
+}
+
+// auditPackage verifica um pacote. No modo rápido usa o digest calculado
+// pelo servidor sobre o conteúdo armazenado, verificando a assinatura do
+// TPM sobre ele; se o servidor não o oferecer, ou no modo completo, baixa o
+// pacote e verifica a assinatura sobre o que foi recebido.
+func (a *Agent) auditPackage(ctx context.Context, target auditTarget, mode string) types.AuditResult {
+	result := types.AuditResult{OperationID: target.operationID, FileName: target.fileName}
+	if !target.listed {
+		result.Status = AuditMissing
+		result.Error = "pacote registrado neste dispositivo, mas ausente do servidor"
+		return result
+	}
+
+	if mode == AuditQuick {
+		handled, err := a.auditByDigest(ctx, target.operationID)
+		if handled {
+			result.Method = "digest"
+			result.Status = auditStatus(err)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			return result
+		}
+	}
+
+	result.Method = "download"
+	err := a.auditByDownload(ctx, target.operationID)
+	result.Status = auditStatus(err)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// auditByDigest verifica a assinatura do pacote sobre o digest que o
+// servidor calcula do conteúdo armazenado. Retorna falso se o servidor não
+// oferece o manifesto ou o digest e o pacote precisa ser baixado; um 404
+// dessas rotas não distingue rota ausente de pacote ausente, e só o
+// download aponta o pacote como ausente. Detecta corrupção do
+// armazenamento, mas confia no servidor: só o download prova o conteúdo.
+func (a *Agent) auditByDigest(ctx context.Context, operationID string) (bool, error) {
+	header := a.deviceHeader()
+
+	manifest, err := a.client.GetManifest(ctx, header, operationID)
+	if err != nil {
+		return false, nil
+	}
+	stored, err := a.client.GetStoredDigest(ctx, header, operationID)
+	if err != nil {
+		return false, nil
+	}
+	digest, err := hex.DecodeString(stored.Digest)
+	if err != nil || len(digest) != 32 {
+		return false, nil
+	}
+
+	if stored.Size != manifest.Size {
+		return true, fmt.Errorf("armazenados %d bytes de %d enviados: %w", stored.Size, manifest.Size, errDigestMismatch)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(manifest.DigitalSignature)
+	if err != nil {
+		return true, fmt.Errorf("erro ao decodificar assinatura: %w", err)
+	}
+	signerKey, err := a.signerKey(ctx, manifest.DeviceUUID)
+	if err != nil {
+		return true, fmt.Errorf("erro ao obter chave do assinante: %w", err)
+	}
+	if err := rsa.VerifyPKCS1v15(signerKey, crypto.SHA256, digest, signature); err != nil {
+		return true, fmt.Errorf("assinatura digital inválida: %w", err)
+	}
+	return true, nil
+}
+
+// auditByDownload baixa o pacote e verifica a assinatura do TPM sobre o
+// conteúdo recebido. O pacote não é decriptado: a auditoria não abre a
+// chave no TPM, não materializa o conteúdo e não registra decriptações no
+// registro de segurança.
+func (a *Agent) auditByDownload(ctx context.Context, operationID string) error {
+	response, err := a.downloadChunked(ctx, operationID)
+	if err != nil {
+		return fmt.Errorf("erro ao recuperar dados da API: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(response.DigitalSignature)
+	if err != nil {
+		return fmt.Errorf("erro ao decodificar assinatura: %w", err)
+	}
+	signerKey, err := a.signerKey(ctx, response.SignerUUID)
+	if err != nil {
+		return fmt.Errorf("erro ao obter chave do assinante: %w", err)
+	}
+	digest := sha256.Sum256(response.EncryptedData)
+	if err := rsa.VerifyPKCS1v15(signerKey, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("assinatura digital inválida: %w", err)
+	}
+	return nil
+}
+
+// localCopy retorna o arquivo local do qual um pacote pode ser reenviado: o
+// pacote precisa ser a versão mais recente do arquivo, e o arquivo não pode
+// ter mudado desde o envio
+func (a *Agent) localCopy(operationID string) (string, bool) {
+	for _, f := range a.versions.list() {
+		if len(f.Versions) == 0 {
+			continue
+		}
+		latest := f.Versions[len(f.Versions)-1]
+		if latest.OperationID != operationID {
+			continue
+		}
+
+		info, err := os.Stat(f.Path)
+		if err != nil || !info.Mode().IsRegular() {
+			return "", false
+		}
+		created, err := time.Parse(time.RFC3339, latest.CreatedAt)
+		if err != nil || info.Size() != latest.Size || info.ModTime().After(created) {
+			return "", false
+		}
+		return f.Path, true
+	}
+	return "", false
+}
+
+// RepairPackage reenvia da cópia local um pacote que a última auditoria
+// apontou como corrompido ou ausente. O pacote danificado é removido antes,
+// para que a deduplicação não o reaproveite; o reenvio vira uma nova versão
+// do arquivo, encriptada para os destinatários padrão atuais.
+func (a *Agent) RepairPackage(ctx context.Context, operationID string) (*types.EncryptionSummary, error) {
+	if a.audits.snapshot() != nil {
+		return nil, fmt.Errorf("aguarde o fim da auditoria em andamento")
+	}
+
+	state := loadAuditState()
+	var found *types.AuditResult
+	if state.Report != nil {
+		for i := range state.Report.Results {
+			if state.Report.Results[i].OperationID == operationID {
+				found = &state.Report.Results[i]
+			}
+		}
+	}
+	if found == nil || (found.Status != AuditCorrupted && found.Status != AuditMissing) {
+		return nil, fmt.Errorf("a última auditoria não apontou problema no pacote %s", operationID)
+	}
+	if found.Repaired {
+		return nil, fmt.Errorf("o pacote %s já foi reenviado", operationID)
+	}
+
+	path, ok := a.localCopy(operationID)
+	if !ok {
+		return nil, fmt.Errorf("não há cópia local inalterada do pacote %s", operationID)
+	}
+
+	if err := a.Delete(ctx, operationID); err != nil {
+		// Um pacote corrompido ainda existe e precisa sair antes do reenvio
+		if found.Status == AuditCorrupted {
+			return nil, fmt.Errorf("erro ao remover o pacote corrompido: %w", err)
+		}
+		a.forgetOperation(operationID)
+	}
+
+	summary, err := a.Encrypt(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao reenviar %s: %w", path, err)
+	}
+
+	found.Repaired = true
+	saveAuditState(state)
+	log.Printf("Pacote %s reenviado a partir de %s", operationID, path)
+	return summary, nil
+}
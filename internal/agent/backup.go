@@ -0,0 +1,627 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// BackupReportEvent é o evento com o relatório de uma execução de
+	// backup, publicado no início, a cada arquivo enviado e no fim
+	BackupReportEvent = "backup_report"
+
+	backupDirName = "backups"
+
+	// backupCheckInterval é o intervalo entre verificações dos horários
+	backupCheckInterval = time.Minute
+
+	// Execuções iniciadas mais de catchUpGrace depois do horário são
+	// registradas como recuperação de uma execução perdida
+	catchUpGrace = 5 * time.Minute
+
+	defaultBackupTime = "02:00"
+	maxBackupReports  = 30
+	maxBackupErrors   = 100
+)
+
+// Gatilhos de uma execução de backup
+const (
+	BackupScheduled = "scheduled"
+	BackupCatchUp   = "catch_up"
+	BackupManual    = "manual"
+)
+
+// backupEntry é o estado de um arquivo na última execução que o enviou.
+// Com TransferID, o pacote ainda está na fila de saída e o arquivo só
+// conta como enviado quando a fila confirmar o envio.
+type backupEntry struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	FileID      string    `json:"file_id,omitempty"`
+	Version     int       `json:"version,omitempty"`
+	OperationID string    `json:"operation_id,omitempty"`
+	TransferID  string    `json:"transfer_id,omitempty"`
+}
+
+// backupState é o estado de um job, gravado em backups/<id>.json: o
+// manifesto dos arquivos já enviados, que torna as execuções incrementais,
+// e os relatórios das últimas execuções
+type backupState struct {
+	LastRun  string                  `json:"last_run,omitempty"`
+	Manifest map[string]*backupEntry `json:"manifest"`
+	Reports  []types.BackupReport    `json:"reports"`
+}
+
+// backupScheduler guarda os jobs em execução. Um job nunca roda duas vezes
+// ao mesmo tempo.
+type backupScheduler struct {
+	wakeup chan struct{}
+
+	mutex   sync.Mutex
+	current map[string]*types.BackupReport
+}
+
+func newBackupScheduler() *backupScheduler {
+	return &backupScheduler{
+		wakeup:  make(chan struct{}, 1),
+		current: make(map[string]*types.BackupReport),
+	}
+}
+
+// wake pede uma verificação imediata dos horários
+func (s *backupScheduler) wake() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// start marca o job como em execução; falso se ele já estava
+func (s *backupScheduler) start(jobID string, report *types.BackupReport) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.current[jobID]; ok {
+		return false
+	}
+	s.current[jobID] = report
+	return true
+}
+
+func (s *backupScheduler) finish(jobID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.current, jobID)
+}
+
+// snapshot retorna uma cópia do relatório da execução em andamento do job
+func (s *backupScheduler) snapshot(jobID string) *types.BackupReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	report, ok := s.current[jobID]
+	if !ok {
+		return nil
+	}
+	c := *report
+	c.Errors = append([]types.BackupFileError(nil), report.Errors...)
+	return &c
+}
+
+// update altera o relatório em andamento e retorna uma cópia
+func (s *backupScheduler) update(report *types.BackupReport, fn func(*types.BackupReport)) types.BackupReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fn(report)
+	c := *report
+	c.Errors = append([]types.BackupFileError(nil), report.Errors...)
+	return c
+}
+
+func backupStatePath(jobID string) (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, backupDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("erro ao criar diretório de backups: %w", err)
+	}
+	return filepath.Join(dir, jobID+".json"), nil
+}
+
+// loadBackupState lê o estado de um job; um job sem estado começa vazio
+func loadBackupState(jobID string) *backupState {
+	state := &backupState{Manifest: make(map[string]*backupEntry)}
+
+	path, err := backupStatePath(jobID)
+	if err != nil {
+		log.Printf("Aviso: estado do backup %s indisponível: %v", jobID, err)
+		return state
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Aviso: erro ao ler estado do backup %s: %v", jobID, err)
+		}
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		log.Printf("Aviso: estado do backup %s inválido: %v", jobID, err)
+	}
+	if state.Manifest == nil {
+		state.Manifest = make(map[string]*backupEntry)
+	}
+	return state
+}
+
+func saveBackupState(jobID string, state *backupState) {
+	path, err := backupStatePath(jobID)
+	if err != nil {
+		log.Printf("Aviso: estado do backup %s não gravado: %v", jobID, err)
+		return
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("Aviso: erro ao serializar estado do backup %s: %v", jobID, err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("Aviso: erro ao gravar estado do backup %s: %v", jobID, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("Aviso: erro ao gravar estado do backup %s: %v", jobID, err)
+	}
+}
+
+// nextBackupRun retorna o primeiro horário agendado do job depois de after
+func nextBackupRun(job types.BackupJob, after time.Time) (time.Time, error) {
+	clock, err := time.Parse("15:04", job.Time)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("horário inválido: %s", job.Time)
+	}
+
+	allowed := make(map[time.Weekday]bool)
+	for _, d := range job.Weekdays {
+		allowed[time.Weekday(d)] = true
+	}
+
+	after = after.In(time.Local)
+	day := time.Date(after.Year(), after.Month(), after.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+	for i := 0; i <= 7; i++ {
+		candidate := day.AddDate(0, 0, i)
+		if candidate.After(after) && (len(allowed) == 0 || allowed[candidate.Weekday()]) {
+			return candidate, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("nenhum dia da semana válido")
+}
+
+// dueBackupRun retorna o próximo horário do job a partir da última
+// execução, ou da criação do job se ele nunca rodou. Um horário no passado
+// é uma execução perdida.
+func dueBackupRun(job types.BackupJob, state *backupState) (time.Time, error) {
+	reference := job.CreatedAt
+	if state.LastRun != "" {
+		reference = state.LastRun
+	}
+	after, _ := time.Parse(time.RFC3339, reference)
+	return nextBackupRun(job, after)
+}
+
+// normalizeJob valida um backup agendado e preenche os valores padrão
+func normalizeJob(job *types.BackupJob) error {
+	abs, err := absDir(job.Path)
+	if err != nil {
+		return err
+	}
+	job.Path = abs
+
+	if err := validatePatterns(job.Include, job.Exclude); err != nil {
+		return err
+	}
+	if job.Exclude == nil {
+		job.Exclude = defaultWatchExclude
+	}
+	if job.Name == "" {
+		job.Name = filepath.Base(abs)
+	}
+	if job.Time == "" {
+		job.Time = defaultBackupTime
+	}
+	for _, d := range job.Weekdays {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("dia da semana inválido: %d", d)
+		}
+	}
+	if job.KeepVersions < 0 || job.KeepDays < 0 {
+		return fmt.Errorf("retenção inválida")
+	}
+	_, err = nextBackupRun(*job, time.Now())
+	return err
+}
+
+// BackupJobs lista os backups agendados com o estado de suas execuções
+func (a *Agent) BackupJobs() []types.BackupJobStatus {
+	jobs := a.config.Jobs()
+	result := make([]types.BackupJobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		state := loadBackupState(job.ID)
+		status := types.BackupJobStatus{Job: job, LastRun: state.LastRun}
+
+		if job.Enabled {
+			if next, err := dueBackupRun(job, state); err == nil {
+				status.NextRun = next.UTC().Format(time.RFC3339)
+			}
+		}
+		if current := a.backups.snapshot(job.ID); current != nil {
+			status.Running = true
+			status.LastReport = current
+		} else if n := len(state.Reports); n > 0 {
+			status.LastReport = &state.Reports[n-1]
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// findJob retorna o backup agendado pelo ID
+func (a *Agent) findJob(id string) (types.BackupJob, error) {
+	for _, job := range a.config.Jobs() {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return types.BackupJob{}, fmt.Errorf("backup não encontrado: %s", id)
+}
+
+// AddBackupJob cria um backup agendado, já habilitado. A primeira execução
+// acontece no próximo horário agendado.
+func (a *Agent) AddBackupJob(job types.BackupJob) (*types.BackupJob, error) {
+	if err := normalizeJob(&job); err != nil {
+		return nil, err
+	}
+	job.ID = uuid.NewString()
+	job.Enabled = true
+	job.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := a.config.SetJobs(append(a.config.Jobs(), job)); err != nil {
+		return nil, err
+	}
+	a.backups.wake()
+	return &job, nil
+}
+
+// UpdateBackupJob altera um backup agendado. O manifesto é mantido, então
+// a próxima execução continua incremental.
+func (a *Agent) UpdateBackupJob(job types.BackupJob) (*types.BackupJob, error) {
+	if err := normalizeJob(&job); err != nil {
+		return nil, err
+	}
+
+	jobs := a.config.Jobs()
+	for i, j := range jobs {
+		if j.ID == job.ID {
+			job.CreatedAt = j.CreatedAt
+			jobs[i] = job
+			if err := a.config.SetJobs(jobs); err != nil {
+				return nil, err
+			}
+			a.backups.wake()
+			return &job, nil
+		}
+	}
+	return nil, fmt.Errorf("backup não encontrado: %s", job.ID)
+}
+
+// RemoveBackupJob remove um backup agendado e seu estado local. As versões
+// já enviadas permanecem armazenadas.
+func (a *Agent) RemoveBackupJob(id string) error {
+	if a.backups.snapshot(id) != nil {
+		return fmt.Errorf("o backup está em execução; cancele-o antes de removê-lo")
+	}
+
+	jobs := a.config.Jobs()
+	for i, job := range jobs {
+		if job.ID != id {
+			continue
+		}
+		if err := a.config.SetJobs(append(jobs[:i], jobs[i+1:]...)); err != nil {
+			return err
+		}
+		if path, err := backupStatePath(id); err == nil {
+			os.Remove(path)
+		}
+		return nil
+	}
+	return fmt.Errorf("backup não encontrado: %s", id)
+}
+
+// BackupReports retorna os relatórios das últimas execuções de um job, da
+// mais recente à mais antiga
+func (a *Agent) BackupReports(id string) []types.BackupReport {
+	state := loadBackupState(id)
+	reports := make([]types.BackupReport, 0, len(state.Reports)+1)
+	if current := a.backups.snapshot(id); current != nil {
+		reports = append(reports, *current)
+	}
+	for i := len(state.Reports) - 1; i >= 0; i-- {
+		reports = append(reports, state.Reports[i])
+	}
+	return reports
+}
+
+// StartBackupJob inicia uma execução manual de um job em segundo plano. O
+// andamento e o resultado são publicados em eventos de relatório.
+func (a *Agent) StartBackupJob(ctx context.Context, id string) (*types.BackupReport, error) {
+	job, err := a.findJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	report := newBackupReport(job, BackupManual)
+	if !a.backups.start(job.ID, report) {
+		return nil, fmt.Errorf("o backup %s já está em execução", job.Name)
+	}
+	c := *report
+	go a.runBackup(ctx, job, report)
+	return &c, nil
+}
+
+// CancelBackupJob cancela a execução em andamento de um job. Os arquivos
+// já enviados permanecem no manifesto e não são reenviados.
+func (a *Agent) CancelBackupJob(id string) error {
+	if !a.running.cancel(id) {
+		return fmt.Errorf("o backup não está em execução: %s", id)
+	}
+	return nil
+}
+
+// runBackups é o worker dos backups agendados
+func (a *Agent) runBackups(ctx context.Context) {
+	ticker := time.NewTicker(backupCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		a.runDueBackups(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.backups.wakeup:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueBackups executa, um de cada vez, os jobs cujo horário chegou. Um job
+// que perdeu um ou mais horários, com o aplicativo fechado, roda uma única
+// vez assim que possível.
+func (a *Agent) runDueBackups(ctx context.Context) {
+	// Sem dispositivo inicializado os jobs continuam pendentes
+	if deviceUUID, _ := a.tpmMgr.GetDeviceUUID(ctx); deviceUUID == "" {
+		return
+	}
+
+	for _, job := range a.config.Jobs() {
+		if ctx.Err() != nil {
+			return
+		}
+		if !job.Enabled {
+			continue
+		}
+		due, err := dueBackupRun(job, loadBackupState(job.ID))
+		if err != nil || time.Now().Before(due) {
+			continue
+		}
+
+		trigger := BackupScheduled
+		if time.Since(due) > catchUpGrace {
+			trigger = BackupCatchUp
+		}
+		report := newBackupReport(job, trigger)
+		if !a.backups.start(job.ID, report) {
+			continue
+		}
+		a.runBackup(ctx, job, report)
+	}
+}
+
+func newBackupReport(job types.BackupJob, trigger string) *types.BackupReport {
+	return &types.BackupReport{
+		RunID:     uuid.NewString(),
+		JobID:     job.ID,
+		Trigger:   trigger,
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+		Running:   true,
+	}
+}
+
+// runBackup executa um job já marcado como em execução: envia os arquivos
+// novos ou alterados desde a última execução, aplica a retenção do job e
+// grava o relatório
+func (a *Agent) runBackup(ctx context.Context, job types.BackupJob, report *types.BackupReport) {
+	defer a.backups.finish(job.ID)
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.running.add(job.ID, cancel)
+	defer a.running.done(job.ID)
+
+	publish := func(fn func(*types.BackupReport)) {
+		a.emit(BackupReportEvent, a.backups.update(report, fn))
+	}
+	publish(func(*types.BackupReport) {})
+	log.Printf("Backup %s iniciado (%s)", job.Name, report.Trigger)
+
+	state := loadBackupState(job.ID)
+	a.confirmQueued(state)
+	listed, listErr := listFiles(job.Path, job.Include, job.Exclude, true)
+	if listErr != nil {
+		publish(func(r *types.BackupReport) { r.Error = listErr.Error() })
+	}
+
+	paths := make([]string, 0, len(listed))
+	for path := range listed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		info := listed[path]
+		entry := state.Manifest[path]
+		if entry != nil && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+			a.backups.update(report, func(r *types.BackupReport) {
+				r.Scanned++
+				if entry.TransferID != "" {
+					r.Queued++
+				} else {
+					r.Unchanged++
+				}
+			})
+			continue
+		}
+
+		summary, err := a.encryptFor(ctx, path, a.config.DefaultRecipients, job.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			publish(func(r *types.BackupReport) {
+				r.Scanned++
+				r.Failed++
+				if len(r.Errors) < maxBackupErrors {
+					r.Errors = append(r.Errors, types.BackupFileError{Path: path, Error: err.Error()})
+				}
+			})
+			continue
+		}
+
+		next := &backupEntry{
+			Size:        info.Size(),
+			ModTime:     info.ModTime(),
+			FileID:      summary.FileID,
+			Version:     summary.Version,
+			OperationID: summary.OperationID,
+		}
+		if summary.Queued {
+			next.TransferID = summary.TransferID
+		}
+		if next.FileID == "" && entry != nil {
+			next.FileID = entry.FileID
+		}
+		state.Manifest[path] = next
+
+		publish(func(r *types.BackupReport) {
+			r.Scanned++
+			switch {
+			case summary.Deduplicated:
+				r.Unchanged++
+			case summary.Queued:
+				r.Queued++
+				r.Bytes += info.Size()
+			default:
+				r.Uploaded++
+				r.Bytes += info.Size()
+			}
+		})
+	}
+
+	// Envios da fila concluídos durante a execução
+	a.confirmQueued(state)
+
+	cancelled := ctx.Err() != nil
+	if !cancelled && listErr == nil {
+		// Arquivos apagados da pasta saem do manifesto; as versões
+		// armazenadas são mantidas
+		for path := range state.Manifest {
+			if _, ok := listed[path]; !ok {
+				delete(state.Manifest, path)
+			}
+		}
+		pruned := a.pruneBackup(ctx, job, state)
+		a.backups.update(report, func(r *types.BackupReport) { r.Pruned = pruned })
+	}
+
+	final := a.backups.update(report, func(r *types.BackupReport) {
+		r.Running = false
+		r.Cancelled = cancelled
+		r.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	})
+
+	// Cancelada pelo usuário, a execução conta como feita e o job espera o
+	// próximo horário; interrompida pelo encerramento do agente, continua
+	// pendente e é recuperada na próxima vez
+	if parent.Err() == nil {
+		state.LastRun = final.StartedAt
+	}
+	state.Reports = append(state.Reports, final)
+	if len(state.Reports) > maxBackupReports {
+		state.Reports = state.Reports[len(state.Reports)-maxBackupReports:]
+	}
+	saveBackupState(job.ID, state)
+
+	a.emit(BackupReportEvent, final)
+	log.Printf("Backup %s concluído: %d enviados, %d na fila, %d sem alteração, %d falhas, %d versões removidas",
+		job.Name, final.Uploaded, final.Queued, final.Unchanged, final.Failed, final.Pruned)
+}
+
+// confirmQueued confirma as entradas do manifesto cujo pacote estava na
+// fila de saída. Um envio descartado tira o arquivo do manifesto, para que
+// a próxima execução o envie de novo.
+func (a *Agent) confirmQueued(state *backupState) {
+	for path, entry := range state.Manifest {
+		if entry.TransferID == "" {
+			continue
+		}
+
+		operationID, err := a.queuedOperation(entry.TransferID, entry.FileID, entry.Version)
+		switch {
+		case err == nil:
+			entry.OperationID = operationID
+			entry.TransferID = ""
+		case errors.Is(err, errTransferPending):
+		default:
+			log.Printf("Aviso: envio de %s não confirmado pela fila de saída: %v", path, err)
+			delete(state.Manifest, path)
+		}
+	}
+}
+
+// pruneBackup aplica a retenção do job às versões dos arquivos do manifesto
+// e retorna quantas versões foram removidas
+func (a *Agent) pruneBackup(ctx context.Context, job types.BackupJob, state *backupState) int {
+	if job.KeepVersions <= 0 && job.KeepDays <= 0 {
+		return 0
+	}
+
+	pruned := 0
+	seen := make(map[string]bool)
+	for _, entry := range state.Manifest {
+		if entry.FileID == "" || seen[entry.FileID] {
+			continue
+		}
+		seen[entry.FileID] = true
+		if ctx.Err() != nil {
+			break
+		}
+		pruned += a.applyRetentionPolicy(ctx, entry.FileID, job.KeepVersions, job.KeepDays)
+	}
+	return pruned
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"testing"
+	"time"
+	"tpm-bunker/internal/types"
+)
+
+func TestNextBackupRun(t *testing.T) {
+	// 1º de janeiro de 2024 foi uma segunda-feira
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name     string
+		clock    string
+		weekdays []int
+		after    time.Time
+		want     time.Time
+		wantErr  bool
+	}{
+		{name: "mais tarde no mesmo dia", clock: "02:00", after: at(1, 1, 0), want: at(1, 2, 0)},
+		{name: "exatamente no horário", clock: "02:00", after: at(1, 2, 0), want: at(2, 2, 0)},
+		{name: "horário já passou", clock: "02:00", after: at(1, 3, 0), want: at(2, 2, 0)},
+		{name: "minutos", clock: "23:45", after: at(1, 23, 44), want: at(1, 23, 45)},
+		{name: "virada do mês", clock: "02:00", after: at(31, 3, 0), want: time.Date(2024, time.February, 1, 2, 0, 0, 0, time.Local)},
+		{name: "dia permitido", clock: "02:00", weekdays: []int{1}, after: at(1, 1, 0), want: at(1, 2, 0)},
+		{name: "uma semana depois", clock: "02:00", weekdays: []int{1}, after: at(1, 3, 0), want: at(8, 2, 0)},
+		{name: "fim de semana", clock: "08:30", weekdays: []int{0, 6}, after: at(3, 12, 0), want: at(6, 8, 30)},
+		{name: "domingo", clock: "08:30", weekdays: []int{0}, after: at(6, 9, 0), want: at(7, 8, 30)},
+		{name: "horário inválido", clock: "25:00", after: at(1, 1, 0), wantErr: true},
+		{name: "horário vazio", clock: "", after: at(1, 1, 0), wantErr: true},
+		{name: "dia da semana inexistente", clock: "02:00", weekdays: []int{9}, after: at(1, 1, 0), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := types.BackupJob{Time: tt.clock, Weekdays: tt.weekdays}
+			got, err := nextBackupRun(job, tt.after)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("nextBackupRun = %v, esperado erro", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("nextBackupRun: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("nextBackupRun(%s, %v) = %v, esperado %v", tt.clock, tt.after, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// BatchProgressEvent é o evento emitido a cada mudança de estado de um
+	// arquivo de um lote
+	BatchProgressEvent = "batch_progress"
+
+	maxBatchWorkers = 4
+)
+
+// batchRun é o estado compartilhado pelos workers de um lote
+type batchRun struct {
+	id         string
+	paths      []string
+	recipients []Recipient
+
+	mutex   sync.Mutex
+	results []types.BatchFileResult
+	// Envios do lote. Ficam reservados, inclusive os marcados para a fila de
+	// saída (Summary.Queued), e o worker não os toca até o lote concluir ou
+	// ser cancelado.
+	transfers []*transferState
+	completed int
+}
+
+// EncryptFiles encripta vários arquivos em paralelo, com no máximo
+// maxBatchWorkers de cada vez. A compressão, o AES e a leitura dos arquivos
+// correm em paralelo; os comandos do TPM são serializados pelo cliente. Cada
+// arquivo tem seu resultado, e uma falha não interrompe os demais.
+//
+// Os pacotes são enviados em sessões de envio, e só depois que todos foram
+// enviados as sessões são concluídas e os registros criados no servidor.
+// Cancelado o lote (CancelBatch ou fim de ctx) antes disso, as sessões são
+// descartadas; durante a conclusão, os pacotes já armazenados pelo lote são
+// removidos. Assim nenhum registro do lote permanece no servidor. Se
+// recipientUUIDs for nil, usa os destinatários padrão da configuração.
+func (a *Agent) EncryptFiles(ctx context.Context, paths []string, recipientUUIDs []string) (*types.BatchResult, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("nenhum arquivo informado")
+	}
+	if recipientUUIDs == nil {
+		recipientUUIDs = a.config.DefaultRecipients
+	}
+
+	recipients, err := a.resolveRecipients(ctx, recipientUUIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve recipients: %w", err)
+	}
+
+	run := &batchRun{
+		id:         uuid.NewString(),
+		paths:      paths,
+		recipients: recipients,
+		results:    make([]types.BatchFileResult, len(paths)),
+		transfers:  make([]*transferState, len(paths)),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.running.add(run.id, cancel)
+	defer a.running.done(run.id)
+
+	// O mesmo caminho duas vezes geraria duas versões concorrentes
+	jobs := make(chan int, len(paths))
+	seen := make(map[string]bool)
+	for i, path := range paths {
+		run.results[i].Path = path
+		key := path
+		if abs, err := filepath.Abs(path); err == nil {
+			key = abs
+		}
+		if seen[key] {
+			a.finishBatchFile(run, i, "failed", "arquivo repetido no lote")
+			continue
+		}
+		seen[key] = true
+		jobs <- i
+	}
+	close(jobs)
+
+	workers := min(maxBatchWorkers, runtime.NumCPU(), len(paths))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				a.encryptBatchFile(ctx, run, i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() == nil {
+		a.commitBatch(ctx, run)
+	}
+
+	result := &types.BatchResult{BatchID: run.id, Results: run.results}
+	if ctx.Err() != nil {
+		a.rollbackBatch(run)
+		result.Cancelled = true
+	}
+	a.releaseBatch(run)
+	a.outbox.wake()
+	return result, nil
+}
+
+// encryptBatchFile encripta e envia o i-ésimo arquivo do lote
+func (a *Agent) encryptBatchFile(ctx context.Context, run *batchRun, i int) {
+	path := run.paths[i]
+	if ctx.Err() != nil {
+		a.finishBatchFile(run, i, "cancelled", "")
+		return
+	}
+
+	a.emitBatchProgress(run, path, "encrypting", "")
+	summary, transfer, err := a.encryptToOutbox(ctx, path, run.recipients, "")
+	if err != nil {
+		if ctx.Err() != nil {
+			a.finishBatchFile(run, i, "cancelled", "")
+		} else {
+			a.finishBatchFile(run, i, "failed", err.Error())
+		}
+		return
+	}
+
+	run.mutex.Lock()
+	run.results[i].Summary = summary
+	run.mutex.Unlock()
+
+	// Arquivo já armazenado antes do lote
+	if transfer == nil {
+		a.finishBatchFile(run, i, "done", "")
+		return
+	}
+
+	// O envio chega reservado por createUpload e só vai para o worker da
+	// fila de saída quando o lote o libera
+	run.mutex.Lock()
+	run.transfers[i] = transfer
+	run.mutex.Unlock()
+
+	a.emitBatchProgress(run, path, "uploading", "")
+	err = a.stageBatchFile(ctx, transfer)
+	switch {
+	case err == nil:
+		// Concluído por commitBatch
+	case ctx.Err() != nil:
+		// Descartado por rollbackBatch
+		a.finishBatchFile(run, i, "cancelled", "")
+	case api.IsClientError(err):
+		a.dropBatchFile(run, i)
+		a.finishBatchFile(run, i, "failed", fmt.Errorf("%w: %w", errTransferRejected, err).Error())
+	default:
+		// Sem envio em partes ou sem conexão: commitBatch tenta de novo
+		log.Printf("Aviso: partes de %s não enviadas: %v", path, err)
+	}
+}
+
+// stageBatchFile envia as partes de um pacote do lote sem concluir o envio.
+// Um pacote para uma API sem envio em partes é enviado só na conclusão do
+// lote.
+func (a *Agent) stageBatchFile(ctx context.Context, t *transferState) error {
+	err := a.stageChunks(ctx, t)
+	if errors.Is(err, errChunkedUnsupported) {
+		return nil
+	}
+	return err
+}
+
+// commitBatch conclui os envios do lote, criando os registros no servidor.
+// Pacotes que não puderem ser enviados agora ficam na fila de saída.
+func (a *Agent) commitBatch(ctx context.Context, run *batchRun) {
+	for i, t := range run.transfers {
+		summary := run.results[i].Summary
+		if t == nil || summary.Queued {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := a.sendClaimed(ctx, t)
+		switch {
+		case err == nil:
+			log.Printf("Arquivo %s armazenado como versão %d", summary.FileName, summary.Version)
+			a.finishBatchFile(run, i, "done", "")
+		case ctx.Err() != nil:
+			return
+		case api.IsClientError(err):
+			a.dropBatchFile(run, i)
+			a.finishBatchFile(run, i, "failed", fmt.Errorf("%w: %w", errTransferRejected, err).Error())
+		default:
+			log.Printf("Arquivo %s na fila de saída: %v", summary.FileName, err)
+			summary.Queued = true
+			a.finishBatchFile(run, i, "queued", "")
+		}
+	}
+}
+
+// dropBatchFile descarta o envio reservado do i-ésimo arquivo do lote
+func (a *Agent) dropBatchFile(run *batchRun, i int) {
+	run.mutex.Lock()
+	t := run.transfers[i]
+	run.transfers[i] = nil
+	run.results[i].Summary = nil
+	run.mutex.Unlock()
+
+	if t != nil {
+		a.discardTransfer(t)
+		a.transfers.release(t.ID)
+	}
+}
+
+// releaseBatch devolve à fila de saída os envios que o lote ainda reserva
+func (a *Agent) releaseBatch(run *batchRun) {
+	for _, t := range run.transfers {
+		if t != nil {
+			a.transfers.release(t.ID)
+		}
+	}
+}
+
+// finishBatchFile registra o estado final de um arquivo e o publica
+func (a *Agent) finishBatchFile(run *batchRun, i int, status, errMsg string) {
+	run.mutex.Lock()
+	run.completed++
+	run.results[i].Error = errMsg
+	run.results[i].Cancelled = status == "cancelled"
+	run.mutex.Unlock()
+
+	a.emitBatchProgress(run, run.paths[i], status, errMsg)
+}
+
+func (a *Agent) emitBatchProgress(run *batchRun, path, status, errMsg string) {
+	run.mutex.Lock()
+	completed := run.completed
+	run.mutex.Unlock()
+
+	a.emit(BatchProgressEvent, types.BatchProgress{
+		BatchID:   run.id,
+		Path:      path,
+		Status:    status,
+		Completed: completed,
+		Total:     len(run.paths),
+		Error:     errMsg,
+	})
+}
+
+// rollbackBatch desfaz o que o lote cancelado deixou: descarta as sessões
+// de envio ainda não concluídas, retira da fila de saída os pacotes que
+// ficaram nela e remove os que ele armazenou. Arquivos que já estavam
+// armazenados antes do lote não são tocados.
+func (a *Agent) rollbackBatch(run *batchRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	for i := range run.results {
+		result := &run.results[i]
+		if result.Summary == nil || result.Summary.Deduplicated {
+			continue
+		}
+
+		switch {
+		case result.Summary.OperationID != "":
+			if err := a.Delete(ctx, result.Summary.OperationID); err != nil {
+				log.Printf("Aviso: pacote %s do lote cancelado não removido: %v", result.Summary.OperationID, err)
+				result.Error = "lote cancelado, mas o pacote armazenado não pôde ser removido: " + err.Error()
+				continue
+			}
+		case run.transfers[i] != nil:
+			// Ainda reservado pelo lote, mesmo se marcado para a fila
+			a.dropBatchFile(run, i)
+		}
+
+		result.Summary = nil
+		result.Error = ""
+		result.Cancelled = true
+		a.emitBatchProgress(run, result.Path, "cancelled", "")
+	}
+
+	pending, _ := pendingTransfers()
+	a.updateOutbox(func(state *types.OutboxState) { state.Pending = pending })
+}
+
+// CancelBatch cancela uma encriptação em lote em andamento
+func (a *Agent) CancelBatch(batchID string) error {
+	if !a.running.cancel(batchID) {
+		return fmt.Errorf("lote não encontrado: %s", batchID)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionAuto = "auto"
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressionSampleSize é o tamanho da amostra usada para estimar a taxa de
+// compressão no modo automático
+const compressionSampleSize = 64 * 1024
+
+// Limites da descompressão: margem sobre o tamanho original declarado no
+// cabeçalho e teto para pacotes que não o declaram
+const (
+	decompressMargin    = 64 * 1024
+	maxDecompressedSize = 4 << 30
+)
+
+// compressedExtensions lista formatos que já são comprimidos
+var compressedExtensions = map[string]bool{
+	".7z": true, ".avi": true, ".br": true, ".bz2": true, ".docx": true,
+	".gif": true, ".gz": true, ".heic": true, ".jpeg": true, ".jpg": true,
+	".mkv": true, ".mov": true, ".mp3": true, ".mp4": true, ".ogg": true,
+	".png": true, ".pptx": true, ".rar": true, ".webm": true, ".webp": true,
+	".xlsx": true, ".xz": true, ".zip": true, ".zst": true,
+}
+
+// textExtensions lista formatos de texto que costumam comprimir bem
+var textExtensions = map[string]bool{
+	".csv": true, ".htm": true, ".html": true, ".json": true, ".log": true,
+	".md": true, ".sql": true, ".tsv": true, ".txt": true, ".xml": true,
+	".yaml": true, ".yml": true,
+}
+
+// chooseCompression decide o algoritmo a partir da configuração. No modo
+// automático usa a extensão, o tipo de conteúdo detectado e, em último
+// caso, a taxa obtida ao comprimir uma amostra.
+func chooseCompression(setting, fileName string, sample []byte) string {
+	switch setting {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return setting
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if compressedExtensions[ext] {
+		return CompressionNone
+	}
+	if textExtensions[ext] {
+		return CompressionZstd
+	}
+
+	if len(sample) > compressionSampleSize {
+		sample = sample[:compressionSampleSize]
+	}
+	if len(sample) == 0 {
+		return CompressionNone
+	}
+
+	contentType := http.DetectContentType(sample)
+	if strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") {
+		return CompressionZstd
+	}
+
+	compressed, err := compressData(CompressionGzip, sample)
+	if err == nil && len(compressed) < len(sample)*9/10 {
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// compressWriter retorna um writer que comprime com o algoritmo informado
+func compressWriter(algorithm string, w io.Writer) (io.WriteCloser, error) {
+	switch algorithm {
+	case CompressionGzip:
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("algoritmo de compressão não suportado: %s", algorithm)
+	}
+}
+
+func compressData(algorithm string, data []byte) ([]byte, error) {
+	if algorithm == "" || algorithm == CompressionNone {
+		return data, nil
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := compressWriter(algorithm, buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("erro ao comprimir dados: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("erro ao finalizar compressão: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressLimit é o tamanho máximo aceito na descompressão. Pacotes
+// antigos de diretório não informam o tamanho original.
+func decompressLimit(originalSize int64) int64 {
+	if originalSize > 0 {
+		return originalSize + decompressMargin
+	}
+	return maxDecompressedSize
+}
+
+// decompressData descomprime data, falhando se o resultado passar de limit
+// bytes. O limite impede que um pacote pequeno se expanda até esgotar a
+// memória.
+func decompressData(algorithm string, data []byte, limit int64) ([]byte, error) {
+	var r io.Reader
+	switch algorithm {
+	case "", CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("erro ao abrir dados gzip: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case CompressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("erro ao abrir dados zstd: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("algoritmo de compressão não suportado: %s", algorithm)
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("dados descomprimidos excedem o tamanho esperado (%d bytes)", limit)
+	}
+	return out, nil
+}
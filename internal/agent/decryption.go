@@ -16,43 +16,85 @@ import (
 
 type DecryptionResult struct {
 	DecryptedData []byte
+	Header        *PackageHeader
 	Verified      bool
 }
 
-func DecryptFile(ctx context.Context, decryptResp *types.DecryptResponse, tpmMgr *tpm.Manager) (*DecryptionResult, error) {
+// DecryptFile verifica a assinatura do pacote e o decripta com a chave do
+// TPM. signerKey é a chave pública de quem assinou o pacote; se for nil,
+// usa a chave de assinatura local.
+func DecryptFile(ctx context.Context, decryptResp *types.DecryptResponse, tpmMgr *tpm.Manager, signerKey *rsa.PublicKey) (*DecryptionResult, error) {
+	header, body, err := decryptEnvelope(ctx, decryptResp, tpmMgr, signerKey)
+	if err != nil {
+		return nil, err
+	}
+	return decompressEnvelope(header, body)
+}
+
+// decryptEnvelope verifica a assinatura do pacote, o decripta e separa o
+// cabeçalho do corpo, que continua comprimido. Permite conferir o cabeçalho
+// antes de descomprimir o conteúdo.
+func decryptEnvelope(ctx context.Context, decryptResp *types.DecryptResponse, tpmMgr *tpm.Manager, signerKey *rsa.PublicKey) (*PackageHeader, []byte, error) {
 	// Verify digital signature first
+	progressFrom(ctx).setPhase(PhaseVerify, 0)
 	hash := sha256.Sum256(decryptResp.EncryptedData)
 	signature, err := base64.StdEncoding.DecodeString(decryptResp.DigitalSignature)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao decodificar assinatura: %w", err)
+		return nil, nil, fmt.Errorf("erro ao decodificar assinatura: %w", err)
 	}
 
 	// Get public key for verification
-	pubKey, err := tpmMgr.Client.RetrieveRSASignKey(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("erro ao recuperar chave pública: %w", err)
+	pubKey := signerKey
+	if pubKey == nil {
+		pubKey, err = tpmMgr.Client.RetrieveRSASignKey(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("erro ao recuperar chave pública: %w", err)
+		}
 	}
 
 	// Verify signature
 	err = rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, hash[:], signature)
 	if err != nil {
-		return nil, fmt.Errorf("assinatura digital inválida: %w", err)
+		return nil, nil, fmt.Errorf("assinatura digital inválida: %w", err)
 	}
 
-	log.Printf("[Decrypt] Received Encrypted Symmetric Key (Hex): %x", decryptResp.EncryptedSymmetricKey)
+	// Seleciona a chave simétrica encriptada para este dispositivo
+	localKey, err := tpmMgr.Client.RetrieveRSADecryptKey(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao recuperar chave de decriptação: %w", err)
+	}
 
+	encryptedKey, err := selectWrappedKey(decryptResp, localKey)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao decodificar chave simétrica: %w", err)
+		return nil, nil, err
 	}
 
+	log.Printf("[Decrypt] Received Encrypted Symmetric Key (Hex): %x", encryptedKey)
+
 	// Decrypt the data
-	decryptedData, err := decryptInMemory(ctx, decryptResp.EncryptedData, decryptResp.EncryptedSymmetricKey, tpmMgr)
+	decryptedData, err := decryptInMemory(ctx, decryptResp.EncryptedData, encryptedKey, tpmMgr)
 	if err != nil {
-		return nil, fmt.Errorf("erro na decriptação: %w", err)
+		return nil, nil, fmt.Errorf("erro na decriptação: %w", err)
+	}
+
+	header, body, err := openEnvelope(decryptedData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao abrir pacote: %w", err)
+	}
+	return header, body, nil
+}
+
+// decompressEnvelope descomprime o corpo de um pacote aberto por
+// decryptEnvelope
+func decompressEnvelope(header *PackageHeader, body []byte) (*DecryptionResult, error) {
+	body, err := decompressData(header.Compression, body, decompressLimit(header.OriginalSize))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descomprimir dados: %w", err)
 	}
 
 	return &DecryptionResult{
-		DecryptedData: decryptedData,
+		DecryptedData: body,
+		Header:        header,
 		Verified:      true,
 	}, nil
 }
@@ -78,9 +120,12 @@ func decryptInMemory(ctx context.Context, encryptedData, encryptedKey []byte, tp
 	}
 
 	// Decrypt content
+	progressFrom(ctx).setPhase(PhaseDecrypt, int64(len(encryptedContent)))
 	mode := cipher.NewCBCDecrypter(block, iv)
 	decryptedData := make([]byte, len(encryptedContent))
-	mode.CryptBlocks(decryptedData, encryptedContent)
+	if err := cryptBlocks(ctx, mode, decryptedData, encryptedContent); err != nil {
+		return nil, err
+	}
 
 	// Remove PKCS7 padding
 	unpadded, err := unpadPKCS7(decryptedData)
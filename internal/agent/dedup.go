@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	dedupSecretName    = "dedup"
+	dedupCacheFileName = "dedup.json"
+)
+
+// dedupEntry é a etiqueta calculada para um arquivo em um dado estado
+type dedupEntry struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Tag     string    `json:"tag"`
+}
+
+// dedupCache guarda em disco as etiquetas por caminho, evitando reler
+// arquivos que não mudaram desde o último cálculo
+type dedupCache struct {
+	mutex   sync.Mutex
+	loaded  bool
+	path    string
+	entries map[string]dedupEntry
+}
+
+func (c *dedupCache) loadLocked() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	c.entries = make(map[string]dedupEntry)
+
+	dir, err := config.Dir()
+	if err != nil {
+		log.Printf("Aviso: cache de deduplicação desativado: %v", err)
+		return
+	}
+	c.path = filepath.Join(dir, dedupCacheFileName)
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Aviso: erro ao ler cache de deduplicação: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		log.Printf("Aviso: cache de deduplicação inválido: %v", err)
+		c.entries = make(map[string]dedupEntry)
+	}
+}
+
+func (c *dedupCache) get(path string, info os.FileInfo) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.loadLocked()
+
+	entry, ok := c.entries[path]
+	if !ok || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	return entry.Tag, true
+}
+
+func (c *dedupCache) put(path string, info os.FileInfo, tag string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.loadLocked()
+
+	c.entries[path] = dedupEntry{ModTime: info.ModTime(), Size: info.Size(), Tag: tag}
+	c.saveLocked()
+}
+
+func (c *dedupCache) saveLocked() {
+	if c.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		log.Printf("Aviso: erro ao serializar cache de deduplicação: %v", err)
+		return
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("Aviso: erro ao gravar cache de deduplicação: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		log.Printf("Aviso: erro ao gravar cache de deduplicação: %v", err)
+	}
+}
+
+// forget descarta a etiqueta guardada para path
+func (c *dedupCache) forget(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.loadLocked()
+
+	if _, ok := c.entries[path]; !ok {
+		return
+	}
+	delete(c.entries, path)
+	c.saveLocked()
+}
+
+// contentTag calcula a etiqueta de deduplicação de um arquivo ou diretório:
+// um HMAC do conteúdo com uma chave que só este dispositivo conhece, de
+// forma que o servidor não consiga confirmar se um arquivo conhecido foi
+// armazenado. O conjunto de destinatários entra na etiqueta, pois o mesmo
+// conteúdo enviado para outros dispositivos é um pacote diferente.
+func (a *Agent) contentTag(ctx context.Context, path string, info os.FileInfo, recipientUUIDs []string) (string, error) {
+	var contentHash string
+	if info.IsDir() {
+		digest, err := contentDigest(path)
+		if err != nil {
+			return "", err
+		}
+		contentHash = "directory:" + digest
+	} else if cached, ok := a.dedup.get(path, info); ok {
+		contentHash = cached
+	} else {
+		digest, err := a.fileTag(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		a.dedup.put(path, info, digest)
+		contentHash = digest
+	}
+
+	key, err := a.deviceSecret(ctx, dedupSecretName)
+	if err != nil {
+		return "", err
+	}
+
+	recipients := append([]string(nil), recipientUUIDs...)
+	sort.Strings(recipients)
+
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "tpm-bunker-dedup-v1\n%s\n", contentHash)
+	for _, uuid := range recipients {
+		fmt.Fprintf(mac, "%s\n", uuid)
+	}
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// fileTag calcula o HMAC do conteúdo de um arquivo com a chave local. É o
+// valor guardado no cache, que por isso não revela o hash do conteúdo.
+func (a *Agent) fileTag(ctx context.Context, path string) (string, error) {
+	key, err := a.deviceSecret(ctx, dedupSecretName)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("erro ao abrir arquivo: %w", err)
+	}
+	defer f.Close()
+
+	mac := hmac.New(sha256.New, key)
+	if _, err := io.Copy(mac, f); err != nil {
+		return "", fmt.Errorf("erro ao ler arquivo: %w", err)
+	}
+	return "file:" + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// findDuplicate procura no servidor um pacote deste dispositivo com o mesmo
+// conteúdo e destinatários. Se existir, retorna o resumo da operação
+// existente; caso contrário, retorna a etiqueta a enviar com o novo pacote.
+func (a *Agent) findDuplicate(ctx context.Context, path string, info os.FileInfo, recipients []Recipient) (*types.EncryptionSummary, string, error) {
+	recipientUUIDs := []string{a.tpmMgr.DeviceUUID}
+	for _, r := range recipients {
+		recipientUUIDs = append(recipientUUIDs, r.DeviceUUID)
+	}
+
+	tag, err := a.contentTag(ctx, path, info, recipientUUIDs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lookup, err := a.client.FindByTag(ctx, a.deviceHeader(), tag)
+	if err != nil {
+		return nil, tag, err
+	}
+	if !lookup.Found || lookup.OperationID == "" {
+		return nil, tag, nil
+	}
+
+	log.Printf("Conteúdo de %s já armazenado na operação %s; envio ignorado", path, lookup.OperationID)
+	summary := &types.EncryptionSummary{
+		OperationID:  lookup.OperationID,
+		FileName:     filepath.Base(filepath.Clean(path)),
+		Recipients:   recipientUUIDs,
+		Deduplicated: true,
+	}
+	if !info.IsDir() {
+		summary.OriginalSize = info.Size()
+	}
+	return summary, tag, nil
+}
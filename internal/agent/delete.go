@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/types"
+)
+
+// Delete remove um pacote armazenado. O pedido é assinado pelo TPM, de
+// forma que o servidor possa verificar que partiu deste dispositivo. O
+// estado local ligado ao pacote também é atualizado: histórico de versões,
+// cache de deduplicação, metadados em memória e cópias temporárias.
+func (a *Agent) Delete(ctx context.Context, operationID string) (err error) {
+	defer func() { a.logEvent(EventDelete, err, types.SecurityEvent{OperationID: operationID}) }()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	if operationID == "" {
+		return fmt.Errorf("operação não informada")
+	}
+
+	request := &api.DeleteRequest{
+		OperationID: operationID,
+		DeviceUUID:  a.tpmMgr.DeviceUUID,
+		RequestedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	digest := deleteDigest(request)
+	signature, err := a.tpmMgr.Client.SignData(ctx, digest[:])
+	if err != nil {
+		return fmt.Errorf("erro ao assinar remoção: %w", err)
+	}
+	request.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	if err := a.client.DeleteOperation(ctx, a.deviceHeader(), request); err != nil {
+		return err
+	}
+
+	a.forgetOperation(operationID)
+
+	log.Printf("Operação %s removida", operationID)
+	return nil
+}
+
+// forgetOperation descarta o estado local ligado a um pacote que deixou de
+// existir no servidor
+func (a *Agent) forgetOperation(operationID string) {
+	if path, ok := a.versions.remove(operationID); ok {
+		a.dedup.forget(path)
+	}
+	a.metadata.remove(operationID)
+	a.operations.forget(operationID)
+	if a.scratch != nil {
+		a.scratch.wipeOperation(operationID)
+	}
+}
+
+// DeleteMany remove vários pacotes, continuando após falhas individuais
+func (a *Agent) DeleteMany(ctx context.Context, operationIDs []string) []types.DeleteResult {
+	results := make([]types.DeleteResult, 0, len(operationIDs))
+	for _, operationID := range operationIDs {
+		result := types.DeleteResult{OperationID: operationID}
+		if err := a.Delete(ctx, operationID); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Deleted = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// deleteDigest calcula o hash assinado em um pedido de remoção
+func deleteDigest(request *api.DeleteRequest) [32]byte {
+	msg := fmt.Sprintf("tpm-bunker-delete-v1\n%s\n%s\n%s\n", request.OperationID, request.DeviceUUID, request.RequestedAt)
+	return sha256.Sum256([]byte(msg))
+}
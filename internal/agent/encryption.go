@@ -10,11 +10,14 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 	"tpm-bunker/internal/tpm"
+	"tpm-bunker/internal/types"
 )
 
 type EncryptionResult struct {
@@ -23,91 +26,425 @@ type EncryptionResult struct {
 	DigitalSignature      string            `json:"digital_signature"`
 	HashOriginal          string            `json:"hash_original"`
 	Metadata              map[string]string `json:"metadata"`
-	EncryptedData         []byte
+
+	// Tamanho e SHA-256 do pacote cifrado, gravado no destino informado à
+	// encriptação
+	CiphertextSize   int64
+	CiphertextDigest []byte
+
+	// Nome real do conteúdo; o servidor recebe apenas um nome opaco
+	FileName string
+
+	// Chave simétrica encriptada para cada destinatário, incluindo este
+	// dispositivo
+	WrappedKeys []types.WrappedKey
+
+	// Compressão aplicada e tamanho do conteúdo antes e depois dela
+	Compression    string
+	OriginalSize   int64
+	CompressedSize int64
+
+	// Bytes acrescentados ao pacote cifrado pela política de padding
+	PaddingOverhead int64
+}
+
+// paddingPolicy retorna a política de padding das opções, ou vazio se
+// nenhuma for aplicada
+func paddingPolicy(opts *PackageOptions) string {
+	if opts.Padding == PaddingNone {
+		return ""
+	}
+	return opts.Padding
+}
+
+// PackageOptions controla como o conteúdo é preparado antes da encriptação
+type PackageOptions struct {
+	// Compression é "auto", "none", "gzip" ou "zstd"
+	Compression string
+
+	// Recipients são outros dispositivos que também poderão abrir o pacote
+	Recipients []Recipient
+
+	// Padding é "none", "padme" ou "pow2"
+	Padding string
+
+	// Versão do arquivo lógico a que o pacote pertence, se houver
+	Version *VersionInfo
 }
 
-func EncryptFile(ctx context.Context, inputFilePath string, pubKey *rsa.PublicKey, tpmMgr *tpm.Manager) (*EncryptionResult, error) {
-	fileData, err := os.ReadFile(inputFilePath)
+// EncryptFile encripta o arquivo em inputFilePath, gravando o pacote
+// cifrado em out à medida que é produzido. O arquivo é lido em fluxo: só a
+// amostra usada para escolher a compressão fica inteira em memória.
+func EncryptFile(ctx context.Context, inputFilePath string, pubKey *rsa.PublicKey, tpmMgr *tpm.Manager, opts *PackageOptions, out io.Writer) (*EncryptionResult, error) {
+	f, err := os.Open(inputFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	size := info.Size()
+
+	sample := make([]byte, min(size, compressionSampleSize))
+	if _, err := io.ReadFull(f, sample); err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	attrs, err := captureAttributes(inputFilePath, sample)
+	if err != nil {
+		return nil, err
+	}
+	attrs.Size = size
+
+	header := &PackageHeader{
+		Kind:         PackageKindFile,
+		FileName:     filepath.Base(inputFilePath),
+		Compression:  chooseCompression(opts.Compression, inputFilePath, sample),
+		OriginalSize: size,
+		Attributes:   attrs,
+		Padding:      paddingPolicy(opts),
+	}
 
-	encryptedData, encryptedKey, signature, hash, err := encryptInMemory(ctx, fileData, pubKey, tpmMgr)
+	// Um arquivo que cabe na amostra já está em memória: comprime antes e
+	// armazena o original se a compressão não compensar. Nos maiores, a
+	// amostra decide e o conteúdo passa pelo compressor direto para a cifra.
+	if int64(len(sample)) == size && header.Compression != CompressionNone {
+		compressed, err := compressData(header.Compression, sample)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) >= len(sample) {
+			header.Compression = CompressionNone
+		}
+	}
+
+	progressFrom(ctx).setPhase(PhaseEncrypt, size)
+	return encryptPackage(ctx, inputFilePath, header, func(w io.Writer) (int64, error) {
+		body := &countingWriter{w: w}
+		content := &countingWriter{w: body, p: progressFrom(ctx)}
+		var zw io.WriteCloser
+		if header.Compression != CompressionNone {
+			var err error
+			if zw, err = compressWriter(header.Compression, body); err != nil {
+				return 0, err
+			}
+			content.w = zw
+		}
+
+		if _, err := content.Write(sample); err != nil {
+			return 0, err
+		}
+		if _, err := io.Copy(content, io.LimitReader(f, size-int64(len(sample)))); err != nil {
+			return 0, fmt.Errorf("error reading file: %w", err)
+		}
+		if zw != nil {
+			if err := zw.Close(); err != nil {
+				return 0, fmt.Errorf("error compressing file: %w", err)
+			}
+		}
+
+		// O tamanho original vai no cabeçalho, gravado antes do corpo; um
+		// arquivo que encolheu durante a leitura não corresponde a ele
+		if content.n != size {
+			return 0, fmt.Errorf("arquivo alterado durante a leitura: %s", inputFilePath)
+		}
+		return body.n, nil
+	}, pubKey, tpmMgr, opts, out)
+}
+
+// EncryptDirectory arquiva a árvore em dirPath como tar e a encripta em um
+// único pacote, gravado em out. O tar passa pelo compressor direto para a
+// cifra, sem arquivos temporários nem cópia do texto claro em memória.
+func EncryptDirectory(ctx context.Context, dirPath string, pubKey *rsa.PublicKey, tpmMgr *tpm.Manager, opts *PackageOptions, out io.Writer) (*EncryptionResult, error) {
+	header := &PackageHeader{
+		Kind:        PackageKindDirectory,
+		FileName:    filepath.Base(filepath.Clean(dirPath)),
+		Archive:     archiveFormatTar,
+		Compression: opts.Compression,
+		Padding:     paddingPolicy(opts),
+		SizeTrailer: true,
+	}
+	if header.Compression == "" || header.Compression == CompressionAuto {
+		// Árvores costumam misturar formatos; o zstd é barato mesmo em dados
+		// já comprimidos
+		header.Compression = CompressionZstd
+	}
+
+	progressFrom(ctx).setPhase(PhaseEncrypt, 0)
+	return encryptPackage(ctx, dirPath, header, func(w io.Writer) (int64, error) {
+		body := &countingWriter{w: w}
+		archive := &countingWriter{w: body, p: progressFrom(ctx)}
+		var zw io.WriteCloser
+		if header.Compression != CompressionNone {
+			var err error
+			if zw, err = compressWriter(header.Compression, body); err != nil {
+				return 0, err
+			}
+			archive.w = zw
+		}
+
+		if err := archiveDirectory(ctx, dirPath, archive); err != nil {
+			return 0, fmt.Errorf("error archiving directory: %w", err)
+		}
+		if zw != nil {
+			if err := zw.Close(); err != nil {
+				return 0, fmt.Errorf("error compressing archive: %w", err)
+			}
+		}
+
+		// O tamanho original só é conhecido ao final do tar; segue o corpo,
+		// dentro do texto claro assinado, para limitar a descompressão
+		header.OriginalSize = archive.n
+		if err := writeSizeTrailer(w, archive.n); err != nil {
+			return 0, err
+		}
+		return body.n, nil
+	}, pubKey, tpmMgr, opts, out)
+}
+
+// encryptPackage cifra o envelope do pacote em out. writeBody grava o corpo
+// após o cabeçalho e retorna o tamanho armazenado, antes do padding. A
+// assinatura cobre o SHA-256 calculado sobre o pacote enquanto é gravado.
+func encryptPackage(ctx context.Context, inputPath string, header *PackageHeader, writeBody func(io.Writer) (int64, error), pubKey *rsa.PublicKey, tpmMgr *tpm.Manager, opts *PackageOptions, out io.Writer) (*EncryptionResult, error) {
+	recipients := append([]Recipient{{DeviceUUID: tpmMgr.DeviceUUID, PublicKey: pubKey}}, opts.Recipients...)
+
+	// Generate random AES key
+	symmetricKey := make([]byte, 32)
+	if _, err := rand.Read(symmetricKey); err != nil {
+		return nil, fmt.Errorf("error generating symmetric key: %w", err)
+	}
+	defer clear(symmetricKey)
+
+	wrappedKeys, err := wrapKeys(recipients, symmetricKey)
 	if err != nil {
 		return nil, err
 	}
 
-	ext := filepath.Ext(inputFilePath)
-	filename := inputFilePath[:len(inputFilePath)-len(ext)]
+	hasher := sha256.New()
+	ciphertext := &countingWriter{w: io.MultiWriter(out, hasher)}
+	cw, err := newCBCWriter(ctx, symmetricKey, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEnvelopeHeader(cw, header); err != nil {
+		return nil, err
+	}
+	bodySize, err := writeBody(cw)
+	if err != nil {
+		return nil, err
+	}
+
+	// O padding fica dentro do envelope, portanto cifrado e assinado
+	var paddingOverhead int64
+	if header.Padding != "" {
+		var suffix []byte
+		suffix, paddingOverhead = paddingSuffix(header.Padding, cw.n)
+		if _, err := cw.Write(suffix); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	hash := hasher.Sum(nil)
+
+	// Sign hash using TPM
+	progressFrom(ctx).setPhase(PhaseSign, 0)
+	signature, err := tpmMgr.Client.SignData(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("error signing data: %w", err)
+	}
+
+	recipientUUIDs := make([]string, 0, len(wrappedKeys))
+	for _, wk := range wrappedKeys {
+		recipientUUIDs = append(recipientUUIDs, wk.DeviceUUID)
+	}
+
+	fileName := header.FileName
+	if header.Kind == PackageKindDirectory {
+		fileName += "." + header.Archive
+	}
+
+	// O servidor recebe apenas um nome opaco; o nome real e os metadados
+	// descritivos seguem cifrados com a chave do pacote
+	objectName, err := opaqueName()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &PackageMetadata{
+		FileName:     fileName,
+		Kind:         header.Kind,
+		Compression:  header.Compression,
+		OriginalSize: header.OriginalSize,
+		StoredSize:   bodySize,
+	}
+	if opts.Version != nil {
+		meta.FileID = opts.Version.FileID
+		meta.Version = opts.Version.Version
+		meta.PreviousOperationID = opts.Version.PreviousOperationID
+	}
+	if header.Attributes != nil {
+		meta.MimeType = header.Attributes.MimeType
+		meta.ModTime = header.Attributes.ModTime.UTC().Format(time.RFC3339)
+	}
+
+	sealedMeta, err := sealMetadata(symmetricKey, objectName, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := filepath.Ext(inputPath)
+	filename := inputPath[:len(inputPath)-len(ext)]
 	encryptedFilePath := filename + "_encrypted" + ext
 
 	return &EncryptionResult{
 		EncryptedFilePath:     encryptedFilePath,
-		EncryptedSymmetricKey: base64.StdEncoding.EncodeToString(encryptedKey),
+		EncryptedSymmetricKey: base64.StdEncoding.EncodeToString(wrappedKeys[0].EncryptedKey),
+		WrappedKeys:           wrappedKeys,
 		DigitalSignature:      base64.StdEncoding.EncodeToString(signature),
-		HashOriginal:          base64.StdEncoding.EncodeToString(hash[:]),
-		EncryptedData:         encryptedData,
+		HashOriginal:          base64.StdEncoding.EncodeToString(hash),
+		CiphertextSize:        ciphertext.n,
+		CiphertextDigest:      hash,
+		FileName:              fileName,
+		Compression:           header.Compression,
+		OriginalSize:          header.OriginalSize,
+		CompressedSize:        bodySize,
+		PaddingOverhead:       paddingOverhead,
 		Metadata: map[string]string{
-			"filename":  filepath.Base(inputFilePath),
-			"version":   "1.0",
-			"timestamp": time.Now().UTC().Format(time.RFC3339),
-			"algorithm": "AES-256-CBC",
+			"filename":           objectName,
+			"version":            "3.0",
+			"timestamp":          time.Now().UTC().Format(time.RFC3339),
+			"algorithm":          "AES-256-CBC",
+			"encrypted_metadata": sealedMeta,
+			"recipients":         strings.Join(recipientUUIDs, ","),
 		},
 	}, nil
 }
 
-func encryptInMemory(ctx context.Context, data []byte, pubKey *rsa.PublicKey, tpmMgr *tpm.Manager) (encryptedData []byte, encryptedKey []byte, signature []byte, hash [32]byte, err error) {
-	// Generate random AES key
-	symmetricKey := make([]byte, 32)
-	if _, err := rand.Read(symmetricKey); err != nil {
-		return nil, nil, nil, hash, fmt.Errorf("error generating symmetric key: %w", err)
-	}
-
-	// Encrypt AES key with RSA public key
-	encryptedKey, err = rsa.EncryptOAEP(
-		sha256.New(),
-		rand.Reader,
-		pubKey,
-		symmetricKey,
-		nil,
-	)
-	log.Printf("[Encrypt] Encrypted Symmetric Key (Hex): %x", encryptedKey)
-	if err != nil {
-		return nil, nil, nil, hash, fmt.Errorf("error encrypting symmetric key: %w", err)
+// countingWriter contabiliza os bytes escritos em w e, se p não for nil,
+// os reporta como andamento da operação
+type countingWriter struct {
+	w io.Writer
+	n int64
+	p *progress
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.p.add(int64(n))
+	return n, err
+}
+
+// wrapKeys encripta a chave simétrica com a chave RSA de cada destinatário
+func wrapKeys(recipients []Recipient, symmetricKey []byte) ([]types.WrappedKey, error) {
+	wrappedKeys := make([]types.WrappedKey, 0, len(recipients))
+	for _, recipient := range recipients {
+		wrapped, err := wrapKey(recipient, symmetricKey)
+		if err != nil {
+			return nil, fmt.Errorf("error encrypting symmetric key: %w", err)
+		}
+		log.Printf("[Encrypt] Encrypted Symmetric Key for %s (Hex): %x", recipient.DeviceUUID, wrapped.EncryptedKey)
+		wrappedKeys = append(wrappedKeys, wrapped)
 	}
+	return wrappedKeys, nil
+}
 
+// cbcWriter cifra em AES-CBC o texto claro recebido e grava o resultado
+// em out, com o IV à frente. Guarda apenas o bloco incompleto, de forma que
+// nem o conteúdo nem o pacote precisem ser montados em memória.
+type cbcWriter struct {
+	ctx     context.Context
+	mode    cipher.BlockMode
+	out     io.Writer
+	buf     []byte
+	partial []byte
+	n       int64
+}
+
+func newCBCWriter(ctx context.Context, symmetricKey []byte, out io.Writer) (*cbcWriter, error) {
 	// Create AES cipher
 	block, err := aes.NewCipher(symmetricKey)
 	if err != nil {
-		return nil, nil, nil, hash, fmt.Errorf("error creating AES cipher: %w", err)
+		return nil, fmt.Errorf("error creating AES cipher: %w", err)
 	}
 
 	// Generate IV
 	iv := make([]byte, aes.BlockSize)
 	if _, err := rand.Read(iv); err != nil {
-		return nil, nil, nil, hash, fmt.Errorf("error generating IV: %w", err)
+		return nil, fmt.Errorf("error generating IV: %w", err)
+	}
+	if _, err := out.Write(iv); err != nil {
+		return nil, fmt.Errorf("error writing IV: %w", err)
 	}
 
-	paddedData := padPKCS7(data, aes.BlockSize)
+	return &cbcWriter{
+		ctx:     ctx,
+		mode:    cipher.NewCBCEncrypter(block, iv),
+		out:     out,
+		partial: make([]byte, 0, aes.BlockSize),
+	}, nil
+}
 
-	// Encrypt data
-	encryptedData = make([]byte, len(paddedData))
-    mode := cipher.NewCBCEncrypter(block, iv)
-    mode.CryptBlocks(encryptedData, paddedData)
+func (c *cbcWriter) Write(p []byte) (int, error) {
+	written := len(p)
 
-	// Prepend IV to encrypted data
-	encryptedData = append(iv, encryptedData...)
+	if len(c.partial) > 0 {
+		k := min(aes.BlockSize-len(c.partial), len(p))
+		c.partial = append(c.partial, p[:k]...)
+		p = p[k:]
+		if len(c.partial) < aes.BlockSize {
+			c.n += int64(written)
+			return written, nil
+		}
+		if err := c.encrypt(c.partial); err != nil {
+			return 0, err
+		}
+		c.partial = c.partial[:0]
+	}
 
-	// Calculate hash
-	hash_256 := sha256.Sum256(encryptedData)
+	full := len(p) - len(p)%aes.BlockSize
+	for start := 0; start < full; start += progressChunk {
+		if err := c.encrypt(p[start:min(start+progressChunk, full)]); err != nil {
+			return 0, err
+		}
+	}
+	c.partial = append(c.partial, p[full:]...)
 
-	// Sign hash using TPM
-	signature, err = tpmMgr.Client.SignData(ctx, hash_256[:])
-	if err != nil {
-		return nil, nil, nil, hash_256, fmt.Errorf("error signing data: %w", err)
+	c.n += int64(written)
+	return written, nil
+}
+
+// encrypt cifra blocos completos e os grava em out, atendendo ao
+// cancelamento do contexto
+func (c *cbcWriter) encrypt(src []byte) error {
+	if len(src) == 0 {
+		return nil
+	}
+	if err := c.ctx.Err(); err != nil {
+		return err
 	}
+	if cap(c.buf) < len(src) {
+		c.buf = make([]byte, len(src))
+	}
+	dst := c.buf[:len(src)]
+	c.mode.CryptBlocks(dst, src)
+	if _, err := c.out.Write(dst); err != nil {
+		return fmt.Errorf("error writing encrypted data: %w", err)
+	}
+	return nil
+}
 
-	return encryptedData, encryptedKey, signature, hash, nil
+// Close aplica o padding PKCS7 ao último bloco e o grava
+func (c *cbcWriter) Close() error {
+	err := c.encrypt(padPKCS7(c.partial, aes.BlockSize))
+	c.partial = nil
+	return err
 }
 
 // padPKCS7 adiciona padding PKCS7
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+)
+
+func TestCBCWriterStreaming(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	plaintext := make([]byte, 1000)
+	for i := range plaintext {
+		plaintext[i] = byte(i)
+	}
+
+	// Escritas de tamanhos variados, cruzando as fronteiras dos blocos
+	writes := [][]int{{1000}, {1, 15, 16, 17, 951}, {7, 7, 7, 979}, {0, 16, 0, 984}}
+
+	for _, sizes := range writes {
+		var out bytes.Buffer
+		cw, err := newCBCWriter(context.Background(), key, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest := plaintext
+		for _, n := range sizes {
+			if _, err := cw.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			rest = rest[n:]
+		}
+		if cw.n != int64(len(plaintext)) {
+			t.Errorf("%v: contabilizados %d bytes, esperado %d", sizes, cw.n, len(plaintext))
+		}
+
+		if err := cw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		encrypted := out.Bytes()
+		if got, want := int64(len(encrypted)), cipherLength(int64(len(plaintext))); got != want {
+			t.Fatalf("%v: pacote com %d bytes, esperado %d", sizes, got, want)
+		}
+
+		block, _ := aes.NewCipher(key)
+		decrypted := make([]byte, len(encrypted)-aes.BlockSize)
+		cipher.NewCBCDecrypter(block, encrypted[:aes.BlockSize]).CryptBlocks(decrypted, encrypted[aes.BlockSize:])
+		got, err := unpadPKCS7(decrypted)
+		if err != nil {
+			t.Fatalf("%v: %v", sizes, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("%v: texto claro alterado pela cifra em fluxo", sizes)
+		}
+	}
+}
+
+func TestEnvelopeSizeTrailer(t *testing.T) {
+	header := &PackageHeader{Kind: PackageKindDirectory, SizeTrailer: true, Padding: PaddingPadme}
+	body := []byte("conteúdo comprimido")
+
+	buf := &bytes.Buffer{}
+	if err := writeEnvelopeHeader(buf, header); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(body)
+	if err := writeSizeTrailer(buf, 12345); err != nil {
+		t.Fatal(err)
+	}
+	suffix, _ := paddingSuffix(header.Padding, int64(buf.Len()))
+	buf.Write(suffix)
+
+	got, gotBody, err := openEnvelope(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OriginalSize != 12345 {
+		t.Errorf("tamanho original %d, esperado 12345", got.OriginalSize)
+	}
+	if !bytes.Equal(gotBody, body) {
+		t.Errorf("corpo %q, esperado %q", gotBody, body)
+	}
+}
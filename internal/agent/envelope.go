@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// envelopeMagic identifica pacotes com cabeçalho. Pacotes sem o prefixo são
+// tratados como legados, cujo texto claro é o conteúdo bruto do arquivo.
+const envelopeMagic = "TPMBNKR\x01"
+
+// maxEnvelopeHeader limita o tamanho do cabeçalho aceito na decriptação
+const maxEnvelopeHeader = 1 << 20
+
+const (
+	PackageKindFile      = "file"
+	PackageKindDirectory = "directory"
+)
+
+// PackageHeader descreve o conteúdo do pacote. Ele é gravado dentro do texto
+// claro, portanto é cifrado e assinado junto com os dados.
+type PackageHeader struct {
+	Kind     string `json:"kind"`
+	FileName string `json:"file_name"`
+	Archive  string `json:"archive,omitempty"`
+
+	// Compressão aplicada ao corpo antes da encriptação
+	Compression  string `json:"compression,omitempty"`
+	OriginalSize int64  `json:"original_size,omitempty"`
+
+	// Metadados do arquivo original, restaurados na decriptação
+	Attributes *FileAttributes `json:"attributes,omitempty"`
+
+	// Política de padding aplicada após o corpo, se houver
+	Padding string `json:"padding,omitempty"`
+
+	// SizeTrailer indica que o tamanho original segue o corpo em 8 bytes,
+	// pois conteúdos gerados em fluxo só o conhecem ao final
+	SizeTrailer bool `json:"size_trailer,omitempty"`
+}
+
+// sizeTrailerSize é o tamanho do campo com o tamanho original
+const sizeTrailerSize = 8
+
+// writeEnvelopeHeader grava o prefixo e o cabeçalho do pacote em w
+func writeEnvelopeHeader(w io.Writer, header *PackageHeader) error {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar cabeçalho: %w", err)
+	}
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(headerJSON)))
+
+	for _, chunk := range [][]byte{[]byte(envelopeMagic), size[:], headerJSON} {
+		if _, err := w.Write(chunk); err != nil {
+			return fmt.Errorf("erro ao gravar cabeçalho: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeSizeTrailer grava o tamanho original após o corpo
+func writeSizeTrailer(w io.Writer, originalSize int64) error {
+	var size [sizeTrailerSize]byte
+	binary.BigEndian.PutUint64(size[:], uint64(originalSize))
+	if _, err := w.Write(size[:]); err != nil {
+		return fmt.Errorf("erro ao gravar tamanho original: %w", err)
+	}
+	return nil
+}
+
+// openEnvelope separa cabeçalho e corpo do texto claro decriptado
+func openEnvelope(data []byte) (*PackageHeader, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(envelopeMagic)) {
+		return &PackageHeader{Kind: PackageKindFile}, data, nil
+	}
+
+	rest := data[len(envelopeMagic):]
+	if len(rest) < 4 {
+		return nil, nil, fmt.Errorf("cabeçalho do pacote truncado")
+	}
+
+	size := binary.BigEndian.Uint32(rest[:4])
+	rest = rest[4:]
+	if size > maxEnvelopeHeader || int(size) > len(rest) {
+		return nil, nil, fmt.Errorf("tamanho de cabeçalho inválido: %d", size)
+	}
+
+	var header PackageHeader
+	err := json.Unmarshal(rest[:size], &header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao decodificar cabeçalho: %w", err)
+	}
+	if header.Kind == "" {
+		header.Kind = PackageKindFile
+	}
+
+	body := rest[size:]
+	if header.Padding != "" && header.Padding != PaddingNone {
+		if body, err = stripPadding(body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if header.SizeTrailer {
+		if len(body) < sizeTrailerSize {
+			return nil, nil, fmt.Errorf("tamanho original truncado")
+		}
+		split := len(body) - sizeTrailerSize
+		header.OriginalSize = int64(binary.BigEndian.Uint64(body[split:]))
+		if header.OriginalSize < 0 {
+			return nil, nil, fmt.Errorf("tamanho original inválido: %d", header.OriginalSize)
+		}
+		body = body[:split]
+	}
+
+	return &header, body, nil
+}
@@ -0,0 +1,23 @@
+//go:build darwin
+
+package agent
+
+import "syscall"
+
+// filesystemInfo retorna o nome do sistema de arquivos de path e se ele é
+// copy-on-write. No macOS, o APFS é sempre copy-on-write.
+func filesystemInfo(path string) (string, bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false, err
+	}
+
+	var name []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), string(name) == "apfs", nil
+}
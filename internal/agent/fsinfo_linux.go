@@ -0,0 +1,26 @@
+//go:build linux
+
+package agent
+
+import "syscall"
+
+// Identificadores de sistemas de arquivos copy-on-write (statfs f_type)
+var copyOnWriteMagic = map[int64]string{
+	0x9123683e: "btrfs",
+	0x2fc12fc1: "zfs",
+	0xca451a4e: "bcachefs",
+}
+
+// filesystemInfo retorna o nome do sistema de arquivos de path, se
+// conhecido, e se ele é copy-on-write
+func filesystemInfo(path string) (string, bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false, err
+	}
+
+	if name, ok := copyOnWriteMagic[int64(st.Type)]; ok {
+		return name, true, nil
+	}
+	return "", false, nil
+}
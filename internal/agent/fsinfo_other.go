@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package agent
+
+import "errors"
+
+// filesystemInfo não consegue identificar o sistema de arquivos nesta
+// plataforma
+func filesystemInfo(path string) (string, bool, error) {
+	return "", false, errors.New("detecção de sistema de arquivos não suportada")
+}
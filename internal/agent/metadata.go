@@ -0,0 +1,292 @@
+package agent
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/types"
+)
+
+// metadataKeyLabel deriva da chave do pacote a chave dos metadados, para
+// que a mesma chave não seja usada em dois modos de cifra
+const metadataKeyLabel = "tpm-bunker-metadata-v1"
+
+// PackageMetadata são os metadados descritivos de um pacote. Eles são
+// cifrados com a chave do pacote e enviados à API, que vê apenas um nome
+// opaco, e decriptados localmente para exibir a listagem.
+type PackageMetadata struct {
+	FileName     string `json:"file_name"`
+	Kind         string `json:"kind"`
+	Compression  string `json:"compression,omitempty"`
+	OriginalSize int64  `json:"original_size"`
+	StoredSize   int64  `json:"stored_size"`
+	MimeType     string `json:"mime_type,omitempty"`
+	ModTime      string `json:"mod_time,omitempty"`
+
+	// Arquivo lógico e versão, ligada à operação da versão anterior
+	FileID              string `json:"file_id,omitempty"`
+	Version             int    `json:"version,omitempty"`
+	PreviousOperationID string `json:"previous_operation_id,omitempty"`
+}
+
+// opaqueName gera o identificador aleatório usado como nome do pacote no
+// servidor
+func opaqueName() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", fmt.Errorf("erro ao gerar nome opaco: %w", err)
+	}
+	return hex.EncodeToString(id[:]) + ".bin", nil
+}
+
+// labeledAEAD cria um AES-GCM com uma chave derivada da chave do pacote e
+// do rótulo informado
+func labeledAEAD(symmetricKey []byte, label string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, symmetricKey)
+	mac.Write([]byte(label))
+	key := mac.Sum(nil)
+	defer clear(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealMetadata cifra os metadados, ligando-os ao nome opaco do pacote
+func sealMetadata(symmetricKey []byte, objectName string, meta *PackageMetadata) (string, error) {
+	plaintext, err := json.Marshal(meta)
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar metadados: %w", err)
+	}
+
+	aead, err := labeledAEAD(symmetricKey, metadataKeyLabel)
+	if err != nil {
+		return "", fmt.Errorf("erro ao criar cifra de metadados: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("erro ao gerar nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(objectName))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openMetadata decifra metadados produzidos por sealMetadata
+func openMetadata(symmetricKey []byte, objectName string, sealed string) (*PackageMetadata, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("metadados mal formados: %w", err)
+	}
+
+	aead, err := labeledAEAD(symmetricKey, metadataKeyLabel)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar cifra de metadados: %w", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("metadados truncados")
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(objectName))
+	if err != nil {
+		return nil, fmt.Errorf("metadados inválidos: %w", err)
+	}
+
+	var meta PackageMetadata
+	if err := json.Unmarshal(plaintext, &meta); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar metadados: %w", err)
+	}
+	return &meta, nil
+}
+
+// metadataCache guarda os metadados já decriptados, evitando uma busca da
+// chave na API e uma operação no TPM por pacote a cada listagem. Ele
+// persiste entre sessões no índice de busca encriptado.
+type metadataCache struct {
+	mutex   sync.Mutex
+	entries map[string]*PackageMetadata
+	// changed indica entradas ainda não gravadas no índice
+	changed bool
+}
+
+func (c *metadataCache) get(operationID string) *PackageMetadata {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.entries[operationID]
+}
+
+func (c *metadataCache) put(operationID string, meta *PackageMetadata) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*PackageMetadata)
+	}
+	c.entries[operationID] = meta
+	c.changed = true
+}
+
+func (c *metadataCache) remove(operationID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[operationID]; ok {
+		delete(c.entries, operationID)
+		c.changed = true
+	}
+}
+
+// load acrescenta as entradas lidas do índice, sem sobrescrever as já
+// decriptadas nesta sessão
+func (c *metadataCache) load(entries map[string]*PackageMetadata) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*PackageMetadata, len(entries))
+	}
+	for id, meta := range entries {
+		if _, ok := c.entries[id]; !ok && meta != nil {
+			c.entries[id] = meta
+		}
+	}
+}
+
+// snapshot retorna as entradas a gravar no índice e as marca como gravadas
+func (c *metadataCache) snapshot() map[string]*PackageMetadata {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entries := make(map[string]*PackageMetadata, len(c.entries))
+	for id, meta := range c.entries {
+		entries[id] = meta
+	}
+	c.changed = false
+	return entries
+}
+
+// pending informa se há entradas ainda não gravadas no índice
+func (c *metadataCache) pending() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.changed
+}
+
+// packageKey abre no TPM a chave simétrica de uma operação
+func (a *Agent) packageKey(ctx context.Context, operationID string) ([]byte, error) {
+	wrapped, err := a.client.GetWrappedKey(ctx, a.deviceHeader(), operationID)
+	if err != nil {
+		return nil, err
+	}
+
+	symmetricKey, err := a.tpmMgr.Client.RSADecrypt(ctx, wrapped.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao decriptar chave simétrica: %w", err)
+	}
+	return symmetricKey, nil
+}
+
+// packageMetadata decripta os metadados de uma operação da listagem.
+// Pacotes anteriores à cifragem de metadados retornam nil.
+func (a *Agent) packageMetadata(operationID, objectName string, serverMeta map[string]string, key func() ([]byte, error)) (*PackageMetadata, error) {
+	if meta := a.metadata.get(operationID); meta != nil {
+		return meta, nil
+	}
+
+	sealed := serverMeta["encrypted_metadata"]
+	if sealed == "" {
+		return nil, nil
+	}
+
+	symmetricKey, err := key()
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := openMetadata(symmetricKey, objectName, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	a.metadata.put(operationID, meta)
+	return meta, nil
+}
+
+// describeOperation preenche op com os dados descritivos e as anotações do
+// pacote, decriptados localmente. Operações cujos metadados não podem ser
+// abertos mantêm o nome do servidor.
+func (a *Agent) describeOperation(ctx context.Context, op *types.Operation, serverMeta map[string]interface{}, annotation *api.AnnotationRecord) {
+	if op.FileName == "" {
+		return
+	}
+
+	// A chave do pacote é aberta no TPM no máximo uma vez, e só se algum
+	// dado não estiver em cache
+	var symmetricKey []byte
+	defer func() { clear(symmetricKey) }()
+	key := func() ([]byte, error) {
+		if symmetricKey == nil {
+			k, err := a.packageKey(ctx, op.ID)
+			if err != nil {
+				return nil, err
+			}
+			symmetricKey = k
+		}
+		return symmetricKey, nil
+	}
+
+	sealed := make(map[string]string)
+	for k, v := range serverMeta {
+		if s, ok := v.(string); ok {
+			sealed[k] = s
+		}
+	}
+
+	meta, err := a.packageMetadata(op.ID, op.FileName, sealed, key)
+	if err != nil {
+		log.Printf("Aviso: metadados da operação %s indisponíveis: %v", op.ID, err)
+	} else if meta != nil {
+		op.FileName = meta.FileName
+		op.Kind = meta.Kind
+		op.OriginalSize = meta.OriginalSize
+		op.MimeType = meta.MimeType
+		op.FileID = meta.FileID
+		op.Version = meta.Version
+	}
+
+	if annotation != nil && a.operations.seenAnnotation(op.ID, annotation.SignedAt) {
+		// A mesma anotação já foi verificada e decriptada
+		a.operations.keepAnnotation(op)
+		return
+	}
+	if annotation == nil {
+		// Uma anotação já vista não some: o servidor a omitiu
+		if a.operations.keepAnnotation(op) {
+			log.Printf("Aviso: anotações da operação %s omitidas pela API; mantidas as anteriores", op.ID)
+		}
+		return
+	}
+
+	// A listagem traz apenas pacotes deste dispositivo
+	ann, err := a.openAnnotation(ctx, op.ID, a.tpmMgr.DeviceUUID, annotation, key)
+	if err != nil {
+		log.Printf("Aviso: anotações da operação %s ignoradas: %v", op.ID, err)
+		a.operations.keepAnnotation(op)
+		return
+	}
+	if !a.operations.acceptAnnotation(op.ID, ann.UpdatedAt) {
+		log.Printf("Aviso: anotações da operação %s mais antigas que as já vistas; ignoradas", op.ID)
+		a.operations.keepAnnotation(op)
+		return
+	}
+	applyAnnotation(op, ann)
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OpenedPathPrefix é o caminho do servidor de assets da interface sob o
+// qual os conteúdos abertos em memória são servidos, aceitando intervalos
+const OpenedPathPrefix = "/opened/"
+
+// openedFile é o conteúdo decriptado de um pacote aberto para
+// visualização. O mutex de leitura é mantido enquanto uma requisição é
+// servida, para que o conteúdo não seja apagado no meio dela.
+type openedFile struct {
+	mutex    sync.RWMutex
+	fileName string
+	mimeType string
+	openedAt time.Time
+	data     []byte
+}
+
+// openedStore guarda os conteúdos abertos até serem fechados pelo
+// frontend ou até o encerramento do agente
+type openedStore struct {
+	mutex sync.Mutex
+	files map[string]*openedFile
+}
+
+func (s *openedStore) add(file *openedFile) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.files == nil {
+		s.files = make(map[string]*openedFile)
+	}
+	id := uuid.NewString()
+	s.files[id] = file
+	return id
+}
+
+func (s *openedStore) get(id string) *openedFile {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.files[id]
+}
+
+func (s *openedStore) remove(id string) *openedFile {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file := s.files[id]
+	delete(s.files, id)
+	return file
+}
+
+// wipe apaga o conteúdo de um arquivo aberto, esperando as leituras em
+// andamento terminarem
+func (f *openedFile) wipe() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	clear(f.data)
+	f.data = nil
+}
+
+// wipeAll fecha todos os conteúdos abertos
+func (s *openedStore) wipeAll() {
+	s.mutex.Lock()
+	files := s.files
+	s.files = nil
+	s.mutex.Unlock()
+
+	for _, file := range files {
+		file.wipe()
+	}
+}
+
+// ServeOpened serve um conteúdo aberto por Open no caminho
+// OpenedPathPrefix + ID. Requisições com Range recebem só o intervalo
+// pedido, de forma que a interface lê o conteúdo em partes.
+func (a *Agent) ServeOpened(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutPrefix(r.URL.Path, OpenedPathPrefix)
+	if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		http.NotFound(w, r)
+		return
+	}
+
+	file := a.opened.get(id)
+	if file == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file.mutex.RLock()
+	defer file.mutex.RUnlock()
+	if file.data == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", file.mimeType)
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, file.fileName, file.openedAt, bytes.NewReader(file.data))
+}
+
+// CloseOpened apaga da memória um conteúdo aberto por Open
+func (a *Agent) CloseOpened(id string) error {
+	file := a.opened.remove(id)
+	if file == nil {
+		return fmt.Errorf("arquivo aberto não encontrado: %s", id)
+	}
+	file.wipe()
+	return nil
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeOpened(t *testing.T) {
+	a := &Agent{}
+	id := a.opened.add(&openedFile{
+		fileName: "nota.txt",
+		mimeType: "text/plain",
+		openedAt: time.Now(),
+		data:     []byte("conteúdo aberto"),
+	})
+
+	tests := []struct {
+		name       string
+		path       string
+		rangeSpec  string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "conteúdo inteiro", path: OpenedPathPrefix + id, wantStatus: http.StatusOK, wantBody: "conteúdo aberto"},
+		{name: "intervalo", path: OpenedPathPrefix + id, rangeSpec: "bytes=0-3", wantStatus: http.StatusPartialContent, wantBody: "cont"},
+		{name: "ID desconhecido", path: OpenedPathPrefix + "outro", wantStatus: http.StatusNotFound},
+		{name: "fora do prefixo", path: "/" + id, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.rangeSpec != "" {
+				req.Header.Set("Range", tt.rangeSpec)
+			}
+			rec := httptest.NewRecorder()
+			a.ServeOpened(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, esperado %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("corpo = %q, esperado %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	file := a.opened.get(id)
+	if err := a.CloseOpened(id); err != nil {
+		t.Fatalf("CloseOpened: %v", err)
+	}
+	if file.data != nil {
+		t.Errorf("conteúdo não foi apagado ao fechar")
+	}
+
+	rec := httptest.NewRecorder()
+	a.ServeOpened(rec, httptest.NewRequest(http.MethodGet, OpenedPathPrefix+id, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status após fechar = %d, esperado %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,499 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	// operationSyncPageSize é o tamanho das páginas pedidas à API durante a
+	// sincronização do cache, o máximo aceito pelo servidor
+	operationSyncPageSize = 100
+	defaultPageSize       = 50
+	maxPageSize           = 500
+)
+
+// operationCache guarda a listagem de operações com os nomes já
+// decriptados. Ela é atualizada de forma incremental com o cursor retornado
+// pela API; sem cursor, cada sincronização relê a listagem completa. O
+// cache e o cursor persistem entre sessões no índice de busca encriptado.
+type operationCache struct {
+	// syncMutex serializa sincronizações; mutex protege os campos abaixo
+	syncMutex sync.Mutex
+	mutex     sync.Mutex
+
+	loaded     bool
+	operations map[string]*types.Operation
+	cursor     string
+
+	// Índice invertido: termo -> IDs das operações que o contêm
+	tokens map[string]map[string]struct{}
+
+	// Instante da anotação mais recente já aceita, por operação
+	annotated map[string]string
+}
+
+// syncOperations atualiza o cache com as alterações desde o último cursor
+func (a *Agent) syncOperations(ctx context.Context) error {
+	c := &a.operations
+	c.syncMutex.Lock()
+	defer c.syncMutex.Unlock()
+
+	a.loadSearchIndex(ctx)
+
+	c.mutex.Lock()
+	since := c.cursor
+	operations := make(map[string]*types.Operation, len(c.operations))
+	if since != "" {
+		for id, op := range c.operations {
+			operations[id] = op
+		}
+	}
+	c.mutex.Unlock()
+	full := since == ""
+
+	// O cursor vem do servidor e avança com cada página: um pacote alterado
+	// durante a sincronização reaparece depois dele, em vez de ser pulado
+	cursor := since
+	for {
+		query := &api.OperationQuery{PageSize: operationSyncPageSize, Sync: true, Since: cursor}
+		result, err := a.client.ListOperations(ctx, a.deviceHeader(), query)
+		if err != nil {
+			return err
+		}
+
+		for i := range result.Results {
+			op := a.operationFromRecord(ctx, &result.Results[i])
+			operations[op.ID] = op
+		}
+		for _, id := range result.Deleted {
+			delete(operations, id)
+			a.metadata.remove(id)
+		}
+
+		if result.Next == "" {
+			if result.Cursor != "" {
+				cursor = result.Cursor
+			}
+			break
+		}
+		if result.Cursor == "" || result.Cursor == cursor {
+			return fmt.Errorf("cursor de sincronização não avançou")
+		}
+		cursor = result.Cursor
+	}
+
+	c.set(operations, cursor)
+	log.Printf("Operações sincronizadas: %d (completa: %v)", len(operations), full)
+
+	if err := a.saveSearchIndex(ctx); err != nil {
+		log.Printf("Aviso: erro ao gravar índice de busca: %v", err)
+	}
+	return nil
+}
+
+// operationFromRecord converte uma operação da API, decriptando o nome e os
+// metadados, que no servidor são opacos
+func (a *Agent) operationFromRecord(ctx context.Context, record *api.OperationRecord) *types.Operation {
+	op := &types.Operation{
+		ID:            record.ID,
+		OperationType: record.OperationType,
+		Status:        record.Status,
+		ErrorMessage:  record.ErrorMessage,
+		CreatedAt:     record.CreatedAt,
+		UpdatedAt:     record.UpdatedAt,
+		FileName:      record.FileName,
+		// A API informa o tamanho em MB
+		FileSize: int64(math.Round(record.FileSize * 1024 * 1024)),
+	}
+	a.describeOperation(ctx, op, record.Metadata, record.Annotation)
+	return op
+}
+
+// set substitui o conteúdo do cache e reconstrói o índice invertido
+func (c *operationCache) set(operations map[string]*types.Operation, cursor string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setLocked(operations, cursor)
+}
+
+func (c *operationCache) setLocked(operations map[string]*types.Operation, cursor string) {
+	tokens := make(map[string]map[string]struct{})
+	for id, op := range operations {
+		for _, token := range operationTokens(op) {
+			if tokens[token] == nil {
+				tokens[token] = make(map[string]struct{})
+			}
+			tokens[token][id] = struct{}{}
+		}
+	}
+
+	c.operations = operations
+	c.cursor = cursor
+	c.tokens = tokens
+}
+
+// merge acrescenta ao cache operações obtidas fora da sincronização, sem
+// mover o cursor: a próxima sincronização ainda entrega as alterações
+// anteriores a elas
+func (c *operationCache) merge(ops []*types.Operation) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	operations := make(map[string]*types.Operation, len(c.operations)+len(ops))
+	for id, op := range c.operations {
+		operations[id] = op
+	}
+	for _, op := range ops {
+		operations[op.ID] = op
+	}
+	c.setLocked(operations, c.cursor)
+}
+
+// forget retira uma operação do cache
+func (c *operationCache) forget(operationID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.operations, operationID)
+	delete(c.annotated, operationID)
+	for _, ids := range c.tokens {
+		delete(ids, operationID)
+	}
+}
+
+// annotate atualiza as anotações de uma operação em cache
+func (c *operationCache) annotate(operationID string, ann *types.Annotation) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	op, ok := c.operations[operationID]
+	if !ok {
+		return false
+	}
+	updated := *op
+	applyAnnotation(&updated, ann)
+
+	operations := make(map[string]*types.Operation, len(c.operations))
+	for id, op := range c.operations {
+		operations[id] = op
+	}
+	operations[operationID] = &updated
+	c.setLocked(operations, c.cursor)
+	return true
+}
+
+// acceptAnnotation registra o instante de uma anotação e informa se ela não
+// é mais antiga que a última aceita para a operação. Uma anotação antiga
+// continua com assinatura válida, e o servidor poderia reenviá-la no lugar
+// da atual.
+func (c *operationCache) acceptAnnotation(operationID, signedAt string) bool {
+	t, err := time.Parse(time.RFC3339, signedAt)
+	if err != nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if last, ok := c.annotated[operationID]; ok {
+		if lt, err := time.Parse(time.RFC3339, last); err == nil && t.Before(lt) {
+			return false
+		}
+	}
+	if c.annotated == nil {
+		c.annotated = make(map[string]string)
+	}
+	c.annotated[operationID] = signedAt
+	return true
+}
+
+// seenAnnotation informa se a anotação assinada em signedAt é a última já
+// aceita para a operação, dispensando abri-la de novo
+func (c *operationCache) seenAnnotation(operationID, signedAt string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	last, ok := c.annotated[operationID]
+	return ok && last == signedAt
+}
+
+// keepAnnotation copia para op as anotações em cache da mesma operação,
+// retornando false se nenhuma anotação foi aceita para ela
+func (c *operationCache) keepAnnotation(op *types.Operation) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.annotated[op.ID]; !ok {
+		return false
+	}
+	if cached, ok := c.operations[op.ID]; ok {
+		op.Tags = cached.Tags
+		op.Notes = cached.Notes
+		op.Classification = cached.Classification
+	}
+	return true
+}
+
+// snapshot retorna cópias das operações em cache
+func (c *operationCache) snapshot() []types.Operation {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	operations := make([]types.Operation, 0, len(c.operations))
+	for _, op := range c.operations {
+		operations = append(operations, *op)
+	}
+	return operations
+}
+
+// ListOperations retorna uma página da listagem de operações. Filtros por
+// tipo, estado e data, ordenados por data de criação, são paginados pelo
+// servidor, e só a página pedida é buscada. Nomes e anotações só existem
+// decriptados neste dispositivo: filtrar ou ordenar por eles usa o cache
+// local, sincronizado antes da consulta.
+func (a *Agent) ListOperations(ctx context.Context, filter types.OperationFilter) (*types.OperationPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	pageSize := filter.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	page := filter.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	if serverFilter(filter) {
+		return a.listServerOperations(ctx, filter, page, pageSize)
+	}
+
+	if err := a.syncOperations(ctx); err != nil {
+		return nil, err
+	}
+
+	matches, err := filterOperations(a.operations.snapshot(), filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := sortOperations(matches, filter.Sort); err != nil {
+		return nil, err
+	}
+
+	start := (page - 1) * pageSize
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + pageSize
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	return &types.OperationPage{
+		Operations: matches[start:end],
+		Total:      len(matches),
+		Page:       page,
+		PageSize:   pageSize,
+	}, nil
+}
+
+// serverFilter informa se o filtro pode ser aplicado pelo servidor
+func serverFilter(filter types.OperationFilter) bool {
+	if filter.Name != "" || filter.Tag != "" || filter.Classification != "" {
+		return false
+	}
+	switch filter.Sort {
+	case "", "created_at", "-created_at":
+		return true
+	}
+	return false
+}
+
+// listServerOperations busca uma página filtrada e paginada pelo servidor e
+// a acrescenta ao cache
+func (a *Agent) listServerOperations(ctx context.Context, filter types.OperationFilter, page, pageSize int) (*types.OperationPage, error) {
+	// O servidor limita o tamanho das páginas
+	if pageSize > operationSyncPageSize {
+		pageSize = operationSyncPageSize
+	}
+
+	query := &api.OperationQuery{
+		Page:     page,
+		PageSize: pageSize,
+		Type:     strings.ToUpper(filter.Type),
+		Status:   strings.ToUpper(filter.Status),
+		Ordering: filter.Sort,
+	}
+	var err error
+	if filter.From != "" {
+		if query.CreatedFrom, err = parseFilterDate(filter.From, false); err != nil {
+			return nil, err
+		}
+	}
+	if filter.To != "" {
+		if query.CreatedTo, err = parseFilterDate(filter.To, true); err != nil {
+			return nil, err
+		}
+	}
+
+	a.loadSearchIndex(ctx)
+
+	result, err := a.client.ListOperations(ctx, a.deviceHeader(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := make([]*types.Operation, 0, len(result.Results))
+	operations := make([]types.Operation, 0, len(result.Results))
+	for i := range result.Results {
+		op := a.operationFromRecord(ctx, &result.Results[i])
+		fetched = append(fetched, op)
+		operations = append(operations, *op)
+	}
+	a.operations.merge(fetched)
+
+	if a.metadata.pending() {
+		if err := a.saveSearchIndex(ctx); err != nil {
+			log.Printf("Aviso: erro ao gravar índice de busca: %v", err)
+		}
+	}
+
+	return &types.OperationPage{
+		Operations: operations,
+		Total:      result.Count,
+		Page:       page,
+		PageSize:   pageSize,
+	}, nil
+}
+
+// filterOperations retorna as operações que atendem ao filtro
+func filterOperations(operations []types.Operation, filter types.OperationFilter) ([]types.Operation, error) {
+	var from, to time.Time
+	var err error
+	if filter.From != "" {
+		if from, err = parseFilterDate(filter.From, false); err != nil {
+			return nil, err
+		}
+	}
+	if filter.To != "" {
+		if to, err = parseFilterDate(filter.To, true); err != nil {
+			return nil, err
+		}
+	}
+	name := strings.ToLower(strings.TrimSpace(filter.Name))
+
+	matches := make([]types.Operation, 0, len(operations))
+	for _, op := range operations {
+		if filter.Type != "" && !strings.EqualFold(op.OperationType, filter.Type) {
+			continue
+		}
+		if filter.Status != "" && !strings.EqualFold(op.Status, filter.Status) {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(op.FileName), name) {
+			continue
+		}
+		if filter.Tag != "" && !hasTag(op.Tags, filter.Tag) {
+			continue
+		}
+		if filter.Classification != "" && !strings.EqualFold(op.Classification, filter.Classification) {
+			continue
+		}
+		if !from.IsZero() || !to.IsZero() {
+			created, err := parseTimestamp(op.CreatedAt)
+			if err != nil {
+				continue
+			}
+			if !from.IsZero() && created.Before(from) {
+				continue
+			}
+			if !to.IsZero() && !created.Before(to) {
+				continue
+			}
+		}
+		matches = append(matches, op)
+	}
+	return matches, nil
+}
+
+// sortOperations ordena as operações pelo campo informado; o padrão é da
+// mais recente para a mais antiga
+func sortOperations(operations []types.Operation, order string) error {
+	if order == "" {
+		order = "-created_at"
+	}
+	desc := strings.HasPrefix(order, "-")
+	field := strings.TrimPrefix(order, "-")
+
+	var less func(a, b *types.Operation) bool
+	switch field {
+	case "created_at":
+		less = func(a, b *types.Operation) bool {
+			ta, _ := parseTimestamp(a.CreatedAt)
+			tb, _ := parseTimestamp(b.CreatedAt)
+			return ta.Before(tb)
+		}
+	case "file_name":
+		less = func(a, b *types.Operation) bool {
+			return strings.ToLower(a.FileName) < strings.ToLower(b.FileName)
+		}
+	case "file_size":
+		less = func(a, b *types.Operation) bool { return a.FileSize < b.FileSize }
+	default:
+		return fmt.Errorf("ordenação inválida: %s", order)
+	}
+
+	sort.SliceStable(operations, func(i, j int) bool {
+		if desc {
+			return less(&operations[j], &operations[i])
+		}
+		return less(&operations[i], &operations[j])
+	})
+	return nil
+}
+
+// parseTimestamp interpreta as datas da API, que podem vir sem fuso
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("data inválida: %s", value)
+}
+
+// parseFilterDate interpreta um limite do filtro de datas. Datas sem hora
+// cobrem o dia inteiro quando usadas como limite final.
+func parseFilterDate(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("data inválida no filtro: %s", value)
+}
+
+// hasTag verifica se tag está entre as etiquetas, sem diferenciar
+// maiúsculas
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	// OutboxEvent é o evento emitido quando o estado da fila de saída muda
+	OutboxEvent = "outbox_state"
+
+	outboxMinBackoff = 5 * time.Second
+	outboxMaxBackoff = 5 * time.Minute
+
+	// outboxIdleCheck é o intervalo de verificação com a fila em dia
+	outboxIdleCheck = 5 * time.Minute
+)
+
+// outbox é a fila de saída: pacotes encriptados e assinados que aguardam
+// envio, gravados como transferências pendentes. Um worker em segundo plano
+// os envia quando há conexão, com espera exponencial entre falhas.
+type outbox struct {
+	wakeup chan struct{}
+
+	mutex sync.Mutex
+	state types.OutboxState
+}
+
+func newOutbox() *outbox {
+	return &outbox{wakeup: make(chan struct{}, 1)}
+}
+
+// wake pede ao worker uma nova tentativa imediata
+func (o *outbox) wake() {
+	if o == nil {
+		return
+	}
+	select {
+	case o.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// SetNotifier define a função que recebe os eventos do agente, como o
+// estado da fila de saída
+func (a *Agent) SetNotifier(notify func(event string, data interface{})) {
+	a.notifyMutex.Lock()
+	a.notify = notify
+	a.notifyMutex.Unlock()
+}
+
+func (a *Agent) emit(event string, data interface{}) {
+	a.notifyMutex.Lock()
+	notify := a.notify
+	a.notifyMutex.Unlock()
+	if notify != nil {
+		notify(event, data)
+	}
+}
+
+// updateOutbox altera o estado da fila e o publica
+func (a *Agent) updateOutbox(update func(state *types.OutboxState)) {
+	if a.outbox == nil {
+		return
+	}
+	a.outbox.mutex.Lock()
+	update(&a.outbox.state)
+	state := a.outbox.state
+	a.outbox.mutex.Unlock()
+
+	a.emit(OutboxEvent, state)
+}
+
+// OutboxState retorna o estado atual da fila de saída
+func (a *Agent) OutboxState() types.OutboxState {
+	if a.outbox == nil {
+		return types.OutboxState{}
+	}
+	a.outbox.mutex.Lock()
+	defer a.outbox.mutex.Unlock()
+	return a.outbox.state
+}
+
+// ResumeTransfers pede ao worker que tente agora as transferências
+// pendentes
+func (a *Agent) ResumeTransfers() {
+	a.outbox.wake()
+}
+
+// pendingTransfers conta os envios na fila e o total de transferências
+// pendentes
+func pendingTransfers() (uploads, total int) {
+	transfers, err := loadTransfers()
+	if err != nil {
+		return 0, 0
+	}
+	for _, t := range transfers {
+		if t.Direction == "upload" {
+			uploads++
+		}
+	}
+	return uploads, len(transfers)
+}
+
+// runOutbox é o worker da fila de saída
+func (a *Agent) runOutbox(ctx context.Context) {
+	a.removeUnqueuedUploads()
+
+	var backoff time.Duration
+	for {
+		wait := outboxIdleCheck
+		if err := a.syncOutbox(ctx); err != nil {
+			if backoff == 0 {
+				backoff = outboxMinBackoff
+			} else if backoff *= 2; backoff > outboxMaxBackoff {
+				backoff = outboxMaxBackoff
+			}
+			// Variação aleatória de até 20% evita tentativas sincronizadas
+			wait = backoff + time.Duration(rand.Int63n(int64(backoff)/5+1))
+			log.Printf("Fila de saída: nova tentativa em %s: %v", wait.Round(time.Second), err)
+		} else {
+			backoff = 0
+		}
+
+		a.updateOutbox(func(state *types.OutboxState) {
+			state.NextAttempt = time.Now().Add(wait).UTC().Format(time.RFC3339)
+		})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-a.outbox.wakeup:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// syncOutbox envia os pacotes pendentes, e conclui recebimentos
+// interrompidos, se houver conexão
+func (a *Agent) syncOutbox(ctx context.Context) error {
+	pending, total := pendingTransfers()
+	a.updateOutbox(func(state *types.OutboxState) { state.Pending = pending })
+	if total == 0 {
+		return nil
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	online := a.client.CheckConnection(checkCtx)
+	cancel()
+	if !online {
+		a.updateOutbox(func(state *types.OutboxState) {
+			state.Online = false
+			state.LastError = "sem conexão com a API"
+		})
+		return fmt.Errorf("sem conexão com a API")
+	}
+
+	a.updateOutbox(func(state *types.OutboxState) {
+		state.Online = true
+		state.Syncing = true
+	})
+	err := a.processTransfers(ctx)
+
+	pending, _ = pendingTransfers()
+	a.updateOutbox(func(state *types.OutboxState) {
+		state.Syncing = false
+		state.Pending = pending
+		state.LastError = ""
+		if err != nil {
+			state.LastError = err.Error()
+		}
+	})
+	return err
+}
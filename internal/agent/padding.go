@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Políticas de padding que escondem o tamanho exato do conteúdo
+const (
+	PaddingNone = "none"
+	// PaddingPadme usa o Padmé, com sobrecarga máxima de cerca de 12%
+	PaddingPadme = "padme"
+	// PaddingPow2 arredonda para a próxima potência de dois, com
+	// sobrecarga de até 100%
+	PaddingPow2 = "pow2"
+)
+
+// paddingTrailerSize é o tamanho do campo que registra o padding aplicado
+const paddingTrailerSize = 8
+
+// validPadding indica se a política é conhecida
+func validPadding(policy string) bool {
+	switch policy {
+	case "", PaddingNone, PaddingPadme, PaddingPow2:
+		return true
+	}
+	return false
+}
+
+// cipherLength retorna o tamanho do pacote cifrado, com IV e padding PKCS7,
+// para um texto claro de n bytes
+func cipherLength(n int64) int64 {
+	return aes.BlockSize + (n/aes.BlockSize+1)*aes.BlockSize
+}
+
+// bucketLength retorna o tamanho cifrado de destino segundo a política,
+// sempre múltiplo do bloco do AES
+func bucketLength(policy string, n int64) int64 {
+	var bucket int64
+	switch policy {
+	case PaddingPow2:
+		bucket = 1 << bits.Len64(uint64(n-1))
+	case PaddingPadme:
+		e := bits.Len64(uint64(n)) - 1
+		s := bits.Len64(uint64(e))
+		var mask int64
+		if e >= s {
+			mask = int64(1)<<(e-s) - 1
+		}
+		bucket = (n + mask) &^ mask
+	default:
+		return n
+	}
+
+	if rem := bucket % aes.BlockSize; rem != 0 {
+		bucket += aes.BlockSize - rem
+	}
+	return bucket
+}
+
+// paddingSuffix retorna os zeros e o trailer com o total acrescentado que,
+// gravados após n bytes de texto claro, levam o pacote cifrado exatamente ao
+// tamanho do bucket, e a sobrecarga em bytes no pacote cifrado
+func paddingSuffix(policy string, n int64) ([]byte, int64) {
+	unpadded := cipherLength(n + paddingTrailerSize)
+	bucket := bucketLength(policy, unpadded)
+
+	// Com bucket-17 bytes de texto claro, o PKCS7 acrescenta um único byte
+	// e o IV completa o bucket
+	target := bucket - aes.BlockSize - 1
+	padLen := target - n
+
+	suffix := make([]byte, padLen)
+	binary.BigEndian.PutUint64(suffix[padLen-paddingTrailerSize:], uint64(padLen))
+	return suffix, bucket - unpadded
+}
+
+// stripPadding remove o padding acrescentado por paddingSuffix
+func stripPadding(body []byte) ([]byte, error) {
+	if len(body) < paddingTrailerSize {
+		return nil, fmt.Errorf("padding truncado")
+	}
+
+	padLen := binary.BigEndian.Uint64(body[len(body)-paddingTrailerSize:])
+	if padLen < paddingTrailerSize || padLen > uint64(len(body)) {
+		return nil, fmt.Errorf("tamanho de padding inválido: %d", padLen)
+	}
+	return body[:len(body)-int(padLen)], nil
+}
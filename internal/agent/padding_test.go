@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestBucketLength(t *testing.T) {
+	tests := []struct {
+		policy string
+		n      int64
+		want   int64
+	}{
+		{policy: PaddingNone, n: 100, want: 100},
+		{policy: "", n: 100, want: 100},
+		{policy: PaddingPow2, n: 1, want: 16},
+		{policy: PaddingPow2, n: 16, want: 16},
+		{policy: PaddingPow2, n: 17, want: 32},
+		{policy: PaddingPow2, n: 100, want: 128},
+		{policy: PaddingPow2, n: 1000, want: 1024},
+		{policy: PaddingPow2, n: 1 << 20, want: 1 << 20},
+		{policy: PaddingPow2, n: 1<<20 + 1, want: 1 << 21},
+		{policy: PaddingPadme, n: 16, want: 16},
+		{policy: PaddingPadme, n: 33, want: 48},
+		{policy: PaddingPadme, n: 100, want: 112},
+		{policy: PaddingPadme, n: 1000, want: 1024},
+		{policy: PaddingPadme, n: 1 << 20, want: 1 << 20},
+		// 2^20+1: expoente 20, 5 bits de mantissa preservados
+		{policy: PaddingPadme, n: 1<<20 + 1, want: 1<<20 + 1<<15},
+	}
+
+	for _, tt := range tests {
+		got := bucketLength(tt.policy, tt.n)
+		if got != tt.want {
+			t.Errorf("bucketLength(%q, %d) = %d, esperado %d", tt.policy, tt.n, got, tt.want)
+		}
+		if tt.policy == PaddingPow2 || tt.policy == PaddingPadme {
+			if got%aes.BlockSize != 0 {
+				t.Errorf("bucketLength(%q, %d) = %d não é múltiplo do bloco", tt.policy, tt.n, got)
+			}
+			if got < tt.n {
+				t.Errorf("bucketLength(%q, %d) = %d menor que a entrada", tt.policy, tt.n, got)
+			}
+		}
+	}
+}
+
+func TestPaddingRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, 7, 8, 15, 16, 17, 100, 1000, 4095, 4096, 65537}
+
+	for _, policy := range []string{PaddingNone, PaddingPadme, PaddingPow2} {
+		for _, size := range sizes {
+			plaintext := bytes.Repeat([]byte{0xAB}, size)
+
+			suffix, overhead := paddingSuffix(policy, int64(size))
+			padded := append(append([]byte{}, plaintext...), suffix...)
+
+			// O pacote cifrado deve ter exatamente o tamanho do bucket
+			unpadded := cipherLength(int64(size) + paddingTrailerSize)
+			bucket := bucketLength(policy, unpadded)
+			if got := cipherLength(int64(len(padded))); got != bucket {
+				t.Errorf("%s/%d: tamanho cifrado %d, esperado %d", policy, size, got, bucket)
+			}
+			if overhead != bucket-unpadded {
+				t.Errorf("%s/%d: sobrecarga %d, esperada %d", policy, size, overhead, bucket-unpadded)
+			}
+
+			got, err := stripPadding(padded)
+			if err != nil {
+				t.Fatalf("%s/%d: stripPadding: %v", policy, size, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("%s/%d: conteúdo alterado pelo padding", policy, size)
+			}
+		}
+	}
+}
+
+func TestStripPaddingInvalid(t *testing.T) {
+	trailer := func(body []byte, padLen uint64) []byte {
+		out := append([]byte{}, body...)
+		var size [paddingTrailerSize]byte
+		binary.BigEndian.PutUint64(size[:], padLen)
+		return append(out, size[:]...)
+	}
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "vazio", body: nil},
+		{name: "menor que o trailer", body: []byte{1, 2, 3}},
+		{name: "padding menor que o trailer", body: trailer([]byte("abc"), 4)},
+		{name: "padding maior que o corpo", body: trailer([]byte("abc"), 12)},
+		{name: "padding enorme", body: trailer(nil, 1<<63)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := stripPadding(tt.body); err == nil {
+				t.Fatalf("stripPadding = %q, esperado erro", got)
+			}
+		})
+	}
+}
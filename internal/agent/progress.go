@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"tpm-bunker/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ProgressEvent é o evento com o andamento de uma operação longa
+	ProgressEvent = "operation_progress"
+
+	// progressInterval limita a frequência dos eventos de uma operação
+	progressInterval = 250 * time.Millisecond
+
+	// progressChunk é o tamanho dos blocos lidos e cifrados entre
+	// verificações de cancelamento
+	progressChunk = 1 << 20
+)
+
+// Fases reportadas pelas operações
+const (
+	PhaseRead     = "read"
+	PhaseEncrypt  = "encrypt"
+	PhaseSign     = "sign"
+	PhaseUpload   = "upload"
+	PhaseDownload = "download"
+	PhaseVerify   = "verify"
+	PhaseDecrypt  = "decrypt"
+	PhaseWrite    = "write"
+)
+
+// cancelStore guarda o cancelamento das operações e lotes em andamento
+type cancelStore struct {
+	mutex   sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func (s *cancelStore) add(id string, cancel context.CancelFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cancels == nil {
+		s.cancels = make(map[string]context.CancelFunc)
+	}
+	s.cancels[id] = cancel
+}
+
+func (s *cancelStore) done(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.cancels, id)
+}
+
+func (s *cancelStore) cancel(id string) bool {
+	s.mutex.Lock()
+	cancel, ok := s.cancels[id]
+	s.mutex.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// progress acompanha uma operação e publica seu andamento. Viaja no
+// contexto, de forma que as etapas internas reportem sem receber o
+// acompanhamento como parâmetro; todos os métodos aceitam receptor nil.
+type progress struct {
+	agent  *Agent
+	id     string
+	kind   string
+	target string
+	stop   context.CancelFunc
+
+	mutex      sync.Mutex
+	phase      string
+	done       int64
+	total      int64
+	phaseStart time.Time
+	lastEmit   time.Time
+	cancelled  bool
+}
+
+type progressKey struct{}
+
+// errOperationCancelled é o erro de uma operação cancelada pelo usuário
+var errOperationCancelled = errors.New("operação cancelada")
+
+// track registra uma operação cancelável por CancelOperation. kind é
+// encrypt ou decrypt; target é o caminho ou a operação de origem. O
+// contexto retornado carrega o acompanhamento; finish deve ser chamado ao
+// fim, com o endereço do erro da operação.
+func (a *Agent) track(ctx context.Context, kind, target string) (context.Context, *progress) {
+	ctx, stop := context.WithCancel(ctx)
+	p := &progress{
+		agent:  a,
+		id:     uuid.NewString(),
+		kind:   kind,
+		target: target,
+		stop:   stop,
+	}
+	a.running.add(p.id, p.cancel)
+
+	p.emit(true, false, "")
+	return context.WithValue(ctx, progressKey{}, p), p
+}
+
+// progressFrom retorna o acompanhamento da operação em ctx, ou nil
+func progressFrom(ctx context.Context) *progress {
+	p, _ := ctx.Value(progressKey{}).(*progress)
+	return p
+}
+
+// cancel atende a CancelOperation
+func (p *progress) cancel() {
+	p.mutex.Lock()
+	p.cancelled = true
+	p.mutex.Unlock()
+	p.stop()
+}
+
+// wasCancelled indica se o usuário cancelou a operação
+func (p *progress) wasCancelled() bool {
+	if p == nil {
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.cancelled
+}
+
+// setPhase inicia uma fase com total bytes a processar (0 se desconhecido)
+func (p *progress) setPhase(phase string, total int64) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	p.phase = phase
+	p.done = 0
+	p.total = total
+	p.phaseStart = time.Now()
+	p.mutex.Unlock()
+
+	p.emit(true, false, "")
+}
+
+// add contabiliza n bytes processados na fase atual
+func (p *progress) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	p.done += n
+	p.mutex.Unlock()
+
+	p.emit(false, false, "")
+}
+
+// finish publica o fim da operação e libera seu cancelamento. Se o
+// usuário cancelou a operação, *err passa a ser errOperationCancelled.
+func (p *progress) finish(err *error) {
+	if p == nil {
+		return
+	}
+	if *err != nil && p.wasCancelled() {
+		*err = errOperationCancelled
+	}
+	msg := ""
+	if *err != nil {
+		msg = (*err).Error()
+	}
+	p.emit(true, true, msg)
+	p.agent.running.done(p.id)
+	p.stop()
+}
+
+// emit publica o andamento; sem force, no máximo a cada progressInterval
+func (p *progress) emit(force, done bool, errMsg string) {
+	p.mutex.Lock()
+	now := time.Now()
+	if !force && now.Sub(p.lastEmit) < progressInterval {
+		p.mutex.Unlock()
+		return
+	}
+	p.lastEmit = now
+
+	event := types.OperationProgress{
+		ID:         p.id,
+		Kind:       p.kind,
+		Target:     p.target,
+		Phase:      p.phase,
+		BytesDone:  p.done,
+		BytesTotal: p.total,
+		Done:       done,
+		Error:      errMsg,
+		Cancelled:  p.cancelled,
+	}
+	// Estimativa pela taxa média da fase atual
+	elapsed := now.Sub(p.phaseStart).Seconds()
+	if !done && p.total > 0 && p.done > 0 && elapsed > 0 {
+		rate := float64(p.done) / elapsed
+		event.ETASeconds = int64(float64(p.total-p.done) / rate)
+	}
+	p.mutex.Unlock()
+
+	p.agent.emit(ProgressEvent, event)
+}
+
+// CancelOperation cancela uma operação ou lote em andamento pelo ID
+// publicado nos eventos de progresso
+func (a *Agent) CancelOperation(id string) error {
+	if !a.running.cancel(id) {
+		return fmt.Errorf("operação não encontrada: %s", id)
+	}
+	return nil
+}
+
+// cryptBlocks aplica mode a src em blocos, reportando o andamento e
+// atendendo ao cancelamento de ctx. O modo guarda o encadeamento entre
+// chamadas, então o resultado é o mesmo de uma única chamada.
+func cryptBlocks(ctx context.Context, mode cipher.BlockMode, dst, src []byte) error {
+	p := progressFrom(ctx)
+	for start := 0; start < len(src); start += progressChunk {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(start+progressChunk, len(src))
+		mode.CryptBlocks(dst[start:end], src[start:end])
+		p.add(int64(end - start))
+	}
+	return nil
+}
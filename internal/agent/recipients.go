@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/tpm"
+	"tpm-bunker/internal/types"
+)
+
+// errDeviceInactive indica um dispositivo desativado no registro
+var errDeviceInactive = errors.New("dispositivo inativo")
+
+// errRecipientKeyChanged indica que o registro publica para um destinatário
+// uma chave de encriptação diferente da confirmada pelo usuário
+var errRecipientKeyChanged = errors.New("chave de encriptação alterada; confirme a nova impressão digital")
+
+// Recipient é um dispositivo capaz de abrir um pacote
+type Recipient struct {
+	DeviceUUID string
+	PublicKey  *rsa.PublicKey
+}
+
+// keyID identifica uma chave pública pelo SHA-256 da sua codificação PKIX
+func keyID(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar chave pública: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// wrapKey encripta a chave simétrica para um destinatário com RSA-OAEP
+func wrapKey(recipient Recipient, symmetricKey []byte) (types.WrappedKey, error) {
+	id, err := keyID(recipient.PublicKey)
+	if err != nil {
+		return types.WrappedKey{}, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, recipient.PublicKey, symmetricKey, nil)
+	if err != nil {
+		return types.WrappedKey{}, fmt.Errorf("erro ao encriptar chave para %s: %w", recipient.DeviceUUID, err)
+	}
+
+	return types.WrappedKey{
+		DeviceUUID:   recipient.DeviceUUID,
+		KeyID:        id,
+		EncryptedKey: encryptedKey,
+	}, nil
+}
+
+// selectWrappedKey escolhe a entrada do pacote encriptada para a chave local.
+// Pacotes sem lista de destinatários usam a chave simétrica principal.
+func selectWrappedKey(resp *types.DecryptResponse, localKey *rsa.PublicKey) ([]byte, error) {
+	if len(resp.WrappedKeys) == 0 {
+		return resp.EncryptedSymmetricKey, nil
+	}
+
+	id, err := keyID(localKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, wk := range resp.WrappedKeys {
+		if wk.KeyID == id {
+			return wk.EncryptedKey, nil
+		}
+	}
+	return nil, fmt.Errorf("pacote não possui chave para este dispositivo")
+}
+
+// fetchDeviceKeys busca no registro da API as chaves públicas de um
+// dispositivo: a de encriptação e a de assinatura
+func fetchDeviceKeys(ctx context.Context, client *api.APIClient, deviceUUID string) (encryptKey, signKey *rsa.PublicKey, err error) {
+	device, err := client.GetDevice(ctx, deviceUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !device.IsActive {
+		return nil, nil, fmt.Errorf("dispositivo %s: %w", deviceUUID, errDeviceInactive)
+	}
+
+	if device.PublicKey != "" {
+		if signKey, err = tpm.ParsePublicKeyPEM(device.PublicKey); err != nil {
+			return nil, nil, fmt.Errorf("chave de assinatura inválida para %s: %w", deviceUUID, err)
+		}
+	}
+	if device.EncryptionKey != "" {
+		if encryptKey, err = tpm.ParsePublicKeyPEM(device.EncryptionKey); err != nil {
+			return nil, nil, fmt.Errorf("chave de encriptação inválida para %s: %w", deviceUUID, err)
+		}
+	}
+	return encryptKey, signKey, nil
+}
+
+// resolveRecipients retorna as chaves de encriptação fixadas dos
+// dispositivos informados, ignorando o próprio dispositivo e UUIDs
+// repetidos. A chave do registro da API serve apenas para detectar uma
+// troca: um destinatário sem chave confirmada, ou cuja chave mudou no
+// registro, é recusado até o usuário confirmar a impressão digital.
+func (a *Agent) resolveRecipients(ctx context.Context, deviceUUIDs []string) ([]Recipient, error) {
+	seen := map[string]bool{a.tpmMgr.DeviceUUID: true}
+	var recipients []Recipient
+
+	for _, deviceUUID := range deviceUUIDs {
+		if deviceUUID == "" || seen[deviceUUID] {
+			continue
+		}
+		seen[deviceUUID] = true
+
+		pinned, ok := a.trustedEncryptKey(deviceUUID)
+		if !ok {
+			return nil, fmt.Errorf("dispositivo %s não possui chave de encriptação confirmada", deviceUUID)
+		}
+
+		registered, _, err := fetchDeviceKeys(ctx, a.client, deviceUUID)
+		switch {
+		case errors.Is(err, errDeviceInactive):
+			return nil, err
+		case err != nil:
+			// Sem acesso ao registro, a chave fixada basta
+			log.Printf("Aviso: registro indisponível para %s, usando a chave fixada: %v", deviceUUID, err)
+		case registered != nil && !registered.Equal(pinned):
+			a.logEvent(EventKeyRotation, errRecipientKeyChanged, types.SecurityEvent{
+				Target: deviceUUID,
+				Detail: "chave de encriptação do destinatário alterada no registro",
+			})
+			return nil, fmt.Errorf("dispositivo %s: %w", deviceUUID, errRecipientKeyChanged)
+		}
+
+		recipients = append(recipients, Recipient{DeviceUUID: deviceUUID, PublicKey: pinned})
+	}
+
+	return recipients, nil
+}
+
+// signerKey retorna a chave para verificar a assinatura de um pacote: a
+// chave local se o pacote foi assinado por este dispositivo, ou a chave
+// fixada de um dispositivo confiável. A chave do registro da API não é
+// usada: o UUID do assinante vem do servidor, que poderia apontar a chave
+// de qualquer dispositivo registrado.
+func (a *Agent) signerKey(ctx context.Context, signerUUID string) (*rsa.PublicKey, error) {
+	if signerUUID == "" || signerUUID == a.tpmMgr.DeviceUUID {
+		return a.tpmMgr.Client.RetrieveRSASignKey(ctx)
+	}
+
+	signKey, ok := a.trustedSignKey(signerUUID)
+	if !ok {
+		return nil, fmt.Errorf("assinado pelo dispositivo %s, que não é confiável", signerUUID)
+	}
+	return signKey, nil
+}
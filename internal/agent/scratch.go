@@ -0,0 +1,322 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	scratchDirName      = "scratch"
+	scratchManifestName = "scratch.json"
+
+	// scratchJanitorInterval é o intervalo entre verificações de expiração
+	scratchJanitorInterval = 30 * time.Second
+)
+
+// scratchEntry é uma cópia decriptada temporária
+type scratchEntry struct {
+	Dir         string    `json:"dir"`
+	Path        string    `json:"path"`
+	OperationID string    `json:"operation_id"`
+	FileName    string    `json:"file_name"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// scratchStore controla as cópias decriptadas temporárias. Cada cópia fica
+// em um subdiretório próprio do diretório de rascunho, e o manifesto é
+// gravado em disco para que cópias deixadas por uma execução interrompida
+// sejam apagadas na próxima inicialização.
+type scratchStore struct {
+	mutex    sync.Mutex
+	dir      string
+	manifest string
+	entries  map[string]*scratchEntry
+}
+
+// openScratchStore abre o diretório de rascunho e carrega o manifesto
+func openScratchStore() (*scratchStore, error) {
+	base, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scratchStore{
+		dir:      filepath.Join(base, scratchDirName),
+		manifest: filepath.Join(base, scratchManifestName),
+		entries:  make(map[string]*scratchEntry),
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório temporário: %w", err)
+	}
+
+	data, err := os.ReadFile(s.manifest)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("erro ao ler manifesto temporário: %w", err)
+	}
+	if len(data) > 0 {
+		var entries []*scratchEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			log.Printf("Aviso: manifesto temporário inválido: %v", err)
+		}
+		for _, e := range entries {
+			s.entries[e.Dir] = e
+		}
+	}
+	return s, nil
+}
+
+// reserve cria um subdiretório para uma nova cópia e retorna o caminho do
+// arquivo dentro dele. A entrada é registrada no manifesto antes de o
+// diretório existir, sob a mesma trava do zelador, para que nenhuma limpeza
+// encontre o diretório sem saber dele.
+func (s *scratchStore) reserve(operationID, fileName string, ttl time.Duration) (*scratchEntry, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(s.dir, hex.EncodeToString(id[:]))
+	now := time.Now()
+	entry := &scratchEntry{
+		Dir:         dir,
+		Path:        filepath.Join(dir, fileName),
+		OperationID: operationID,
+		FileName:    fileName,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[dir] = entry
+	if err := s.saveLocked(); err != nil {
+		delete(s.entries, dir)
+		return nil, err
+	}
+
+	if err := os.Mkdir(dir, 0700); err != nil {
+		delete(s.entries, dir)
+		if saveErr := s.saveLocked(); saveErr != nil {
+			log.Printf("Aviso: erro ao gravar manifesto temporário: %v", saveErr)
+		}
+		return nil, fmt.Errorf("erro ao criar diretório temporário: %w", err)
+	}
+	return entry, nil
+}
+
+// list retorna as cópias ativas ordenadas pela expiração
+func (s *scratchStore) list() []types.ScratchCopy {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	copies := make([]types.ScratchCopy, 0, len(s.entries))
+	for _, e := range s.entries {
+		remaining := e.ExpiresAt.Sub(now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		copies = append(copies, types.ScratchCopy{
+			Path:             e.Path,
+			OperationID:      e.OperationID,
+			FileName:         e.FileName,
+			CreatedAt:        e.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:        e.ExpiresAt.Format(time.RFC3339),
+			RemainingSeconds: int64(remaining / time.Second),
+		})
+	}
+
+	sort.Slice(copies, func(i, j int) bool {
+		return copies[i].ExpiresAt < copies[j].ExpiresAt
+	})
+	return copies
+}
+
+// wipe apaga a cópia com o caminho informado
+func (s *scratchStore) wipe(path string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for dir, e := range s.entries {
+		if e.Path == path {
+			return s.wipeLocked(dir)
+		}
+	}
+	return fmt.Errorf("cópia temporária não encontrada: %s", path)
+}
+
+// wipeOperation apaga as cópias de uma operação
+func (s *scratchStore) wipeOperation(operationID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for dir, e := range s.entries {
+		if e.OperationID == operationID {
+			if err := s.wipeLocked(dir); err != nil {
+				log.Printf("Erro ao apagar cópia temporária %s: %v", e.Path, err)
+			}
+		}
+	}
+}
+
+// wipeExpired apaga as cópias expiradas ou, se all for verdadeiro, todas
+// as cópias. Diretórios que não constam no manifesto também são apagados.
+func (s *scratchStore) wipeExpired(all bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for dir, e := range s.entries {
+		if all || !now.Before(e.ExpiresAt) {
+			if err := s.wipeLocked(dir); err != nil {
+				log.Printf("Erro ao apagar cópia temporária %s: %v", e.Path, err)
+			}
+		}
+	}
+
+	orphans, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("Erro ao listar diretório temporário: %v", err)
+		return
+	}
+	for _, d := range orphans {
+		dir := filepath.Join(s.dir, d.Name())
+		if _, ok := s.entries[dir]; ok {
+			continue
+		}
+		if err := secureRemove(dir); err != nil {
+			log.Printf("Erro ao apagar cópia temporária órfã %s: %v", dir, err)
+		}
+	}
+}
+
+// run executa o zelador até o contexto ser cancelado
+func (s *scratchStore) run(ctx context.Context) {
+	s.wipeExpired(false)
+
+	ticker := time.NewTicker(scratchJanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.wipeExpired(false)
+		}
+	}
+}
+
+func (s *scratchStore) wipeLocked(dir string) error {
+	err := secureRemove(dir)
+	if err == nil {
+		log.Printf("Cópia temporária apagada: %s", s.entries[dir].Path)
+		delete(s.entries, dir)
+	}
+	if saveErr := s.saveLocked(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+func (s *scratchStore) saveLocked() error {
+	entries := make([]*scratchEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("erro ao serializar manifesto temporário: %w", err)
+	}
+
+	tmp := s.manifest + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("erro ao gravar manifesto temporário: %w", err)
+	}
+	return os.Rename(tmp, s.manifest)
+}
+
+// DecryptTemporary descriptografa um pacote no diretório de rascunho do
+// aplicativo. A cópia é sobrescrita e apagada após ttl ou no encerramento
+// do aplicativo. Se ttl for zero, usa o tempo da configuração.
+func (a *Agent) DecryptTemporary(ctx context.Context, operationID string, ttl time.Duration) (*types.ScratchCopy, error) {
+	if a.scratch == nil {
+		return nil, fmt.Errorf("diretório temporário indisponível")
+	}
+	if ttl <= 0 {
+		ttl = time.Duration(a.config.ScratchTTLMinutes) * time.Minute
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	result, response, err := a.retrievePackage(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := a.scratch.reserve(operationID, packageFileName(result, response, operationID), ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped, err := writeDecrypted(ctx, result, entry.Path, a.config.RestorePolicy)
+	if err != nil {
+		a.scratch.wipe(entry.Path)
+		return nil, err
+	}
+
+	for _, c := range a.scratch.list() {
+		if c.Path == entry.Path {
+			c.SkippedAttributes = skipped
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("cópia temporária expirou antes de ser listada")
+}
+
+// ListTemporary lista as cópias decriptadas temporárias ainda existentes
+func (a *Agent) ListTemporary() []types.ScratchCopy {
+	if a.scratch == nil {
+		return []types.ScratchCopy{}
+	}
+	return a.scratch.list()
+}
+
+// WipeTemporary apaga imediatamente uma cópia temporária
+func (a *Agent) WipeTemporary(path string) error {
+	if a.scratch == nil {
+		return fmt.Errorf("diretório temporário indisponível")
+	}
+	return a.scratch.wipe(path)
+}
+
+// Close assina os eventos de segurança pendentes e apaga todas as cópias
+// temporárias e as chaves locais em memória. Deve ser chamado no
+// encerramento do aplicativo.
+func (a *Agent) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := a.checkpointSecurityLog(ctx); err != nil {
+		log.Printf("Aviso: checkpoint do registro de segurança: %v", err)
+	}
+	cancel()
+
+	if a.scratch != nil {
+		a.scratch.wipeExpired(true)
+	}
+	a.secrets.wipe()
+	a.opened.wipeAll()
+}
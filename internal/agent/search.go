@@ -0,0 +1,436 @@
+package agent
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+	"unicode"
+)
+
+const (
+	searchSecretName    = "search"
+	searchIndexFileName = "search.idx"
+
+	// searchIndexLabel liga o conteúdo cifrado ao formato do índice
+	searchIndexLabel = "tpm-bunker-search-v1"
+
+	maxSearchResults = 200
+)
+
+// searchIndexFile é o conteúdo do índice gravado em disco
+type searchIndexFile struct {
+	Cursor     string            `json:"cursor"`
+	Operations []types.Operation `json:"operations"`
+	// Instante da última anotação aceita por operação
+	Annotated map[string]string `json:"annotated,omitempty"`
+	// Metadados decriptados por operação, para não abrir de novo a chave
+	// de cada pacote no TPM
+	Metadata map[string]*PackageMetadata `json:"metadata,omitempty"`
+}
+
+// searchIndexAEAD cria o AES-GCM do índice com a chave local do dispositivo
+func (a *Agent) searchIndexAEAD(ctx context.Context) (cipher.AEAD, error) {
+	key, err := a.deviceSecret(ctx, searchSecretName)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func searchIndexPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, searchIndexFileName), nil
+}
+
+// loadSearchIndex carrega do disco o índice da sessão anterior, uma única
+// vez. Um índice ilegível é descartado e reconstruído na próxima
+// sincronização.
+func (a *Agent) loadSearchIndex(ctx context.Context) {
+	c := &a.operations
+	c.mutex.Lock()
+	if c.loaded {
+		c.mutex.Unlock()
+		return
+	}
+	c.loaded = true
+	c.mutex.Unlock()
+
+	path, err := searchIndexPath()
+	if err != nil {
+		log.Printf("Aviso: índice de busca apenas em memória: %v", err)
+		return
+	}
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Aviso: erro ao ler índice de busca: %v", err)
+		}
+		return
+	}
+
+	aead, err := a.searchIndexAEAD(ctx)
+	if err != nil {
+		log.Printf("Aviso: erro ao abrir chave do índice de busca: %v", err)
+		return
+	}
+	if len(sealed) < aead.NonceSize() {
+		log.Printf("Aviso: índice de busca truncado")
+		return
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(searchIndexLabel))
+	if err != nil {
+		log.Printf("Aviso: índice de busca inválido: %v", err)
+		return
+	}
+
+	var index searchIndexFile
+	if err := json.Unmarshal(plaintext, &index); err != nil {
+		log.Printf("Aviso: índice de busca inválido: %v", err)
+		return
+	}
+
+	operations := make(map[string]*types.Operation, len(index.Operations))
+	for i := range index.Operations {
+		op := index.Operations[i]
+		operations[op.ID] = &op
+	}
+
+	a.metadata.load(index.Metadata)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setLocked(operations, index.Cursor)
+	c.annotated = index.Annotated
+}
+
+// saveSearchIndex grava o cache de operações e os metadados decriptados,
+// encriptados com a chave local
+func (a *Agent) saveSearchIndex(ctx context.Context) error {
+	path, err := searchIndexPath()
+	if err != nil {
+		return err
+	}
+
+	a.operations.mutex.Lock()
+	cursor := a.operations.cursor
+	annotated := make(map[string]string, len(a.operations.annotated))
+	for id, signedAt := range a.operations.annotated {
+		annotated[id] = signedAt
+	}
+	a.operations.mutex.Unlock()
+
+	plaintext, err := json.Marshal(searchIndexFile{
+		Cursor:     cursor,
+		Operations: a.operations.snapshot(),
+		Annotated:  annotated,
+		Metadata:   a.metadata.snapshot(),
+	})
+	if err != nil {
+		return err
+	}
+	defer clear(plaintext)
+
+	aead, err := a.searchIndexAEAD(ctx)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(searchIndexLabel))
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// tokenize divide um texto em termos minúsculos de letras e dígitos
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// operationTokens retorna os termos indexados de uma operação
+func operationTokens(op *types.Operation) []string {
+	tokens := tokenize(op.FileName)
+	for _, tag := range op.Tags {
+		tokens = append(tokens, tokenize(tag)...)
+	}
+	return append(tokens, tokenize(op.Notes)...)
+}
+
+// searchQuery é uma consulta já interpretada. Termos livres devem todos
+// aparecer no nome, nas etiquetas ou nas notas, como palavra ou prefixo de
+// palavra.
+type searchQuery struct {
+	terms   []string
+	exts    []string
+	tags    []string
+	classes []string
+	types   []string
+	kinds   []string
+	minSize int64
+	maxSize int64
+	after   time.Time
+	before  time.Time
+}
+
+// parseSearchQuery interpreta uma consulta. Além de termos livres, aceita
+// os qualificadores ext:pdf, tag:nome, class:secret, type:store, kind:file,
+// after:2024-01-31, before:2024-12-31 e size>10mb / size<500k (sem
+// operador, size:1m equivale a size>=1m).
+func parseSearchQuery(query string) (*searchQuery, error) {
+	q := &searchQuery{minSize: -1, maxSize: -1}
+
+	for _, field := range strings.Fields(query) {
+		lower := strings.ToLower(field)
+		key, value, qualified := strings.Cut(lower, ":")
+
+		switch {
+		case len(lower) > 4 && strings.HasPrefix(lower, "size") && strings.ContainsRune(":<>=", rune(lower[4])):
+			if err := q.parseSize(strings.TrimPrefix(lower[4:], ":")); err != nil {
+				return nil, err
+			}
+		case qualified && key == "ext":
+			q.exts = append(q.exts, strings.TrimPrefix(value, "."))
+		case qualified && key == "tag":
+			q.tags = append(q.tags, value)
+		case qualified && key == "class":
+			q.classes = append(q.classes, value)
+		case qualified && key == "type":
+			q.types = append(q.types, value)
+		case qualified && key == "kind":
+			q.kinds = append(q.kinds, value)
+		case qualified && (key == "after" || key == "before"):
+			t, err := parseFilterDate(value, key == "before")
+			if err != nil {
+				return nil, err
+			}
+			if key == "after" {
+				q.after = t
+			} else {
+				q.before = t
+			}
+		default:
+			q.terms = append(q.terms, tokenize(field)...)
+		}
+	}
+	return q, nil
+}
+
+// parseSize interpreta a comparação de tamanho de um qualificador size
+func (q *searchQuery) parseSize(expr string) error {
+	op := ">="
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(expr, candidate) {
+			op = candidate
+			expr = strings.TrimPrefix(expr, candidate)
+			break
+		}
+	}
+
+	size, err := parseSize(expr)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case ">=":
+		q.minSize = size
+	case ">":
+		q.minSize = size + 1
+	case "<=":
+		q.maxSize = size
+	case "<":
+		q.maxSize = size - 1
+	case "=":
+		q.minSize, q.maxSize = size, size
+	}
+	return nil
+}
+
+// parseSize interpreta tamanhos como 500, 10k, 10kb, 2m ou 1gb
+func parseSize(expr string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"gb", 1 << 30}, {"g", 1 << 30},
+		{"mb", 1 << 20}, {"m", 1 << 20},
+		{"kb", 1 << 10}, {"k", 1 << 10},
+		{"b", 1},
+	}
+
+	scale := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(expr, unit.suffix) {
+			scale = unit.scale
+			expr = strings.TrimSuffix(expr, unit.suffix)
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(expr, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("tamanho inválido na busca: %s", expr)
+	}
+	return int64(value * float64(scale)), nil
+}
+
+// matches verifica os qualificadores da consulta, exceto os termos livres
+func (q *searchQuery) matches(op *types.Operation) bool {
+	if len(q.exts) > 0 {
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(op.FileName)), ".")
+		if !containsString(q.exts, ext) {
+			return false
+		}
+	}
+	for _, tag := range q.tags {
+		if !hasTag(op.Tags, tag) {
+			return false
+		}
+	}
+	if len(q.classes) > 0 && !containsString(q.classes, op.Classification) {
+		return false
+	}
+	if len(q.types) > 0 && !containsString(q.types, strings.ToLower(op.OperationType)) {
+		return false
+	}
+	if len(q.kinds) > 0 && !containsString(q.kinds, strings.ToLower(op.Kind)) {
+		return false
+	}
+
+	size := op.OriginalSize
+	if size == 0 {
+		size = op.FileSize
+	}
+	if q.minSize >= 0 && size < q.minSize {
+		return false
+	}
+	if q.maxSize >= 0 && size > q.maxSize {
+		return false
+	}
+
+	if !q.after.IsZero() || !q.before.IsZero() {
+		created, err := parseTimestamp(op.CreatedAt)
+		if err != nil {
+			return false
+		}
+		if !q.after.IsZero() && created.Before(q.after) {
+			return false
+		}
+		if !q.before.IsZero() && !created.Before(q.before) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchOperations busca no índice local, sem consultar a API. Os
+// resultados vêm dos termos que casam melhor (palavra inteira antes de
+// prefixo) e, em seguida, dos mais recentes.
+func (a *Agent) SearchOperations(ctx context.Context, query string) ([]types.Operation, error) {
+	q, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	a.loadSearchIndex(ctx)
+
+	c := &a.operations
+	c.mutex.Lock()
+	scores := make(map[string]int)
+	if len(q.terms) == 0 {
+		for id := range c.operations {
+			scores[id] = 0
+		}
+	}
+	for i, term := range q.terms {
+		termScores := make(map[string]int)
+		for token, ids := range c.tokens {
+			score := 0
+			switch {
+			case token == term:
+				score = 2
+			case strings.HasPrefix(token, term):
+				score = 1
+			default:
+				continue
+			}
+			for id := range ids {
+				if score > termScores[id] {
+					termScores[id] = score
+				}
+			}
+		}
+
+		// Todos os termos precisam casar
+		if i == 0 {
+			scores = termScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := termScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]types.Operation, 0, len(scores))
+	for id := range scores {
+		op, ok := c.operations[id]
+		if ok && q.matches(op) {
+			results = append(results, *op)
+		}
+	}
+	c.mutex.Unlock()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		si, sj := scores[results[i].ID], scores[results[j].ID]
+		if si != sj {
+			return si > sj
+		}
+		ti, _ := parseTimestamp(results[i].CreatedAt)
+		tj, _ := parseTimestamp(results[j].CreatedAt)
+		return ti.After(tj)
+	})
+
+	if len(results) > maxSearchResults {
+		results = results[:maxSearchResults]
+	}
+	return results, nil
+}
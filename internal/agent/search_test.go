@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    searchQuery
+		wantErr bool
+	}{
+		{
+			name:  "vazia",
+			query: "   ",
+			want:  searchQuery{minSize: -1, maxSize: -1},
+		},
+		{
+			name:  "termos livres",
+			query: "Relatório-Final.PDF  contrato",
+			want:  searchQuery{terms: []string{"relatório", "final", "pdf", "contrato"}, minSize: -1, maxSize: -1},
+		},
+		{
+			name:  "qualificadores",
+			query: "ext:.PDF ext:txt tag:Fiscal class:secret type:STORE kind:directory",
+			want: searchQuery{
+				exts:    []string{"pdf", "txt"},
+				tags:    []string{"fiscal"},
+				classes: []string{"secret"},
+				types:   []string{"store"},
+				kinds:   []string{"directory"},
+				minSize: -1,
+				maxSize: -1,
+			},
+		},
+		{
+			name:  "size sem operador",
+			query: "size:1m",
+			want:  searchQuery{minSize: 1 << 20, maxSize: -1},
+		},
+		{
+			name:  "size maior que",
+			query: "size>10mb",
+			want:  searchQuery{minSize: 10<<20 + 1, maxSize: -1},
+		},
+		{
+			name:  "size menor ou igual",
+			query: "size<=2k",
+			want:  searchQuery{minSize: -1, maxSize: 2 << 10},
+		},
+		{
+			name:  "faixa de tamanho",
+			query: "size>=1kb size<500k",
+			want:  searchQuery{minSize: 1 << 10, maxSize: 500<<10 - 1},
+		},
+		{
+			name:  "size igual",
+			query: "size=1.5k",
+			want:  searchQuery{minSize: 1536, maxSize: 1536},
+		},
+		{
+			name:  "palavra começando com size",
+			query: "sizeable",
+			want:  searchQuery{terms: []string{"sizeable"}, minSize: -1, maxSize: -1},
+		},
+		{
+			name:  "datas",
+			query: "after:2024-01-31 before:2024-12-31",
+			// before cobre o dia inteiro
+			want: searchQuery{after: date("2024-01-31"), before: date("2025-01-01"), minSize: -1, maxSize: -1},
+		},
+		{
+			name:  "qualificador desconhecido vira termo",
+			query: "autor:maria",
+			want:  searchQuery{terms: []string{"autor", "maria"}, minSize: -1, maxSize: -1},
+		},
+		{name: "tamanho inválido", query: "size>muito", wantErr: true},
+		{name: "tamanho negativo", query: "size<-1k", wantErr: true},
+		{name: "unidade desconhecida", query: "size:10tb", wantErr: true},
+		{name: "data inválida", query: "after:31/01/2024", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSearchQuery(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSearchQuery(%q) = %+v, esperado erro", tt.query, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSearchQuery(%q): %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("parseSearchQuery(%q) = %+v, esperado %+v", tt.query, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    int64
+		wantErr bool
+	}{
+		{expr: "500", want: 500},
+		{expr: "500b", want: 500},
+		{expr: "10k", want: 10 << 10},
+		{expr: "10kb", want: 10 << 10},
+		{expr: "2m", want: 2 << 20},
+		{expr: "1gb", want: 1 << 30},
+		{expr: "0.5m", want: 1 << 19},
+		{expr: "", wantErr: true},
+		{expr: "k", wantErr: true},
+		{expr: "-5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSize(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSize(%q) = %d, esperado erro", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; esperado %d", tt.expr, got, err, tt.want)
+		}
+	}
+}
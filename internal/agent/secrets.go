@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	secretsDirName = "keys"
+	secretSize     = 32
+)
+
+// secretStore guarda chaves simétricas que nunca saem do dispositivo. Em
+// disco elas ficam encriptadas com a chave RSA do TPM, portanto só podem
+// ser abertas neste dispositivo; em memória, ficam em cache após a primeira
+// abertura.
+type secretStore struct {
+	mutex   sync.Mutex
+	secrets map[string][]byte
+}
+
+// deviceSecret retorna a chave local com o nome informado, gerando-a na
+// primeira chamada
+func (a *Agent) deviceSecret(ctx context.Context, name string) ([]byte, error) {
+	a.secrets.mutex.Lock()
+	defer a.secrets.mutex.Unlock()
+
+	if secret, ok := a.secrets.secrets[name]; ok {
+		return secret, nil
+	}
+
+	base, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(base, secretsDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório de chaves: %w", err)
+	}
+	path := filepath.Join(dir, name+".key")
+
+	var secret []byte
+	wrapped, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		secret, err = a.tpmMgr.Client.RSADecrypt(ctx, wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao abrir chave local %s: %w", name, err)
+		}
+	case os.IsNotExist(err):
+		secret, err = a.createSecret(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao criar chave local %s: %w", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("erro ao ler chave local %s: %w", name, err)
+	}
+
+	if a.secrets.secrets == nil {
+		a.secrets.secrets = make(map[string][]byte)
+	}
+	a.secrets.secrets[name] = secret
+	return secret, nil
+}
+
+// createSecret gera uma nova chave e a grava encriptada em path
+func (a *Agent) createSecret(ctx context.Context, path string) (_ []byte, err error) {
+	defer func() {
+		a.logEvent(EventKeyCreated, err, types.SecurityEvent{Target: filepath.Base(path)})
+	}()
+
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	pubKey, err := a.tpmMgr.Client.RetrieveRSADecryptKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := wrapKey(Recipient{DeviceUUID: a.tpmMgr.DeviceUUID, PublicKey: pubKey}, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// O_EXCL evita sobrescrever uma chave criada em paralelo
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(wrapped.EncryptedKey); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// wipe apaga as chaves locais da memória
+func (s *secretStore) wipe() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for name, secret := range s.secrets {
+		clear(secret)
+		delete(s.secrets, name)
+	}
+}
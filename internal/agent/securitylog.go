@@ -0,0 +1,652 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	securityLogFileName  = "security.log"
+	securityHeadFileName = "security.head"
+
+	// Um checkpoint é assinado a cada checkpointEvery eventos ou, havendo
+	// eventos não assinados, a cada checkpointInterval
+	checkpointEvery    = 100
+	checkpointInterval = 15 * time.Minute
+
+	// maxSecurityLine limita o tamanho de uma entrada na leitura
+	maxSecurityLine = 1 << 20
+
+	// securityHeadLabel separa a assinatura da referência da dos checkpoints
+	securityHeadLabel = "tpm-bunker-security-head-v2"
+)
+
+// Tipos de evento do registro de segurança
+const (
+	EventInit        = "init"
+	EventLogin       = "login"
+	EventEncrypt     = "encrypt"
+	EventDecrypt     = "decrypt"
+	EventShare       = "share"
+	EventRevoke      = "revoke"
+	EventDelete      = "delete"
+	EventKeyCreated  = "key_created"
+	EventKeyRotation = "key_rotation"
+	EventCheckpoint  = "checkpoint"
+
+	// Confiança nas chaves de assinatura de outros dispositivos
+	EventDeviceTrusted   = "device_trusted"
+	EventDeviceUntrusted = "device_untrusted"
+
+	// EventIntegrity registra uma violação do próprio registro encontrada
+	// ao abri-lo
+	EventIntegrity = "integrity"
+)
+
+// Formatos de exportação do registro
+const (
+	ExportJSONL = "jsonl"
+	ExportCEF   = "cef"
+)
+
+// genesisHash é o hash anterior da primeira entrada
+var genesisHash = strings.Repeat("0", 64)
+
+// securityHead é a referência do fim do registro. Fica fora dele para que a
+// remoção das últimas linhas seja percebida. O fim da cadeia é atualizado a
+// cada entrada, sem assinatura; a âncora, o último checkpoint, é assinada
+// pelo TPM junto com ele, e a remoção de entradas até ela não pode ser
+// escondida reescrevendo a referência. Entradas após a âncora ficam sem
+// essa garantia até o próximo checkpoint.
+type securityHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+
+	AnchorSeq  uint64 `json:"anchor_seq,omitempty"`
+	AnchorHash string `json:"anchor_hash,omitempty"`
+	Signature  string `json:"anchor_signature,omitempty"`
+}
+
+// digest retorna o que a assinatura da âncora cobre
+func (h securityHead) digest() []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%s\n", securityHeadLabel, h.AnchorSeq, h.AnchorHash)))
+	return sum[:]
+}
+
+// verify confere a assinatura da âncora com a chave do dispositivo
+func (h securityHead) verify(pubKey *rsa.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(h.Signature)
+	if err != nil || h.Signature == "" {
+		return fmt.Errorf("referência sem assinatura")
+	}
+	return rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, h.digest(), signature)
+}
+
+// securitySigner assina o registro com a chave de assinatura do TPM
+type securitySigner struct {
+	sign      func(digest []byte) ([]byte, error)
+	publicKey func() (*rsa.PublicKey, error)
+}
+
+// securityLog é o registro local de eventos de segurança, um arquivo JSON
+// por linha encadeado por hashes. Só recebe acréscimos: alterar ou remover
+// uma entrada quebra a cadeia, e os checkpoints assinados pelo TPM impedem
+// que ela seja recalculada sem o dispositivo.
+type securityLog struct {
+	wakeup chan struct{}
+
+	mutex    sync.Mutex
+	loaded   bool
+	path     string
+	headPath string
+	head     securityHead
+	unsigned int
+}
+
+func newSecurityLog() *securityLog {
+	return &securityLog{wakeup: make(chan struct{}, 1)}
+}
+
+// eventHash calcula o hash de uma entrada, que inclui o hash da anterior
+func eventHash(e types.SecurityEvent) string {
+	e.Hash = ""
+	e.Signature = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// securitySigner retorna o assinante do registro, ou nil enquanto o
+// dispositivo não estiver inicializado
+func (a *Agent) securitySigner(ctx context.Context) *securitySigner {
+	if deviceUUID, _ := a.tpmMgr.GetDeviceUUID(ctx); deviceUUID == "" {
+		return nil
+	}
+	return &securitySigner{
+		sign: func(digest []byte) ([]byte, error) {
+			return a.tpmMgr.Client.SignData(ctx, digest)
+		},
+		publicKey: func() (*rsa.PublicKey, error) {
+			return a.tpmMgr.Client.RetrieveRSASignKey(ctx)
+		},
+	}
+}
+
+// loadLocked encontra o fim da cadeia. Se o registro não corresponder à
+// referência, a violação é registrada antes de qualquer novo evento, já que
+// a referência será sobrescrita. Sem signer a assinatura da âncora não é
+// conferida.
+func (l *securityLog) loadLocked(signer *securitySigner) {
+	if l.loaded {
+		return
+	}
+	l.loaded = true
+	l.head = securityHead{Hash: genesisHash}
+
+	dir, err := config.Dir()
+	if err != nil {
+		log.Printf("Aviso: registro de segurança indisponível: %v", err)
+		return
+	}
+	l.path = filepath.Join(dir, securityLogFileName)
+	l.headPath = filepath.Join(dir, securityHeadFileName)
+
+	var reference securityHead
+	data, err := os.ReadFile(l.headPath)
+	readable := err == nil && json.Unmarshal(data, &reference) == nil
+
+	// Hash da entrada apontada pela âncora
+	var anchorHash string
+	f, err := os.Open(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Aviso: erro ao ler registro de segurança: %v", err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxSecurityLine)
+		for scanner.Scan() {
+			var e types.SecurityEvent
+			if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Hash == "" {
+				continue
+			}
+			l.head.Seq, l.head.Hash = e.Seq, e.Hash
+			if e.Seq == reference.AnchorSeq {
+				anchorHash = e.Hash
+			}
+			if e.Type == EventCheckpoint {
+				l.unsigned = 0
+			} else {
+				l.unsigned++
+			}
+		}
+		f.Close()
+	}
+
+	var detail string
+	switch {
+	case !readable:
+		if l.head.Seq > 0 {
+			detail = "referência do registro ausente ou ilegível"
+		}
+	case reference.Seq > l.head.Seq || (reference.Seq == l.head.Seq && reference.Hash != l.head.Hash):
+		detail = fmt.Sprintf("registro truncado ou substituído: a referência aponta o evento %d, mas o registro termina no %d",
+			reference.Seq, l.head.Seq)
+	case reference.AnchorSeq > 0 && anchorHash != reference.AnchorHash:
+		detail = fmt.Sprintf("registro truncado ou substituído antes do checkpoint %d assinado na referência", reference.AnchorSeq)
+	case signer != nil && reference.AnchorSeq > 0:
+		pubKey, err := signer.publicKey()
+		if err != nil {
+			log.Printf("Aviso: referência do registro não conferida: %v", err)
+			break
+		}
+		if reference.verify(pubKey) != nil {
+			detail = "referência do registro sem assinatura válida do dispositivo"
+		}
+	}
+	if detail == "" {
+		l.head.AnchorSeq = reference.AnchorSeq
+		l.head.AnchorHash = reference.AnchorHash
+		l.head.Signature = reference.Signature
+		return
+	}
+
+	log.Printf("Aviso: %s", detail)
+	l.appendLocked(types.SecurityEvent{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Type:    EventIntegrity,
+		Outcome: "failure",
+		Detail:  detail,
+	}, signer)
+}
+
+// appendLocked encadeia e grava uma entrada e atualiza a referência. Só
+// checkpoints usam o TPM: eles exigem signer, que assina o hash da entrada e
+// a nova âncora da referência. Os demais eventos não esperam pelo TPM, que
+// encriptação, decriptação e compartilhamento também usam.
+func (l *securityLog) appendLocked(e types.SecurityEvent, signer *securitySigner) error {
+	if l.path == "" {
+		return fmt.Errorf("registro de segurança indisponível")
+	}
+
+	e.Seq = l.head.Seq + 1
+	e.PrevHash = l.head.Hash
+	e.Hash = eventHash(e)
+	if e.Type == EventCheckpoint {
+		if signer == nil {
+			return fmt.Errorf("checkpoint sem dispositivo inicializado")
+		}
+		digest, _ := hex.DecodeString(e.Hash)
+		signature, err := signer.sign(digest)
+		if err != nil {
+			return fmt.Errorf("erro ao assinar checkpoint: %w", err)
+		}
+		e.Signature = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("erro ao abrir registro de segurança: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("erro ao gravar registro de segurança: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	l.head.Seq, l.head.Hash = e.Seq, e.Hash
+	if e.Type == EventCheckpoint {
+		l.unsigned = 0
+
+		// O checkpoint já foi gravado; sem a nova âncora, a referência
+		// continua na anterior
+		anchor := l.head
+		anchor.AnchorSeq, anchor.AnchorHash = e.Seq, e.Hash
+		if signature, err := signer.sign(anchor.digest()); err != nil {
+			log.Printf("Aviso: âncora do registro não assinada: %v", err)
+		} else {
+			anchor.Signature = base64.StdEncoding.EncodeToString(signature)
+			l.head = anchor
+		}
+	} else {
+		l.unsigned++
+	}
+
+	data, _ := json.Marshal(l.head)
+	tmp := l.headPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("erro ao gravar referência do registro: %w", err)
+	}
+	return os.Rename(tmp, l.headPath)
+}
+
+// logEvent registra um evento de segurança; err nil indica sucesso. Uma
+// falha ao gravar o registro não interrompe a operação registrada.
+func (a *Agent) logEvent(kind string, err error, event types.SecurityEvent) {
+	event.Type = kind
+	event.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	event.DeviceUUID = a.tpmMgr.DeviceUUID
+	event.Outcome = "success"
+	if err != nil {
+		event.Outcome = "failure"
+		if event.Detail != "" {
+			event.Detail += ": "
+		}
+		event.Detail += err.Error()
+	}
+
+	signer := a.securitySigner(a.ctx)
+	l := a.securityLog
+	l.mutex.Lock()
+	l.loadLocked(signer)
+	writeErr := l.appendLocked(event, signer)
+	pending := l.unsigned
+	l.mutex.Unlock()
+
+	if writeErr != nil {
+		log.Printf("Aviso: evento %s não registrado: %v", kind, writeErr)
+		return
+	}
+	if pending >= checkpointEvery {
+		select {
+		case l.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// checkpointSecurityLog assina com o TPM o fim da cadeia, se houver eventos
+// ainda não assinados
+func (a *Agent) checkpointSecurityLog(ctx context.Context) error {
+	signer := a.securitySigner(ctx)
+	if signer == nil {
+		return nil
+	}
+
+	l := a.securityLog
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.loadLocked(signer)
+	if l.unsigned == 0 {
+		return nil
+	}
+
+	event := types.SecurityEvent{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Type:       EventCheckpoint,
+		Outcome:    "success",
+		DeviceUUID: a.tpmMgr.DeviceUUID,
+		Detail:     fmt.Sprintf("%d eventos desde o checkpoint anterior", l.unsigned),
+	}
+	return l.appendLocked(event, signer)
+}
+
+// runSecurityLog é o worker dos checkpoints do registro de segurança
+func (a *Agent) runSecurityLog(ctx context.Context) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.securityLog.wakeup:
+		case <-ticker.C:
+		}
+
+		if err := a.checkpointSecurityLog(ctx); err != nil {
+			log.Printf("Aviso: checkpoint do registro de segurança: %v", err)
+		}
+	}
+}
+
+// readSecurityLog retorna o conteúdo do registro e a referência do seu fim
+func (a *Agent) readSecurityLog() ([]byte, securityHead, error) {
+	signer := a.securitySigner(a.ctx)
+	l := a.securityLog
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.loadLocked(signer)
+
+	if l.path == "" {
+		return nil, l.head, fmt.Errorf("registro de segurança indisponível")
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, l.head, fmt.Errorf("erro ao ler registro de segurança: %w", err)
+	}
+	return data, l.head, nil
+}
+
+// SecurityEvents retorna os últimos limit eventos do registro, do mais
+// recente ao mais antigo
+func (a *Agent) SecurityEvents(limit int) ([]types.SecurityEvent, error) {
+	data, _, err := a.readSecurityLog()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []types.SecurityEvent
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxSecurityLine)
+	for scanner.Scan() {
+		var e types.SecurityEvent
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			events = append(events, e)
+		}
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+// VerifySecurityLog verifica a cadeia de hashes, a sequência e as
+// assinaturas dos checkpoints, e compara o registro com a referência gravada
+// à parte. Entradas após o último checkpoint não estão ancoradas: sua
+// remoção junto com a reescrita da referência não é percebida. A troca do
+// registro e da referência por uma cópia antiga e íntegra só é percebida
+// comparando com uma exportação.
+func (a *Agent) VerifySecurityLog(ctx context.Context) (*types.SecurityLogVerification, error) {
+	pubKey, err := a.tpmMgr.Client.RetrieveRSASignKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao recuperar chave de assinatura: %w", err)
+	}
+
+	data, head, err := a.readSecurityLog()
+	if err != nil {
+		return nil, err
+	}
+	return verifySecurityEvents(bytes.NewReader(data), pubKey, head), nil
+}
+
+// verifySecurityEvents verifica um registro contra a chave de assinatura
+// do dispositivo e a referência do seu fim
+func verifySecurityEvents(r io.Reader, pubKey *rsa.PublicKey, head securityHead) *types.SecurityLogVerification {
+	result := &types.SecurityLogVerification{Problems: []string{}}
+	problem := func(format string, args ...interface{}) {
+		result.Problems = append(result.Problems, fmt.Sprintf(format, args...))
+	}
+
+	expected := uint64(1)
+	prevHash := genesisHash
+	var last securityHead
+	var anchorHash string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxSecurityLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e types.SecurityEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			problem("linha %d ilegível: %v", line, err)
+			continue
+		}
+		result.Entries++
+
+		if e.Seq != expected {
+			problem("evento %d fora de sequência (esperado %d): eventos removidos ou inseridos", e.Seq, expected)
+		} else if e.PrevHash != prevHash {
+			problem("evento %d não aponta para o hash do evento anterior", e.Seq)
+		}
+		if eventHash(e) != e.Hash {
+			problem("evento %d alterado: hash não confere", e.Seq)
+		}
+
+		switch e.Type {
+		case EventCheckpoint:
+			signature, err := base64.StdEncoding.DecodeString(e.Signature)
+			digest, _ := hex.DecodeString(e.Hash)
+			if err != nil || e.Signature == "" || rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, digest, signature) != nil {
+				problem("checkpoint %d com assinatura inválida", e.Seq)
+			} else {
+				result.Checkpoints++
+				result.LastCheckpointSeq = e.Seq
+				result.Unanchored = 0
+			}
+		case EventIntegrity:
+			problem("evento %d registra violação anterior: %s", e.Seq, e.Detail)
+			result.Unanchored++
+		default:
+			result.Unanchored++
+		}
+		if e.Seq == head.AnchorSeq {
+			anchorHash = e.Hash
+		}
+
+		// Continua da entrada encontrada, para não repetir o mesmo problema
+		// em todas as seguintes
+		expected = e.Seq + 1
+		prevHash = e.Hash
+		last.Seq, last.Hash = e.Seq, e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		problem("erro ao ler registro: %v", err)
+	}
+
+	switch {
+	case head.Seq > last.Seq:
+		problem("registro truncado: a referência aponta o evento %d, mas o registro termina no %d", head.Seq, last.Seq)
+	case head.Seq == last.Seq && head.Seq > 0 && head.Hash != last.Hash:
+		problem("o último evento não corresponde à referência")
+	}
+	if head.AnchorSeq > 0 {
+		if head.verify(pubKey) != nil {
+			problem("referência do registro sem assinatura válida do dispositivo")
+		} else if last.Seq < head.AnchorSeq {
+			problem("registro truncado: o checkpoint %d assinado na referência foi removido", head.AnchorSeq)
+		} else if anchorHash != head.AnchorHash {
+			problem("o evento %d não corresponde ao checkpoint assinado na referência", head.AnchorSeq)
+		}
+	}
+
+	result.Valid = len(result.Problems) == 0
+	return result
+}
+
+// ExportSecurityLog exporta o registro para um SIEM e retorna o número de
+// eventos exportados. jsonl copia as entradas como gravadas, com hashes e
+// assinaturas, para verificação externa; cef as converte para o Common
+// Event Format.
+func (a *Agent) ExportSecurityLog(destPath, format string) (int, error) {
+	if format != ExportJSONL && format != ExportCEF {
+		return 0, fmt.Errorf("formato de exportação desconhecido: %s", format)
+	}
+
+	data, _, err := a.readSecurityLog()
+	if err != nil {
+		return 0, err
+	}
+
+	var out bytes.Buffer
+	count := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxSecurityLine)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if format == ExportJSONL {
+			out.Write(line)
+			out.WriteByte('\n')
+			count++
+			continue
+		}
+
+		var e types.SecurityEvent
+		if json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		out.WriteString(cefEvent(e))
+		out.WriteByte('\n')
+		count++
+	}
+
+	if err := os.WriteFile(destPath, out.Bytes(), 0600); err != nil {
+		return 0, fmt.Errorf("erro ao gravar exportação: %w", err)
+	}
+	log.Printf("Registro de segurança exportado (%s): %d eventos em %s", format, count, destPath)
+	return count, nil
+}
+
+var cefNames = map[string]string{
+	EventInit:            "Dispositivo inicializado",
+	EventLogin:           "Login na API",
+	EventEncrypt:         "Arquivo encriptado",
+	EventDecrypt:         "Pacote decriptado",
+	EventShare:           "Pacote compartilhado",
+	EventRevoke:          "Compartilhamento revogado",
+	EventDelete:          "Pacote removido",
+	EventKeyCreated:      "Chave local criada",
+	EventKeyRotation:     "Chave de dispositivo alterada",
+	EventCheckpoint:      "Checkpoint do registro",
+	EventDeviceTrusted:   "Dispositivo confiável adicionado",
+	EventDeviceUntrusted: "Dispositivo confiável removido",
+	EventIntegrity:       "Violação do registro",
+}
+
+// cefEvent converte uma entrada para uma linha CEF
+func cefEvent(e types.SecurityEvent) string {
+	severity := 3
+	switch {
+	case e.Type == EventIntegrity:
+		severity = 10
+	case e.Outcome == "failure":
+		severity = 7
+	case e.Type == EventDelete || e.Type == EventShare || e.Type == EventKeyRotation ||
+		e.Type == EventDeviceTrusted || e.Type == EventDeviceUntrusted:
+		severity = 5
+	}
+
+	name := cefNames[e.Type]
+	if name == "" {
+		name = e.Type
+	}
+
+	ext := []string{"cn1Label=seq", "cn1=" + strconv.FormatUint(e.Seq, 10)}
+	if t, err := time.Parse(time.RFC3339Nano, e.Time); err == nil {
+		ext = append(ext, "rt="+strconv.FormatInt(t.UnixMilli(), 10))
+	}
+	fields := []struct{ key, label, value string }{
+		{"outcome", "", e.Outcome},
+		{"deviceExternalId", "", e.DeviceUUID},
+		{"cs1", "operationId", e.OperationID},
+		{"filePath", "", e.Target},
+		{"msg", "", e.Detail},
+		{"cs2", "hash", e.Hash},
+		{"cs3", "prevHash", e.PrevHash},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		if f.label != "" {
+			ext = append(ext, f.key+"Label="+f.label)
+		}
+		ext = append(ext, f.key+"="+cefValue(f.value))
+	}
+
+	return fmt.Sprintf("CEF:0|TPM Bunker|tpm-bunker-agent|1.0|%s|%s|%d|%s",
+		cefHeader(e.Type), cefHeader(name), severity, strings.Join(ext, " "))
+}
+
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
@@ -0,0 +1,246 @@
+package agent
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"tpm-bunker/internal/types"
+)
+
+// testChain monta um registro íntegro em que as entradas listadas em
+// checkpoints são checkpoints assinados com key
+func testChain(t *testing.T, key *rsa.PrivateKey, n int, checkpoints ...int) []types.SecurityEvent {
+	t.Helper()
+	sign := func(digest []byte) string {
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(signature)
+	}
+
+	events := make([]types.SecurityEvent, 0, n)
+	prevHash := genesisHash
+	for i := 1; i <= n; i++ {
+		e := types.SecurityEvent{
+			Seq:      uint64(i),
+			Type:     EventEncrypt,
+			Outcome:  "success",
+			Target:   "/tmp/arquivo.txt",
+			PrevHash: prevHash,
+		}
+		for _, c := range checkpoints {
+			if c == i {
+				e.Type = EventCheckpoint
+				e.Target = ""
+			}
+		}
+		e.Hash = eventHash(e)
+		if e.Type == EventCheckpoint {
+			digest, _ := hex.DecodeString(e.Hash)
+			e.Signature = sign(digest)
+		}
+		events = append(events, e)
+		prevHash = e.Hash
+	}
+	return events
+}
+
+// testHead retorna a referência da última entrada, ancorada no último
+// checkpoint e assinada com key
+func testHead(t *testing.T, key *rsa.PrivateKey, events []types.SecurityEvent) securityHead {
+	t.Helper()
+	var head securityHead
+	for _, e := range events {
+		head.Seq, head.Hash = e.Seq, e.Hash
+		if e.Type == EventCheckpoint {
+			head.AnchorSeq, head.AnchorHash = e.Seq, e.Hash
+		}
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, head.digest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	head.Signature = base64.StdEncoding.EncodeToString(signature)
+	return head
+}
+
+func encodeEvents(t *testing.T, events []types.SecurityEvent) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	return buf.Bytes()
+}
+
+func TestVerifySecurityEvents(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// tamper altera o registro e a referência íntegros
+		tamper          func(events []types.SecurityEvent, head securityHead) ([]types.SecurityEvent, securityHead)
+		wantProblem     string
+		wantCheckpoints int
+		wantUnanchored  int
+	}{
+		{
+			name:            "íntegro",
+			tamper:          func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) { return e, h },
+			wantCheckpoints: 2,
+			wantUnanchored:  2,
+		},
+		{
+			// Entradas não ancoradas podem sumir com a referência reescrita
+			name: "truncado após o último checkpoint com referência reescrita",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				e = e[:8]
+				h.Seq, h.Hash = e[7].Seq, e[7].Hash
+				return e, h
+			},
+			wantCheckpoints: 2,
+			wantUnanchored:  0,
+		},
+		{
+			name: "entrada alterada",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				e[1].Target = "/tmp/outro.txt"
+				return e, h
+			},
+			wantProblem: "evento 2 alterado",
+		},
+		{
+			name: "entrada alterada com hash recalculado",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				e[1].Outcome = "failure"
+				e[1].Hash = eventHash(e[1])
+				return e, h
+			},
+			wantProblem: "evento 3 não aponta para o hash do evento anterior",
+		},
+		{
+			name: "checkpoint assinado por outra chave",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				digest, _ := hex.DecodeString(e[3].Hash)
+				signature, _ := rsa.SignPKCS1v15(rand.Reader, other, crypto.SHA256, digest)
+				e[3].Signature = base64.StdEncoding.EncodeToString(signature)
+				return e, h
+			},
+			wantProblem: "checkpoint 4 com assinatura inválida",
+		},
+		{
+			name: "entradas trocadas de ordem",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				e[1], e[2] = e[2], e[1]
+				return e, h
+			},
+			wantProblem: "evento 3 fora de sequência (esperado 2)",
+		},
+		{
+			name: "entrada removida",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				return append(e[:2], e[3:]...), h
+			},
+			wantProblem: "evento 4 fora de sequência (esperado 3)",
+		},
+		{
+			name: "truncado após o checkpoint",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				return e[:8], h
+			},
+			wantProblem: "registro truncado: a referência aponta o evento 10, mas o registro termina no 8",
+		},
+		{
+			name: "checkpoint ancorado removido",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				e = e[:6]
+				h.Seq, h.Hash = e[5].Seq, e[5].Hash
+				return e, h
+			},
+			wantProblem: "registro truncado: o checkpoint 8 assinado na referência foi removido",
+		},
+		{
+			name: "truncado com âncora reescrita sem assinatura",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				e = e[:6]
+				return e, securityHead{Seq: e[5].Seq, Hash: e[5].Hash, AnchorSeq: e[3].Seq, AnchorHash: e[3].Hash}
+			},
+			wantProblem: "referência do registro sem assinatura válida do dispositivo",
+		},
+		{
+			name: "truncado com âncora assinada por outra chave",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				e = e[:6]
+				return e, testHead(t, other, e)
+			},
+			wantProblem: "referência do registro sem assinatura válida do dispositivo",
+		},
+		{
+			name: "checkpoint ancorado substituído",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				e[7].Detail = "outro"
+				e[7].Hash = eventHash(e[7])
+				e[8].PrevHash = e[7].Hash
+				return e, h
+			},
+			wantProblem: "o evento 8 não corresponde ao checkpoint assinado na referência",
+		},
+		{
+			name: "referência de outro registro",
+			tamper: func(e []types.SecurityEvent, h securityHead) ([]types.SecurityEvent, securityHead) {
+				sum := sha256.Sum256([]byte("outro"))
+				h.Hash = hex.EncodeToString(sum[:])
+				return e, h
+			},
+			wantProblem: "o último evento não corresponde à referência",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := testChain(t, key, 10, 4, 8)
+			events, head := tt.tamper(events, testHead(t, key, events))
+
+			got := verifySecurityEvents(bytes.NewReader(encodeEvents(t, events)), &key.PublicKey, head)
+			if tt.wantProblem == "" {
+				if !got.Valid || len(got.Problems) > 0 {
+					t.Fatalf("registro íntegro recusado: %v", got.Problems)
+				}
+				if got.Checkpoints != tt.wantCheckpoints || got.Unanchored != tt.wantUnanchored {
+					t.Fatalf("checkpoints = %d, não ancorados = %d; esperado %d e %d",
+						got.Checkpoints, got.Unanchored, tt.wantCheckpoints, tt.wantUnanchored)
+				}
+				return
+			}
+
+			if got.Valid {
+				t.Fatalf("registro alterado aceito como válido")
+			}
+			for _, p := range got.Problems {
+				if strings.Contains(p, tt.wantProblem) {
+					return
+				}
+			}
+			t.Fatalf("problemas = %q, esperado %q", got.Problems, tt.wantProblem)
+		})
+	}
+}
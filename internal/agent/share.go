@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/types"
+)
+
+// Share concede a outro dispositivo registrado acesso a um pacote já
+// armazenado. Apenas a chave simétrica encriptada é baixada: ela é aberta no
+// TPM local, encriptada novamente para a chave do dispositivo de destino e
+// enviada como uma nova concessão, sem reenviar os dados.
+func (a *Agent) Share(ctx context.Context, operationID string, targetUUID string) (_ *types.Grant, err error) {
+	defer func() {
+		a.logEvent(EventShare, err, types.SecurityEvent{OperationID: operationID, Target: targetUUID})
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	if targetUUID == "" || targetUUID == a.tpmMgr.DeviceUUID {
+		return nil, fmt.Errorf("dispositivo de destino inválido")
+	}
+
+	wrapped, err := a.client.GetWrappedKey(ctx, a.deviceHeader(), operationID)
+	if err != nil {
+		return nil, err
+	}
+
+	localKey, err := a.tpmMgr.Client.RetrieveRSADecryptKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao recuperar chave de decriptação: %w", err)
+	}
+	localID, err := keyID(localKey)
+	if err != nil {
+		return nil, err
+	}
+	if wrapped.KeyID != "" && wrapped.KeyID != localID {
+		return nil, fmt.Errorf("chave do pacote não pertence a este dispositivo")
+	}
+
+	// Só encripta para a chave confirmada pelo usuário
+	targets, err := a.resolveRecipients(ctx, []string{targetUUID})
+	if err != nil {
+		return nil, err
+	}
+
+	symmetricKey, err := a.tpmMgr.Client.RSADecrypt(ctx, wrapped.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao decriptar chave simétrica: %w", err)
+	}
+	rewrapped, err := wrapKey(targets[0], symmetricKey)
+	clear(symmetricKey)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := grantDigest(operationID, &rewrapped)
+	signature, err := a.tpmMgr.Client.SignData(ctx, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("erro ao assinar concessão: %w", err)
+	}
+
+	grant, err := a.client.CreateGrant(ctx, a.deviceHeader(), operationID, &api.GrantRequest{
+		DeviceUUID:   rewrapped.DeviceUUID,
+		KeyID:        rewrapped.KeyID,
+		EncryptedKey: base64.StdEncoding.EncodeToString(rewrapped.EncryptedKey),
+		GrantedBy:    a.tpmMgr.DeviceUUID,
+		Signature:    base64.StdEncoding.EncodeToString(signature),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Operação %s compartilhada com o dispositivo %s", operationID, targetUUID)
+	return grant, nil
+}
+
+// Revoke remove o acesso de um dispositivo a um pacote. Cópias que o
+// dispositivo já tenha decriptado não são afetadas.
+func (a *Agent) Revoke(ctx context.Context, operationID string, targetUUID string) (err error) {
+	defer func() {
+		a.logEvent(EventRevoke, err, types.SecurityEvent{OperationID: operationID, Target: targetUUID})
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	if err := a.client.RevokeGrant(ctx, a.deviceHeader(), operationID, targetUUID); err != nil {
+		return err
+	}
+
+	log.Printf("Acesso do dispositivo %s à operação %s revogado", targetUUID, operationID)
+	return nil
+}
+
+// ListGrants lista os dispositivos com acesso a um pacote
+func (a *Agent) ListGrants(ctx context.Context, operationID string) ([]types.Grant, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	return a.client.ListGrants(ctx, a.deviceHeader(), operationID)
+}
+
+// grantDigest calcula o hash assinado em uma concessão, ligando a chave
+// encriptada à operação e ao dispositivo de destino
+func grantDigest(operationID string, wrapped *types.WrappedKey) [32]byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "tpm-bunker-grant-v1\n%s\n%s\n%s\n", operationID, wrapped.DeviceUUID, wrapped.KeyID)
+	h.Write(wrapped.EncryptedKey)
+
+	var digest [32]byte
+	copy(digest[:], h.Sum(nil))
+	return digest
+}
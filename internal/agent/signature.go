@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+	"tpm-bunker/internal/tpm"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	signatureBundleVersion = 1
+	signatureAlgorithm     = "RSASSA-PKCS1-v1_5-SHA256"
+
+	// SignatureExtension é a extensão padrão dos arquivos de assinatura
+	SignatureExtension = ".tpmsig"
+)
+
+// Origens da chave usada na verificação de uma assinatura destacada
+const (
+	KeySourceLocal   = "local"
+	KeySourceTrusted = "trusted"
+	KeySourceServer  = "server"
+)
+
+// SignatureBundle é a assinatura destacada de um arquivo
+type SignatureBundle struct {
+	Version    int    `json:"version"`
+	Algorithm  string `json:"algorithm"`
+	FileName   string `json:"file_name"`
+	FileDigest string `json:"file_digest"`
+	SignerUUID string `json:"signer_uuid"`
+	PublicKey  string `json:"public_key"`
+	SignedAt   string `json:"signed_at"`
+	Signature  string `json:"signature"`
+}
+
+// signedDigest calcula o hash assinado pelo TPM. Ele liga o conteúdo do
+// arquivo ao dispositivo e ao instante da assinatura; o nome do arquivo fica
+// de fora para que renomeações não invalidem a assinatura.
+func (b *SignatureBundle) signedDigest() [32]byte {
+	msg := fmt.Sprintf("tpm-bunker-signature-v%d\n%s\n%s\n%s\n", b.Version, b.FileDigest, b.SignerUUID, b.SignedAt)
+	return sha256.Sum256([]byte(msg))
+}
+
+// SignFile gera uma assinatura destacada de filePath com a chave de
+// assinatura do TPM e a grava ao lado do arquivo, retornando seu caminho
+func (a *Agent) SignFile(ctx context.Context, filePath string) (string, error) {
+	digest, err := fileDigest(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	pubKey, err := a.tpmMgr.Client.RetrieveRSASignKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("erro ao recuperar chave de assinatura: %w", err)
+	}
+
+	bundle := &SignatureBundle{
+		Version:    signatureBundleVersion,
+		Algorithm:  signatureAlgorithm,
+		FileName:   filepath.Base(filePath),
+		FileDigest: digest,
+		SignerUUID: a.tpmMgr.DeviceUUID,
+		PublicKey:  tpm.GetPublicKeyPEM(pubKey),
+		SignedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+
+	hash := bundle.signedDigest()
+	signature, err := a.tpmMgr.Client.SignData(ctx, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("erro ao assinar arquivo: %w", err)
+	}
+	bundle.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar assinatura: %w", err)
+	}
+
+	bundlePath := filePath + SignatureExtension
+	if err := os.WriteFile(bundlePath, data, 0644); err != nil {
+		return "", fmt.Errorf("erro ao salvar assinatura: %w", err)
+	}
+
+	log.Printf("Assinatura de %s salva em: %s", filePath, bundlePath)
+	return bundlePath, nil
+}
+
+// VerifyFile verifica a assinatura destacada de filePath. A chave usada é a
+// chave local, se o arquivo foi assinado por este dispositivo, a chave
+// fixada de um dispositivo confiável ou, na falta dela, a chave registrada
+// na API para o dispositivo assinante. Esta última não é confirmada: o
+// resultado a marca como não confiável e traz sua impressão digital para
+// conferência. A chave embutida na assinatura nunca é usada sozinha. Se
+// bundlePath for vazio, usa o arquivo com a extensão padrão ao lado de
+// filePath.
+func (a *Agent) VerifyFile(ctx context.Context, filePath string, bundlePath string) (*types.SignatureVerification, error) {
+	if bundlePath == "" {
+		bundlePath = filePath + SignatureExtension
+	}
+
+	data, err := os.ReadFile(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler assinatura: %w", err)
+	}
+
+	var bundle SignatureBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar assinatura: %w", err)
+	}
+
+	result := &types.SignatureVerification{
+		SignerUUID: bundle.SignerUUID,
+		SignedAt:   bundle.SignedAt,
+		FileDigest: bundle.FileDigest,
+	}
+
+	if bundle.Version != signatureBundleVersion || bundle.Algorithm != signatureAlgorithm {
+		result.Error = fmt.Sprintf("formato de assinatura não suportado: v%d %s", bundle.Version, bundle.Algorithm)
+		return result, nil
+	}
+
+	digest, err := fileDigest(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(bundle.FileDigest)) != 1 {
+		result.Error = "o conteúdo do arquivo não corresponde à assinatura"
+		return result, nil
+	}
+
+	pubKey, err := a.verificationKey(ctx, bundle.SignerUUID, result)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter chave do assinante: %w", err)
+	}
+	if result.SignerFingerprint, err = keyID(pubKey); err != nil {
+		return nil, err
+	}
+
+	embedded, err := tpm.ParsePublicKeyPEM(bundle.PublicKey)
+	if err != nil || !embedded.Equal(pubKey) {
+		result.Error = "a chave da assinatura não corresponde à chave do dispositivo assinante"
+		return result, nil
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(bundle.Signature)
+	if err != nil {
+		result.Error = "assinatura mal formada"
+		return result, nil
+	}
+
+	hash := bundle.signedDigest()
+	if err := rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, hash[:], signature); err != nil {
+		result.Error = "assinatura digital inválida"
+		return result, nil
+	}
+
+	result.Valid = true
+	return result, nil
+}
+
+// verificationKey escolhe a chave para verificar uma assinatura destacada e
+// registra em result de onde ela veio
+func (a *Agent) verificationKey(ctx context.Context, signerUUID string, result *types.SignatureVerification) (*rsa.PublicKey, error) {
+	if signerUUID == a.tpmMgr.DeviceUUID {
+		result.KeySource = KeySourceLocal
+		result.Trusted = true
+		return a.tpmMgr.Client.RetrieveRSASignKey(ctx)
+	}
+
+	if pubKey, ok := a.trustedSignKey(signerUUID); ok {
+		result.KeySource = KeySourceTrusted
+		result.Trusted = true
+		return pubKey, nil
+	}
+
+	_, pubKey, err := fetchDeviceKeys(ctx, a.client, signerUUID)
+	if err != nil {
+		return nil, err
+	}
+	if pubKey == nil {
+		return nil, fmt.Errorf("dispositivo %s não possui chave de assinatura registrada", signerUUID)
+	}
+	result.KeySource = KeySourceServer
+	return pubKey, nil
+}
+
+// fileDigest calcula o SHA-256 do conteúdo de um arquivo em hexadecimal
+func fileDigest(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("erro ao abrir arquivo: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("erro ao ler arquivo: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
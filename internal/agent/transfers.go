@@ -0,0 +1,978 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"tpm-bunker/internal/api"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const (
+	transfersDirName  = "transfers"
+	transferStateName = "state.json"
+	transferDataName  = "data.bin"
+
+	// transferChunkSize é pequeno o bastante para que cada parte caiba no
+	// timeout do cliente HTTP mesmo em conexões lentas
+	transferChunkSize = 1 << 20
+	chunkAttempts     = 4
+	chunkTimeout      = 2 * time.Minute
+
+	uploadPrefix   = "up-"
+	downloadPrefix = "down-"
+)
+
+// transferState é o estado de uma transferência em partes, gravado em
+// disco para que ela possa continuar após reiniciar o aplicativo. Os dados
+// ficam ao lado, já encriptados.
+type transferState struct {
+	ID        string `json:"id"`
+	Direction string `json:"direction"`
+	CreatedAt string `json:"created_at"`
+
+	ChunkSize    int      `json:"chunk_size"`
+	ChunkDigests []string `json:"chunk_digests"`
+	Size         int64    `json:"size"`
+	Digest       string   `json:"sha256"`
+	Done         []bool   `json:"done"`
+
+	// Envio: pacote, sessão no servidor e o que registrar ao concluir. O ID
+	// da transferência é a chave de idempotência do envio: repeti-lo após
+	// uma resposta perdida retorna a operação já criada, sem duplicá-la
+	Upload   *api.UploadInit          `json:"upload,omitempty"`
+	UploadID string                   `json:"upload_id,omitempty"`
+	Summary  *types.EncryptionSummary `json:"summary,omitempty"`
+	Path     string                   `json:"path,omitempty"`
+	Version  *VersionInfo             `json:"version,omitempty"`
+	// Backup agendado que criou o envio; a retenção desses pacotes é a do
+	// job, aplicada ao fim de cada execução, e não a global
+	JobID string `json:"job_id,omitempty"`
+
+	// Recebimento. Um recebimento completo já foi montado e verificado e
+	// fica em disco até o usuário abrir o arquivo. Em um envio, OperationID
+	// é a operação já criada com a chave dele
+	OperationID string                `json:"operation_id,omitempty"`
+	Manifest    *api.DownloadManifest `json:"manifest,omitempty"`
+	Complete    bool                  `json:"complete,omitempty"`
+}
+
+// errTransferBusy indica que a transferência já está em andamento
+var errTransferBusy = errors.New("transferência em andamento")
+
+// errChunkedUnsupported indica uma API sem as rotas de envio em partes
+var errChunkedUnsupported = errors.New("a API não oferece envio em partes")
+
+// errTransferRejected indica um envio recusado pela API. Repetir a mesma
+// requisição não muda a resposta, então o pacote sai da fila.
+var errTransferRejected = errors.New("envio recusado pela API")
+
+// errTransferPending indica um envio que continua na fila de saída
+var errTransferPending = errors.New("envio na fila de saída")
+
+// errTransferDiscarded indica um envio que saiu da fila sem armazenar o
+// pacote, recusado pela API ou cancelado
+var errTransferDiscarded = errors.New("envio descartado sem armazenar o pacote")
+
+// errPackageNotFound indica um pacote que o servidor informa não ter
+var errPackageNotFound = errors.New("pacote não encontrado no servidor")
+
+// errDigestMismatch indica dados recebidos que não correspondem ao digest
+// do pacote
+var errDigestMismatch = errors.New("digest não confere")
+
+// transferStore guarda as transferências pendentes em config.Dir()
+type transferStore struct {
+	mutex sync.Mutex
+
+	// Transferências em andamento nesta sessão
+	active map[string]bool
+}
+
+func transfersDir() (string, error) {
+	base, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, transfersDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("erro ao criar diretório de transferências: %w", err)
+	}
+	return dir, nil
+}
+
+func (t *transferState) dir() (string, error) {
+	base, err := transfersDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, t.ID), nil
+}
+
+func (t *transferState) dataPath() (string, error) {
+	dir, err := t.dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, transferDataName), nil
+}
+
+// save grava o estado de forma atômica
+func (t *transferState) save() error {
+	dir, err := t.dir()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, transferStateName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// remove apaga o estado e os dados da transferência
+func (t *transferState) remove() {
+	dir, err := t.dir()
+	if err != nil {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Aviso: erro ao remover transferência %s: %v", t.ID, err)
+	}
+}
+
+func (t *transferState) chunkCount() int {
+	return len(t.ChunkDigests)
+}
+
+func (t *transferState) chunkRange(index int) (int64, int64) {
+	start := int64(index) * int64(t.ChunkSize)
+	end := start + int64(t.ChunkSize)
+	if end > t.Size {
+		end = t.Size
+	}
+	return start, end
+}
+
+// loadTransfer lê o estado de uma transferência pelo ID
+func loadTransfer(id string) (*transferState, error) {
+	base, err := transfersDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(base, filepath.Base(id), transferStateName))
+	if err != nil {
+		return nil, err
+	}
+	var t transferState
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("estado de transferência inválido: %w", err)
+	}
+	return &t, nil
+}
+
+// loadTransfers lê todas as transferências pendentes
+func loadTransfers() ([]*transferState, error) {
+	base, err := transfersDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil, err
+	}
+
+	var transfers []*transferState
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		t, err := loadTransfer(e.Name())
+		if errors.Is(err, fs.ErrNotExist) {
+			// Envio ainda sendo cifrado, sem estado gravado
+			continue
+		}
+		if err != nil {
+			log.Printf("Aviso: transferência %s ignorada: %v", e.Name(), err)
+			continue
+		}
+		transfers = append(transfers, t)
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].CreatedAt < transfers[j].CreatedAt })
+	return transfers, nil
+}
+
+// claim marca a transferência como em andamento nesta sessão, evitando que
+// duas goroutines a retomem ao mesmo tempo
+func (s *transferStore) claim(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.active == nil {
+		s.active = make(map[string]bool)
+	}
+	if s.active[id] {
+		return false
+	}
+	s.active[id] = true
+	return true
+}
+
+func (s *transferStore) release(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.active, id)
+}
+
+// chunkDigests divide data em partes e calcula o digest de cada uma
+func chunkDigests(data []byte, chunkSize int) []string {
+	var digests []string
+	for start := 0; start < len(data); start += chunkSize {
+		end := start + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[start:end])
+		digests = append(digests, hex.EncodeToString(sum[:]))
+	}
+	return digests
+}
+
+// withRetry executa fn com timeout por tentativa e espera crescente entre
+// tentativas. Respostas 4xx da API não são repetidas.
+func withRetry(ctx context.Context, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < chunkAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(1<<(attempt-1)) * time.Second):
+			}
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, chunkTimeout)
+		err = fn(attemptCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil || api.IsClientError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// routeMissing informa se a API respondeu que a rota não existe
+func routeMissing(err error) bool {
+	return api.HasStatus(err, http.StatusNotFound) || api.HasStatus(err, http.StatusMethodNotAllowed)
+}
+
+// commitContext retorna o contexto da requisição que cria o registro no
+// servidor. Uma vez iniciada, ela não é interrompida por cancelamento: a
+// resposta descartada deixaria no servidor um registro sem dono, que quem
+// cancelou não teria como desfazer.
+func commitContext(ctx context.Context) (context.Context, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return context.WithoutCancel(ctx), nil
+}
+
+// uploadWriter grava na fila de saída o pacote cifrado de um envio,
+// calculando o digest de cada parte à medida que os dados chegam
+type uploadWriter struct {
+	file      *os.File
+	chunkSize int
+	chunk     hash.Hash
+	filled    int
+	digests   []string
+}
+
+func newUploadWriter(file *os.File, chunkSize int) *uploadWriter {
+	return &uploadWriter{file: file, chunkSize: chunkSize, chunk: sha256.New()}
+}
+
+func (w *uploadWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	for rest := p[:n]; len(rest) > 0; {
+		k := min(w.chunkSize-w.filled, len(rest))
+		w.chunk.Write(rest[:k])
+		w.filled += k
+		rest = rest[k:]
+		if w.filled == w.chunkSize {
+			w.endChunk()
+		}
+	}
+	return n, err
+}
+
+func (w *uploadWriter) endChunk() {
+	w.digests = append(w.digests, hex.EncodeToString(w.chunk.Sum(nil)))
+	w.chunk.Reset()
+	w.filled = 0
+}
+
+// Close conclui a última parte e fecha o arquivo
+func (w *uploadWriter) Close() error {
+	if w.filled > 0 {
+		w.endChunk()
+	}
+	return w.file.Close()
+}
+
+// createUpload cria na fila de saída um envio ainda sem estado e abre o
+// arquivo em que o pacote é cifrado. A transferência é reservada antes de
+// chegar ao disco: o worker da fila a ignora até queueUpload gravar o
+// estado e quem chama a liberar. Em caso de erro, quem chama a descarta
+// com dropUpload.
+func (a *Agent) createUpload() (*transferState, *uploadWriter, error) {
+	t := &transferState{
+		ID:        uploadPrefix + uuid.NewString(),
+		Direction: "upload",
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		ChunkSize: transferChunkSize,
+	}
+
+	a.transfers.claim(t.ID)
+	dir, err := t.dir()
+	if err != nil {
+		a.transfers.release(t.ID)
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		a.transfers.release(t.ID)
+		return nil, nil, fmt.Errorf("erro ao criar transferência: %w", err)
+	}
+	dataPath, _ := t.dataPath()
+	file, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		a.dropUpload(t)
+		return nil, nil, fmt.Errorf("erro ao criar pacote para envio: %w", err)
+	}
+	return t, newUploadWriter(file, t.ChunkSize), nil
+}
+
+// removeUnqueuedUploads apaga os envios que ficaram sem estado por uma
+// encriptação interrompida. Os que estão sendo cifrados nesta sessão estão
+// reservados e são mantidos.
+func (a *Agent) removeUnqueuedUploads() {
+	base, err := transfersDir()
+	if err != nil {
+		return
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), uploadPrefix) {
+			continue
+		}
+		statePath := filepath.Join(base, e.Name(), transferStateName)
+		if _, err := os.Stat(statePath); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if !a.transfers.claim(e.Name()) {
+			continue
+		}
+		// O estado pode ter sido gravado antes da reserva
+		if _, err := os.Stat(statePath); errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Removendo envio interrompido antes de entrar na fila: %s", e.Name())
+			(&transferState{ID: e.Name()}).remove()
+		}
+		a.transfers.release(e.Name())
+	}
+}
+
+// dropUpload descarta um envio criado por createUpload que não chegou a
+// ser gravado na fila
+func (a *Agent) dropUpload(t *transferState) {
+	t.remove()
+	a.transfers.release(t.ID)
+}
+
+// queueUpload grava o estado de um envio cujo pacote já foi cifrado em w,
+// já fechado. A partir daí o envio sobrevive a falhas de rede e ao
+// reinício do aplicativo. A transferência continua reservada: o worker da
+// fila só a envia depois que quem chama a liberar, e quem chama ainda pode
+// descartá-la sem que nada chegue ao servidor. Em caso de erro o envio é
+// descartado.
+func (a *Agent) queueUpload(t *transferState, w *uploadWriter, result *EncryptionResult, summary *types.EncryptionSummary, path string, version *VersionInfo, jobID string) error {
+	t.ChunkDigests = w.digests
+	t.Size = result.CiphertextSize
+	t.Digest = hex.EncodeToString(result.CiphertextDigest)
+	t.Done = make([]bool, t.chunkCount())
+	t.Summary = summary
+	t.Path = path
+	t.Version = version
+	t.JobID = jobID
+	summary.TransferID = t.ID
+	t.Upload = &api.UploadInit{
+		Size:             t.Size,
+		ChunkSize:        t.ChunkSize,
+		ChunkDigests:     t.ChunkDigests,
+		Digest:           t.Digest,
+		EncryptedKey:     result.EncryptedSymmetricKey,
+		WrappedKeys:      result.WrappedKeys,
+		DigitalSignature: result.DigitalSignature,
+		HashOriginal:     result.HashOriginal,
+		Metadata:         result.Metadata,
+	}
+
+	if err := t.save(); err != nil {
+		a.dropUpload(t)
+		return fmt.Errorf("erro ao gravar estado do envio: %w", err)
+	}
+	return nil
+}
+
+// sendQueued envia um pacote da fila de saída e, concluído o envio,
+// registra a versão criada e o retira da fila. Se outra goroutine já está
+// enviando o mesmo pacote, retorna errTransferBusy.
+func (a *Agent) sendQueued(ctx context.Context, t *transferState) error {
+	if !a.transfers.claim(t.ID) {
+		return errTransferBusy
+	}
+	defer a.transfers.release(t.ID)
+	return a.sendClaimed(ctx, t)
+}
+
+// sendClaimed envia um pacote da fila de saída já reservado por quem chama.
+// Um pacote com sessão de envio aberta é concluído por ela, mesmo que caiba
+// em uma parte.
+func (a *Agent) sendClaimed(ctx context.Context, t *transferState) error {
+	var stored *api.EncryptionResponse
+	var err error
+	if t.chunkCount() <= 1 && t.UploadID == "" {
+		stored, err = a.sendSingle(ctx, t)
+	} else {
+		stored, err = a.sendChunks(ctx, t)
+		if errors.Is(err, errChunkedUnsupported) {
+			log.Printf("Aviso: %v; enviando %s em uma única requisição", err, t.ID)
+			stored, err = a.sendSingle(ctx, t)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	t.remove()
+
+	if t.Summary != nil {
+		t.Summary.OperationID = stored.OperationID
+		log.Printf("Envio de %s concluído: operação %s", t.Summary.FileName, stored.OperationID)
+	}
+	// O evento da encriptação é anterior ao envio e não tem a operação
+	a.logEvent(EventEncrypt, nil, types.SecurityEvent{
+		Target:      t.Path,
+		OperationID: stored.OperationID,
+		Detail:      "envio concluído",
+	})
+	if stored.OperationID != "" && t.Version != nil && t.Summary != nil {
+		a.versions.record(t.Path, t.Version, stored.OperationID, t.Summary.FileName, t.Summary.OriginalSize)
+		if t.JobID == "" {
+			a.applyRetention(ctx, t.Version.FileID)
+		}
+	}
+	return nil
+}
+
+// sendSingle envia em uma única requisição um pacote que cabe em uma parte
+func (a *Agent) sendSingle(ctx context.Context, t *transferState) (*api.EncryptionResponse, error) {
+	dataPath, err := t.dataPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler pacote para envio: %w", err)
+	}
+
+	payload := &api.EncryptionRequest{
+		EncryptedData:    data,
+		EncryptedKey:     t.Upload.EncryptedKey,
+		WrappedKeys:      t.Upload.WrappedKeys,
+		DigitalSignature: t.Upload.DigitalSignature,
+		HashOriginal:     t.Upload.HashOriginal,
+		Metadata:         t.Upload.Metadata,
+		IdempotencyKey:   t.ID,
+	}
+
+	commitCtx, err := commitContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	progressFrom(ctx).setPhase(PhaseUpload, t.Size)
+	var stored api.EncryptionResponse
+	err = withRetry(commitCtx, func(ctx context.Context) error {
+		response, err := a.client.EncryptRequest(ctx, http.MethodPost, "operations/store_data/", a.deviceHeader(), payload)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(response, &stored); err != nil {
+			log.Printf("Aviso: resposta de armazenamento inesperada: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	progressFrom(ctx).add(t.Size)
+	return &stored, nil
+}
+
+// sendChunks envia as partes que faltam e conclui o envio
+func (a *Agent) sendChunks(ctx context.Context, t *transferState) (*api.EncryptionResponse, error) {
+	if err := a.stageChunks(ctx, t); err != nil {
+		return nil, err
+	}
+	if t.UploadID == "" && t.OperationID != "" {
+		return &api.EncryptionResponse{Status: "success", OperationID: t.OperationID}, nil
+	}
+
+	commitCtx, err := commitContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stored *api.EncryptionResponse
+	err = withRetry(commitCtx, func(ctx context.Context) error {
+		var err error
+		stored, err = a.client.CompleteUpload(ctx, a.deviceHeader(), t.UploadID, t.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// stageChunks abre a sessão de envio, ou retoma a existente, e envia as
+// partes que faltam, sem concluir o envio. Até a conclusão, o servidor não
+// cria registro do pacote.
+func (a *Agent) stageChunks(ctx context.Context, t *transferState) error {
+	header := a.deviceHeader()
+
+	// O servidor é a referência do que já foi recebido; uma sessão expirada
+	// é aberta de novo
+	var status *api.UploadStatus
+	var err error
+	if t.UploadID != "" {
+		status, err = a.client.GetUpload(ctx, header, t.UploadID)
+		if err != nil {
+			log.Printf("Aviso: sessão de envio %s indisponível, reiniciando: %v", t.UploadID, err)
+		}
+	}
+	if status == nil {
+		t.Upload.IdempotencyKey = t.ID
+		status, err = a.client.CreateUpload(ctx, header, t.Upload)
+		if routeMissing(err) {
+			return errChunkedUnsupported
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Um envio anterior com a mesma chave já foi concluído, mas a resposta
+	// se perdeu ou o aplicativo parou antes de retirá-lo da fila
+	if status.OperationID != "" {
+		t.UploadID = ""
+		t.OperationID = status.OperationID
+		return t.save()
+	}
+	t.UploadID = status.UploadID
+	for i := range t.Done {
+		t.Done[i] = false
+	}
+	for _, index := range status.Received {
+		if index >= 0 && index < len(t.Done) {
+			t.Done[index] = true
+		}
+	}
+	if err := t.save(); err != nil {
+		return err
+	}
+
+	dataPath, err := t.dataPath()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return fmt.Errorf("erro ao abrir pacote para envio: %w", err)
+	}
+	defer f.Close()
+
+	p := progressFrom(ctx)
+	p.setPhase(PhaseUpload, t.Size)
+	for index, done := range t.Done {
+		if done {
+			start, end := t.chunkRange(index)
+			p.add(end - start)
+		}
+	}
+
+	for index, done := range t.Done {
+		if done {
+			continue
+		}
+
+		start, end := t.chunkRange(index)
+		chunk := make([]byte, end-start)
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return fmt.Errorf("erro ao ler parte %d: %w", index, err)
+		}
+		sum := sha256.Sum256(chunk)
+		if hex.EncodeToString(sum[:]) != t.ChunkDigests[index] {
+			return fmt.Errorf("parte %d corrompida no disco", index)
+		}
+
+		err := withRetry(ctx, func(ctx context.Context) error {
+			return a.client.PutChunk(ctx, header, t.UploadID, index, chunk, t.ChunkDigests[index])
+		})
+		if err != nil {
+			return err
+		}
+
+		t.Done[index] = true
+		if err := t.save(); err != nil {
+			return err
+		}
+		p.add(end - start)
+	}
+	return nil
+}
+
+// downloadChunked baixa um pacote em partes para decriptá-lo, aproveitando
+// um recebimento anterior da mesma operação, e o retira da fila
+func (a *Agent) downloadChunked(ctx context.Context, operationID string) (*types.DecryptResponse, error) {
+	t, response, err := a.receiveChunked(ctx, operationID)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		t.remove()
+	}
+	return response, nil
+}
+
+// receiveChunked baixa em partes os dados de um pacote, continuando um
+// recebimento anterior da mesma operação, e o marca como completo. Os dados
+// continuam em disco até quem chama retirar a transferência da fila. Se a
+// API não oferece o manifesto, usa a requisição única sem novas tentativas,
+// sem transferência em disco.
+func (a *Agent) receiveChunked(ctx context.Context, operationID string) (*transferState, *types.DecryptResponse, error) {
+	header := a.deviceHeader()
+	p := progressFrom(ctx)
+	p.setPhase(PhaseDownload, 0)
+
+	var manifest *api.DownloadManifest
+	err := withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		manifest, err = a.client.GetManifest(ctx, header, operationID)
+		return err
+	})
+	if routeMissing(err) {
+		log.Printf("Aviso: manifesto indisponível, usando requisição única: %v", err)
+		response, err := a.client.DecryptRequest(ctx, http.MethodGet, "operations/retrieve_data/", header, operationID)
+		if api.HasStatus(err, http.StatusNotFound) {
+			return nil, nil, fmt.Errorf("%w: %w", errPackageNotFound, err)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		p.add(int64(len(response.EncryptedData)))
+		return nil, response, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if manifest.ChunkSize <= 0 {
+		return nil, nil, fmt.Errorf("manifesto inválido para %s", operationID)
+	}
+
+	id := downloadPrefix + filepath.Base(operationID)
+	if !a.transfers.claim(id) {
+		return nil, nil, fmt.Errorf("recebimento de %s já em andamento", operationID)
+	}
+	defer a.transfers.release(id)
+
+	// Um estado anterior só é aproveitado se o pacote não mudou
+	t, err := loadTransfer(id)
+	if err != nil || t.Manifest == nil || t.Digest != manifest.Digest || t.Size != manifest.Size {
+		if t != nil {
+			t.remove()
+		}
+		t = &transferState{
+			ID:           id,
+			Direction:    "download",
+			CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+			ChunkSize:    manifest.ChunkSize,
+			ChunkDigests: manifest.ChunkDigests,
+			Size:         manifest.Size,
+			Digest:       manifest.Digest,
+			Done:         make([]bool, len(manifest.ChunkDigests)),
+			OperationID:  operationID,
+		}
+	}
+	t.Manifest = manifest
+
+	dir, err := t.dir()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("erro ao criar transferência: %w", err)
+	}
+	if err := t.save(); err != nil {
+		return nil, nil, err
+	}
+
+	dataPath, _ := t.dataPath()
+	f, err := os.OpenFile(dataPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao abrir recebimento: %w", err)
+	}
+	defer f.Close()
+	if err := f.Truncate(t.Size); err != nil {
+		return nil, nil, err
+	}
+
+	p.setPhase(PhaseDownload, t.Size)
+	for index, done := range t.Done {
+		if done {
+			start, end := t.chunkRange(index)
+			p.add(end - start)
+		}
+	}
+
+	for index, done := range t.Done {
+		if done {
+			continue
+		}
+
+		var chunk []byte
+		err := withRetry(ctx, func(ctx context.Context) error {
+			data, err := a.client.GetChunk(ctx, header, operationID, index)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			if hex.EncodeToString(sum[:]) != t.ChunkDigests[index] {
+				return fmt.Errorf("parte %d: %w", index, errDigestMismatch)
+			}
+			chunk = data
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		start, end := t.chunkRange(index)
+		if int64(len(chunk)) != end-start {
+			return nil, nil, fmt.Errorf("parte %d com tamanho inesperado", index)
+		}
+		if _, err := f.WriteAt(chunk, start); err != nil {
+			return nil, nil, fmt.Errorf("erro ao gravar parte %d: %w", index, err)
+		}
+		if err := f.Sync(); err != nil {
+			return nil, nil, err
+		}
+
+		t.Done[index] = true
+		if err := t.save(); err != nil {
+			return nil, nil, err
+		}
+		p.add(end - start)
+	}
+
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(data)
+	if t.Digest != "" && subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(t.Digest))) != 1 {
+		t.remove()
+		return nil, nil, fmt.Errorf("pacote: %w", errDigestMismatch)
+	}
+
+	encryptedKey, err := base64.StdEncoding.DecodeString(manifest.EncryptedSymmetricKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erro ao decodificar chave simétrica: %w", err)
+	}
+
+	if !t.Complete {
+		t.Complete = true
+		if err := t.save(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return t, &types.DecryptResponse{
+		EncryptedData:         data,
+		EncryptedSymmetricKey: encryptedKey,
+		WrappedKeys:           manifest.WrappedKeys,
+		DigitalSignature:      manifest.DigitalSignature,
+		SignerUUID:            manifest.DeviceUUID,
+		FileName:              manifest.FileName,
+	}, nil
+}
+
+// processTransfers retoma as transferências pendentes, por exemplo de
+// uma sessão anterior. Envios concluídos são registrados no histórico de
+// versões como se tivessem terminado na sessão original. Retorna o último
+// erro encontrado; as transferências com falha continuam pendentes, exceto
+// envios recusados pela API, que são descartados.
+func (a *Agent) processTransfers(ctx context.Context) error {
+	transfers, err := loadTransfers()
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, t := range transfers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		switch t.Direction {
+		case "upload":
+			err = a.sendQueued(ctx, t)
+			if err == errTransferBusy {
+				err = nil
+			}
+			if api.IsClientError(err) {
+				a.rejectQueued(t, err)
+				err = fmt.Errorf("%w: %w", errTransferRejected, err)
+			}
+		case "download":
+			// O recebimento é concluído e mantido em disco; os dados só
+			// são decriptados quando o usuário abrir o arquivo, que
+			// aproveita as partes já recebidas
+			if !t.Complete {
+				_, _, err = a.receiveChunked(ctx, t.OperationID)
+			}
+		}
+		if err != nil {
+			log.Printf("Transferência %s continua pendente: %v", t.ID, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// queuedOperation retorna a operação criada pelo envio transferID, da
+// versão version do arquivo lógico fileID. Concluído, o envio sai da fila e
+// fica no histórico de versões; fora da fila e sem versão registrada, ele
+// foi descartado.
+func (a *Agent) queuedOperation(transferID, fileID string, version int) (string, error) {
+	if _, err := loadTransfer(transferID); err == nil {
+		return "", errTransferPending
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	if f, ok := a.versions.get(fileID); ok {
+		for _, v := range f.Versions {
+			if v.Version == version && v.OperationID != "" {
+				return v.OperationID, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", errTransferDiscarded, transferID)
+}
+
+// rejectQueued descarta um envio da fila recusado pela API e registra a
+// falha, já que quem encriptou o arquivo foi informado de que ele estava na
+// fila
+func (a *Agent) rejectQueued(t *transferState, err error) {
+	log.Printf("Envio %s recusado pela API e descartado: %v", t.ID, err)
+	a.logEvent(EventEncrypt, err, types.SecurityEvent{
+		Target: t.Path,
+		Detail: "envio da fila de saída descartado",
+	})
+	a.discardTransfer(t)
+}
+
+// ListTransfers lista as transferências pendentes
+func (a *Agent) ListTransfers() ([]types.Transfer, error) {
+	transfers, err := loadTransfers()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]types.Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		item := types.Transfer{
+			ID:          t.ID,
+			Direction:   t.Direction,
+			OperationID: t.OperationID,
+			Size:        t.Size,
+			ChunkCount:  t.chunkCount(),
+			Complete:    t.Complete,
+			CreatedAt:   t.CreatedAt,
+		}
+		for _, done := range t.Done {
+			if done {
+				item.ChunksDone++
+			}
+		}
+		if t.Summary != nil {
+			item.FileName = t.Summary.FileName
+		}
+		a.transfers.mutex.Lock()
+		item.Active = a.transfers.active[t.ID]
+		a.transfers.mutex.Unlock()
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// CancelTransfer descarta uma transferência pendente. A sessão de envio no
+// servidor expira sozinha.
+func (a *Agent) CancelTransfer(id string) error {
+	if !a.transfers.claim(id) {
+		return fmt.Errorf("transferência %s em andamento", id)
+	}
+	defer a.transfers.release(id)
+
+	t, err := loadTransfer(id)
+	if err != nil {
+		return fmt.Errorf("transferência não encontrada: %s", id)
+	}
+	a.discardTransfer(t)
+	return nil
+}
+
+// discardTransfer retira a transferência da fila e descarta no servidor
+// as partes de um envio já iniciado
+func (a *Agent) discardTransfer(t *transferState) {
+	if t.Direction == "upload" && t.UploadID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := a.client.AbortUpload(ctx, a.deviceHeader(), t.UploadID); err != nil {
+			log.Printf("Aviso: envio %s não descartado no servidor: %v", t.UploadID, err)
+		}
+		cancel()
+	}
+	t.remove()
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestChunkRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int64
+		chunkSize int
+		index     int
+		wantStart int64
+		wantEnd   int64
+	}{
+		{name: "primeira parte", size: 10, chunkSize: 4, index: 0, wantStart: 0, wantEnd: 4},
+		{name: "parte do meio", size: 10, chunkSize: 4, index: 1, wantStart: 4, wantEnd: 8},
+		{name: "última parte menor", size: 10, chunkSize: 4, index: 2, wantStart: 8, wantEnd: 10},
+		{name: "última parte exata", size: 12, chunkSize: 4, index: 2, wantStart: 8, wantEnd: 12},
+		{name: "parte única menor que o tamanho", size: 3, chunkSize: 4, index: 0, wantStart: 0, wantEnd: 3},
+		{name: "pacote vazio", size: 0, chunkSize: 4, index: 0, wantStart: 0, wantEnd: 0},
+		// O produto não pode estourar int
+		{name: "pacote grande", size: 5<<30 + 1, chunkSize: transferChunkSize, index: 5 << 10, wantStart: 5 << 30, wantEnd: 5<<30 + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := &transferState{Size: tt.size, ChunkSize: tt.chunkSize}
+			start, end := ts.chunkRange(tt.index)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Fatalf("chunkRange(%d) = [%d, %d), esperado [%d, %d)", tt.index, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestChunkDigestsMatchRanges(t *testing.T) {
+	data := make([]byte, 10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	ts := &transferState{Size: int64(len(data)), ChunkSize: 4, ChunkDigests: chunkDigests(data, 4)}
+	if ts.chunkCount() != 3 {
+		t.Fatalf("chunkCount = %d, esperado 3", ts.chunkCount())
+	}
+	for index := range ts.ChunkDigests {
+		start, end := ts.chunkRange(index)
+		if got := chunkDigests(data[start:end], 4); len(got) != 1 || got[0] != ts.ChunkDigests[index] {
+			t.Errorf("parte %d: digest do intervalo [%d, %d) não confere", index, start, end)
+		}
+	}
+}
+
+func TestUploadWriterChunkDigests(t *testing.T) {
+	data := make([]byte, 23)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	// Escritas de tamanhos variados, cruzando as fronteiras das partes
+	writes := [][]int{{23}, {1, 3, 4, 15}, {5, 5, 5, 8}, {0, 8, 0, 15}}
+
+	for _, sizes := range writes {
+		file, err := os.Create(filepath.Join(t.TempDir(), transferDataName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := newUploadWriter(file, 4)
+		rest := data
+		for _, n := range sizes {
+			if _, err := w.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(w.digests, chunkDigests(data, 4)) {
+			t.Errorf("%v: digests das partes não conferem", sizes)
+		}
+		written, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(written, data) {
+			t.Errorf("%v: conteúdo gravado alterado", sizes)
+		}
+	}
+}
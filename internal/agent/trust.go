@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"tpm-bunker/internal/tpm"
+	"tpm-bunker/internal/types"
+)
+
+// normalizeFingerprint aceita a impressão digital com espaços, dois-pontos
+// e letras maiúsculas, como costuma ser exibida
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", ":", "", "-", "").Replace(fingerprint))
+}
+
+// DeviceFingerprint retorna a impressão digital da chave de assinatura deste
+// dispositivo, a ser conferida por quem for confiar nele
+func (a *Agent) DeviceFingerprint(ctx context.Context) (string, error) {
+	signKey, err := a.tpmMgr.Client.RetrieveRSASignKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("erro ao recuperar chave de assinatura: %w", err)
+	}
+	return keyID(signKey)
+}
+
+// DeviceEncryptionFingerprint retorna a impressão digital da chave de
+// encriptação deste dispositivo, a ser conferida por quem for encriptar
+// para ele
+func (a *Agent) DeviceEncryptionFingerprint(ctx context.Context) (string, error) {
+	encryptKey, err := a.tpmMgr.Client.RetrieveRSADecryptKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("erro ao recuperar chave de encriptação: %w", err)
+	}
+	return keyID(encryptKey)
+}
+
+// matchFingerprint confere a chave com a impressão digital informada
+func matchFingerprint(key *rsa.PublicKey, fingerprint string) (string, bool, error) {
+	id, err := keyID(key)
+	if err != nil {
+		return "", false, err
+	}
+	return id, subtle.ConstantTimeCompare([]byte(id), []byte(fingerprint)) == 1, nil
+}
+
+// TrustedDevices lista os dispositivos cujas assinaturas são aceitas
+func (a *Agent) TrustedDevices() []types.TrustedDevice {
+	return a.config.Trusted()
+}
+
+// TrustDevice fixa a chave de assinatura de outro dispositivo e, se
+// encryptFingerprint for informada, também a de encriptação. As chaves vêm
+// do registro da API, mas só são aceitas se corresponderem às impressões
+// digitais informadas, obtidas do próprio dispositivo por outro canal;
+// assim o servidor não consegue trocá-las. Chamar de novo substitui as
+// chaves fixadas, confirmando uma troca.
+func (a *Agent) TrustDevice(ctx context.Context, deviceUUID, fingerprint, encryptFingerprint, name string) (device *types.TrustedDevice, err error) {
+	defer func() {
+		a.logEvent(EventDeviceTrusted, err, types.SecurityEvent{Target: deviceUUID})
+	}()
+
+	fingerprint = normalizeFingerprint(fingerprint)
+	encryptFingerprint = normalizeFingerprint(encryptFingerprint)
+	if deviceUUID == "" || deviceUUID == a.tpmMgr.DeviceUUID {
+		return nil, fmt.Errorf("dispositivo inválido")
+	}
+	if len(fingerprint) != 64 || (encryptFingerprint != "" && len(encryptFingerprint) != 64) {
+		return nil, fmt.Errorf("impressão digital inválida")
+	}
+
+	encryptKey, signKey, err := fetchDeviceKeys(ctx, a.client, deviceUUID)
+	if err != nil {
+		return nil, err
+	}
+	if signKey == nil {
+		return nil, fmt.Errorf("dispositivo %s não possui chave de assinatura registrada", deviceUUID)
+	}
+	id, ok, err := matchFingerprint(signKey, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("a chave registrada de %s não corresponde à impressão digital informada", deviceUUID)
+	}
+
+	device = &types.TrustedDevice{
+		UUID:        deviceUUID,
+		Name:        strings.TrimSpace(name),
+		Fingerprint: id,
+		SignKey:     tpm.GetPublicKeyPEM(signKey),
+		AddedAt:     time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if encryptFingerprint != "" {
+		if encryptKey == nil {
+			return nil, fmt.Errorf("dispositivo %s não possui chave de encriptação registrada", deviceUUID)
+		}
+		encryptID, ok, err := matchFingerprint(encryptKey, encryptFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("a chave de encriptação registrada de %s não corresponde à impressão digital informada", deviceUUID)
+		}
+		device.EncryptFingerprint = encryptID
+		device.EncryptKey = tpm.GetPublicKeyPEM(encryptKey)
+	}
+
+	devices := []types.TrustedDevice{*device}
+	for _, d := range a.config.Trusted() {
+		if d.UUID != deviceUUID {
+			devices = append(devices, d)
+		}
+	}
+	if err := a.config.SetTrusted(devices); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Dispositivo %s marcado como confiável", deviceUUID)
+	return device, nil
+}
+
+// UntrustDevice deixa de aceitar as assinaturas de um dispositivo
+func (a *Agent) UntrustDevice(deviceUUID string) (err error) {
+	defer func() {
+		a.logEvent(EventDeviceUntrusted, err, types.SecurityEvent{Target: deviceUUID})
+	}()
+
+	var devices []types.TrustedDevice
+	found := false
+	for _, d := range a.config.Trusted() {
+		if d.UUID == deviceUUID {
+			found = true
+			continue
+		}
+		devices = append(devices, d)
+	}
+	if !found {
+		return fmt.Errorf("dispositivo %s não é confiável", deviceUUID)
+	}
+	return a.config.SetTrusted(devices)
+}
+
+// trustedSignKey retorna a chave de assinatura fixada de um dispositivo
+// confiável
+func (a *Agent) trustedSignKey(deviceUUID string) (*rsa.PublicKey, bool) {
+	return a.trustedKey(deviceUUID, func(d types.TrustedDevice) string { return d.SignKey })
+}
+
+// trustedEncryptKey retorna a chave de encriptação fixada de um dispositivo
+// confiável
+func (a *Agent) trustedEncryptKey(deviceUUID string) (*rsa.PublicKey, bool) {
+	return a.trustedKey(deviceUUID, func(d types.TrustedDevice) string { return d.EncryptKey })
+}
+
+func (a *Agent) trustedKey(deviceUUID string, pem func(types.TrustedDevice) string) (*rsa.PublicKey, bool) {
+	for _, d := range a.config.Trusted() {
+		if d.UUID != deviceUUID {
+			continue
+		}
+		if pem(d) == "" {
+			return nil, false
+		}
+		key, err := tpm.ParsePublicKeyPEM(pem(d))
+		if err != nil {
+			log.Printf("Aviso: chave fixada de %s inválida: %v", deviceUUID, err)
+			return nil, false
+		}
+		return key, true
+	}
+	return nil, false
+}
+
+// publishEncryptionKey envia ao registro a chave de encriptação deste
+// dispositivo quando ele foi registrado sem ela, antes de a chave existir,
+// ou com outra
+func (a *Agent) publishEncryptionKey(ctx context.Context) error {
+	localKey, err := a.tpmMgr.Client.RetrieveRSADecryptKey(ctx)
+	if err != nil {
+		return fmt.Errorf("erro ao recuperar chave de encriptação: %w", err)
+	}
+
+	registered, _, err := fetchDeviceKeys(ctx, a.client, a.tpmMgr.DeviceUUID)
+	if err != nil {
+		return err
+	}
+	if registered != nil && registered.Equal(localKey) {
+		return nil
+	}
+
+	if err := a.client.SetEncryptionKey(ctx, a.deviceHeader(), a.tpmMgr.DeviceUUID, tpm.GetPublicKeyPEM(localKey)); err != nil {
+		return err
+	}
+	log.Printf("Chave de encriptação publicada no registro")
+	return nil
+}
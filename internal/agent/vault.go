@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"tpm-bunker/internal/types"
+)
+
+// VaultAndRemove encripta e envia filePath, verifica o pacote armazenado
+// decriptando-o novamente e comparando digests e, somente se a verificação
+// passar e o original não tiver mudado nesse intervalo, remove o original
+// de forma segura. A remoção é melhor esforço: em sistemas de arquivos
+// copy-on-write a sobrescrita não alcança os blocos originais, e o
+// resultado informa isso. Se recipientUUIDs for nil, usa os destinatários
+// padrão da configuração.
+func (a *Agent) VaultAndRemove(ctx context.Context, filePath string, recipientUUIDs []string) (*types.VaultResult, error) {
+	if recipientUUIDs == nil {
+		recipientUUIDs = a.config.DefaultRecipients
+	}
+
+	// Se filePath for um link simbólico, o alvo é o que deve ser encriptado
+	// e removido; a remoção segura apagaria apenas o link
+	resolved, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao resolver %s: %w", filePath, err)
+	}
+	filePath = resolved
+
+	if err := refuseSpecialFiles(filePath); err != nil {
+		return nil, err
+	}
+
+	before, err := contentDigest(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := a.EncryptFor(ctx, filePath, recipientUUIDs)
+	if err != nil {
+		return nil, err
+	}
+	if summary.Queued {
+		// Sem o pacote no servidor não há o que verificar
+		return &types.VaultResult{
+			Summary:      summary,
+			SourceDigest: before,
+			Warning:      "pacote na fila de envio; o original foi mantido",
+		}, nil
+	}
+	return a.removeVerified(ctx, filePath, before, summary)
+}
+
+// removeQueued conclui um VaultAndRemove cujo pacote foi para a fila de
+// saída: depois do envio, verifica a operação criada contra sourceDigest, o
+// digest do original no momento da encriptação, e só então remove o
+// original. Enquanto o pacote estiver na fila, retorna errTransferPending.
+func (a *Agent) removeQueued(ctx context.Context, filePath string, summary *types.EncryptionSummary, sourceDigest string) (*types.VaultResult, error) {
+	operationID, err := a.queuedOperation(summary.TransferID, summary.FileID, summary.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := *summary
+	sent.OperationID = operationID
+	sent.Queued = false
+	return a.removeVerified(ctx, filePath, sourceDigest, &sent)
+}
+
+// removeVerified decripta o pacote armazenado da operação de summary e, se
+// ele corresponder ao digest before e o original não tiver mudado, remove o
+// original
+func (a *Agent) removeVerified(ctx context.Context, filePath, before string, summary *types.EncryptionSummary) (*types.VaultResult, error) {
+	if summary.OperationID == "" {
+		return nil, fmt.Errorf("a API não retornou o identificador da operação; o original foi mantido")
+	}
+
+	result := &types.VaultResult{
+		Summary:      summary,
+		SourceDigest: before,
+	}
+
+	stored, _, err := a.retrievePackage(ctx, summary.OperationID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao verificar pacote %s; o original foi mantido: %w", summary.OperationID, err)
+	}
+
+	var roundTrip string
+	if stored.Header.Kind == PackageKindDirectory {
+		roundTrip, err = archiveDigest(bytes.NewReader(stored.DecryptedData))
+	} else {
+		sum := sha256.Sum256(stored.DecryptedData)
+		roundTrip = hex.EncodeToString(sum[:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao verificar pacote %s; o original foi mantido: %w", summary.OperationID, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(before), []byte(roundTrip)) != 1 {
+		return nil, fmt.Errorf("o pacote %s não corresponde ao original; o original foi mantido", summary.OperationID)
+	}
+
+	after, err := contentDigest(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if after != before {
+		return nil, fmt.Errorf("o original foi modificado durante o envio; o original foi mantido")
+	}
+	// O digest ignora arquivos especiais; um criado durante o envio seria
+	// apagado sem ter sido arquivado
+	if err := refuseSpecialFiles(filePath); err != nil {
+		return nil, err
+	}
+	result.Verified = true
+
+	fsName, copyOnWrite, fsErr := filesystemInfo(filePath)
+	result.Filesystem = fsName
+	switch {
+	case fsErr != nil:
+		result.Warning = "não foi possível identificar o sistema de arquivos; a sobrescrita pode não apagar os dados originais"
+	case copyOnWrite:
+		result.Warning = fmt.Sprintf("o sistema de arquivos %s é copy-on-write; a sobrescrita não apaga os blocos originais, que podem persistir até serem reutilizados", fsName)
+	default:
+		result.Overwritten = true
+		result.Warning = "em SSDs e sistemas com journaling de dados ou snapshots, cópias dos dados originais podem persistir"
+	}
+
+	if err := secureRemove(filePath); err != nil {
+		return result, fmt.Errorf("pacote verificado, mas erro ao remover o original: %w", err)
+	}
+	result.Removed = true
+
+	log.Printf("Original %s removido após verificação da operação %s", filePath, summary.OperationID)
+	return result, nil
+}
+
+// refuseSpecialFiles falha se path for ou contiver sockets, FIFOs ou
+// dispositivos. Eles não entram no arquivo nem no digest, mas seriam
+// apagados junto com o diretório.
+func refuseSpecialFiles(path string) error {
+	var special []string
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() && !d.IsDir() && d.Type()&fs.ModeSymlink == 0 {
+			special = append(special, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao ler %s: %w", path, err)
+	}
+	if len(special) > 0 {
+		return fmt.Errorf("arquivos especiais não podem ser arquivados nem removidos: %s; o original foi mantido", strings.Join(special, ", "))
+	}
+	return nil
+}
+
+// contentDigest calcula o digest do conteúdo de um arquivo ou de uma árvore
+// de diretórios, no mesmo formato produzido por archiveDigest
+func contentDigest(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("erro ao ler informações de %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return fileDigest(path)
+	}
+
+	h := sha256.New()
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			writeTreeEntry(h, "d", name, "")
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			writeTreeEntry(h, "l", name, link)
+		case info.Mode().IsRegular():
+			digest, err := fileDigest(p)
+			if err != nil {
+				return err
+			}
+			writeTreeEntry(h, "f", name, digest)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("erro ao calcular digest de %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// archiveDigest calcula o digest de uma árvore a partir do tar gerado por
+// archiveDirectory
+func archiveDigest(r io.Reader) (string, error) {
+	h := sha256.New()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("erro ao ler arquivo tar: %w", err)
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			writeTreeEntry(h, "d", name, "")
+		case tar.TypeSymlink:
+			writeTreeEntry(h, "l", name, hdr.Linkname)
+		case tar.TypeReg:
+			fh := sha256.New()
+			if _, err := io.Copy(fh, tr); err != nil {
+				return "", fmt.Errorf("erro ao ler %s: %w", hdr.Name, err)
+			}
+			writeTreeEntry(h, "f", name, hex.EncodeToString(fh.Sum(nil)))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeTreeEntry(h hash.Hash, kind, name, value string) {
+	fmt.Fprintf(h, "%s\x00%s\x00%s\n", kind, name, value)
+}
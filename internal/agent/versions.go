@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const versionsFileName = "versions.json"
+
+// VersionInfo liga um novo pacote a um arquivo lógico e à sua versão
+// anterior
+type VersionInfo struct {
+	FileID              string
+	Version             int
+	PreviousOperationID string
+}
+
+// versionStore acompanha localmente os arquivos lógicos, identificados por
+// um ID estável associado ao caminho local, e o histórico de versões de
+// cada um. O mesmo ID segue nos metadados cifrados de cada pacote.
+type versionStore struct {
+	mutex  sync.Mutex
+	loaded bool
+	path   string
+	files  map[string]*types.LogicalFile
+}
+
+func (s *versionStore) loadLocked() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.files = make(map[string]*types.LogicalFile)
+
+	dir, err := config.Dir()
+	if err != nil {
+		log.Printf("Aviso: histórico de versões apenas em memória: %v", err)
+		return
+	}
+	s.path = filepath.Join(dir, versionsFileName)
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Aviso: erro ao ler histórico de versões: %v", err)
+		}
+		return
+	}
+
+	var files []*types.LogicalFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		log.Printf("Aviso: histórico de versões inválido: %v", err)
+		return
+	}
+	for _, f := range files {
+		s.files[f.FileID] = f
+	}
+}
+
+func (s *versionStore) saveLocked() {
+	if s.path == "" {
+		return
+	}
+
+	files := make([]*types.LogicalFile, 0, len(s.files))
+	for _, f := range s.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		log.Printf("Aviso: erro ao serializar histórico de versões: %v", err)
+		return
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("Aviso: erro ao gravar histórico de versões: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		log.Printf("Aviso: erro ao gravar histórico de versões: %v", err)
+	}
+}
+
+func (s *versionStore) byPathLocked(path string) *types.LogicalFile {
+	for _, f := range s.files {
+		if f.Path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// next reserva a versão que um novo pacote de path deve receber. A reserva
+// é gravada junto com o histórico, de forma que envios simultâneos ou ainda
+// na fila de saída nunca recebam o mesmo número.
+func (s *versionStore) next(path string) *VersionInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loadLocked()
+
+	f := s.byPathLocked(path)
+	if f == nil {
+		f = &types.LogicalFile{FileID: uuid.NewString(), Path: path}
+		s.files[f.FileID] = f
+	}
+
+	info := &VersionInfo{FileID: f.FileID, Version: f.Reserved + 1}
+	if len(f.Versions) > 0 {
+		latest := f.Versions[len(f.Versions)-1]
+		info.Version = max(info.Version, latest.Version+1)
+		info.PreviousOperationID = latest.OperationID
+	}
+	f.Reserved = info.Version
+	s.saveLocked()
+	return info
+}
+
+// record registra uma versão enviada. Versões reservadas podem terminar o
+// envio fora de ordem; a versão é inserida na posição do seu número e a
+// ligação com a anterior é refeita com o que de fato foi gravado.
+func (s *versionStore) record(path string, info *VersionInfo, operationID, fileName string, size int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loadLocked()
+
+	f := s.files[info.FileID]
+	if f == nil {
+		f = &types.LogicalFile{FileID: info.FileID, Path: path}
+		s.files[info.FileID] = f
+	}
+	f.Reserved = max(f.Reserved, info.Version)
+
+	v := types.FileVersion{
+		FileID:              info.FileID,
+		Version:             info.Version,
+		OperationID:         operationID,
+		PreviousOperationID: info.PreviousOperationID,
+		FileName:            fileName,
+		Size:                size,
+		CreatedAt:           time.Now().UTC().Format(time.RFC3339),
+	}
+	i := sort.Search(len(f.Versions), func(i int) bool { return f.Versions[i].Version > info.Version })
+	if i > 0 {
+		v.PreviousOperationID = f.Versions[i-1].OperationID
+	}
+	f.Versions = slices.Insert(f.Versions, i, v)
+	if i+1 < len(f.Versions) {
+		f.Versions[i+1].PreviousOperationID = operationID
+	}
+	s.saveLocked()
+}
+
+// remove retira uma versão do histórico e retorna o caminho local do
+// arquivo lógico a que ela pertencia
+func (s *versionStore) remove(operationID string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loadLocked()
+
+	for _, f := range s.files {
+		for i, v := range f.Versions {
+			if v.OperationID == operationID {
+				f.Versions = append(f.Versions[:i], f.Versions[i+1:]...)
+				s.saveLocked()
+				return f.Path, true
+			}
+		}
+	}
+	return "", false
+}
+
+// get retorna uma cópia do arquivo lógico
+func (s *versionStore) get(fileID string) (*types.LogicalFile, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loadLocked()
+
+	f, ok := s.files[fileID]
+	if !ok {
+		return nil, false
+	}
+	c := *f
+	c.Versions = append([]types.FileVersion(nil), f.Versions...)
+	return &c, true
+}
+
+// list retorna cópias de todos os arquivos lógicos
+func (s *versionStore) list() []types.LogicalFile {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loadLocked()
+
+	files := make([]types.LogicalFile, 0, len(s.files))
+	for _, f := range s.files {
+		// Arquivos com versões apenas reservadas ainda não têm o que listar
+		if len(f.Versions) == 0 {
+			continue
+		}
+		c := *f
+		c.Versions = append([]types.FileVersion(nil), f.Versions...)
+		files = append(files, c)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// expiredVersions retorna as versões que excedem a política de retenção.
+// A versão mais recente é sempre mantida.
+func expiredVersions(versions []types.FileVersion, keepVersions, keepDays int, now time.Time) []types.FileVersion {
+	var expired []types.FileVersion
+	for i, v := range versions {
+		age := len(versions) - 1 - i // 0 para a versão mais recente
+		if age == 0 {
+			continue
+		}
+
+		if keepVersions > 0 && age >= keepVersions {
+			expired = append(expired, v)
+			continue
+		}
+		if keepDays > 0 {
+			created, err := time.Parse(time.RFC3339, v.CreatedAt)
+			if err == nil && now.Sub(created) > time.Duration(keepDays)*24*time.Hour {
+				expired = append(expired, v)
+			}
+		}
+	}
+	return expired
+}
+
+// applyRetention remove do servidor as versões de fileID que excedem a
+// política de retenção da configuração
+func (a *Agent) applyRetention(ctx context.Context, fileID string) {
+	a.applyRetentionPolicy(ctx, fileID, a.config.KeepVersions, a.config.KeepDays)
+}
+
+// applyRetentionPolicy remove do servidor as versões de fileID que excedem
+// a política informada e retorna quantas foram removidas
+func (a *Agent) applyRetentionPolicy(ctx context.Context, fileID string, keepVersions, keepDays int) int {
+	if keepVersions <= 0 && keepDays <= 0 {
+		return 0
+	}
+
+	f, ok := a.versions.get(fileID)
+	if !ok {
+		return 0
+	}
+
+	removed := 0
+	for _, v := range expiredVersions(f.Versions, keepVersions, keepDays, time.Now()) {
+		if err := a.Delete(ctx, v.OperationID); err != nil {
+			log.Printf("Erro ao remover versão %d de %s: %v", v.Version, f.Path, err)
+			continue
+		}
+		removed++
+		log.Printf("Versão %d de %s removida pela política de retenção", v.Version, f.Path)
+	}
+	return removed
+}
+
+// ListFiles lista os arquivos lógicos acompanhados por este dispositivo
+func (a *Agent) ListFiles() []types.LogicalFile {
+	return a.versions.list()
+}
+
+// ListVersions retorna o histórico de versões de um arquivo lógico, da mais
+// antiga para a mais recente
+func (a *Agent) ListVersions(fileID string) ([]types.FileVersion, error) {
+	f, ok := a.versions.get(fileID)
+	if !ok {
+		return nil, fmt.Errorf("arquivo não encontrado: %s", fileID)
+	}
+	return f.Versions, nil
+}
+
+// RestoreVersion descriptografa uma versão de um arquivo lógico em destDir
+func (a *Agent) RestoreVersion(ctx context.Context, fileID string, version int, destDir string) (*types.DecryptResult, error) {
+	versions, err := a.ListVersions(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if v.Version == version {
+			return a.DecryptTo(ctx, v.OperationID, destDir)
+		}
+	}
+	return nil, fmt.Errorf("versão %d não encontrada", version)
+}
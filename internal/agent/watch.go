@@ -0,0 +1,603 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"tpm-bunker/internal/config"
+	"tpm-bunker/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// WatchActivityEvent é o evento emitido a cada nova entrada no registro
+	// de atividade das pastas vigiadas
+	WatchActivityEvent = "watch_activity"
+
+	watchStateFileName = "watch.json"
+
+	// watchInterval é o intervalo entre varreduras das pastas vigiadas
+	watchInterval = 10 * time.Second
+
+	defaultStableSeconds = 30
+	maxWatchActivity     = 100
+)
+
+// Arquivos ignorados por padrão: ocultos, temporários e parciais
+var defaultWatchExclude = []string{".*", "~$*", "*.tmp", "*.part", "*.crdownload"}
+
+// watchedFile é o último estado visto de um arquivo de uma pasta vigiada
+type watchedFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+
+	// Vaulted indica que este estado do arquivo já foi encriptado
+	Vaulted bool `json:"vaulted"`
+
+	// Pending indica um pacote na fila de saída cujo original aguarda a
+	// verificação para ser removido. Queued identifica o envio e Digest é o
+	// digest do original quando foi encriptado.
+	Pending bool                     `json:"pending,omitempty"`
+	Queued  *types.EncryptionSummary `json:"queued,omitempty"`
+	Digest  string                   `json:"digest,omitempty"`
+
+	// Failures conta as tentativas seguidas que falharam para este estado do
+	// arquivo e RetryAt é quando a próxima pode ser feita. Um arquivo
+	// alterado volta a ser um estado novo, sem espera.
+	Failures int       `json:"failures,omitempty"`
+	RetryAt  time.Time `json:"retry_at,omitempty"`
+
+	// stableSince é o instante desde o qual o arquivo não muda
+	stableSince time.Time
+}
+
+// Espera máxima entre tentativas de um arquivo que continua falhando
+const maxWatchBackoff = 6 * time.Hour
+
+// failed registra uma tentativa que falhou e adia a próxima, dobrando a
+// espera a cada falha a partir da janela de estabilidade da pasta
+func (f *watchedFile) failed(stable time.Duration, now time.Time) {
+	f.Failures++
+	delay := stable
+	for i := 1; i < f.Failures && delay < maxWatchBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxWatchBackoff {
+		delay = maxWatchBackoff
+	}
+	f.RetryAt = now.Add(delay)
+}
+
+// watchState é o estado das pastas vigiadas gravado em disco, por pasta
+type watchState struct {
+	Files    map[string]map[string]*watchedFile `json:"files"`
+	Activity map[string][]types.WatchActivity   `json:"activity"`
+}
+
+// watcher varre periodicamente as pastas vigiadas. A varredura por
+// intervalo dispensa notificações do sistema de arquivos, que variam entre
+// plataformas e se perdem com o aplicativo fechado.
+type watcher struct {
+	wakeup chan struct{}
+
+	mutex  sync.Mutex
+	loaded bool
+	path   string
+	state  watchState
+}
+
+func newWatcher() *watcher {
+	return &watcher{wakeup: make(chan struct{}, 1)}
+}
+
+// wake pede uma varredura imediata
+func (w *watcher) wake() {
+	select {
+	case w.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) loadLocked() {
+	if w.loaded {
+		return
+	}
+	w.loaded = true
+	w.state = watchState{
+		Files:    make(map[string]map[string]*watchedFile),
+		Activity: make(map[string][]types.WatchActivity),
+	}
+
+	dir, err := config.Dir()
+	if err != nil {
+		log.Printf("Aviso: estado das pastas vigiadas apenas em memória: %v", err)
+		return
+	}
+	w.path = filepath.Join(dir, watchStateFileName)
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Aviso: erro ao ler estado das pastas vigiadas: %v", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &w.state); err != nil {
+		log.Printf("Aviso: estado das pastas vigiadas inválido: %v", err)
+	}
+	if w.state.Files == nil {
+		w.state.Files = make(map[string]map[string]*watchedFile)
+	}
+	if w.state.Activity == nil {
+		w.state.Activity = make(map[string][]types.WatchActivity)
+	}
+}
+
+func (w *watcher) saveLocked() {
+	if w.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(w.state)
+	if err != nil {
+		log.Printf("Aviso: erro ao serializar estado das pastas vigiadas: %v", err)
+		return
+	}
+	tmp := w.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("Aviso: erro ao gravar estado das pastas vigiadas: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		log.Printf("Aviso: erro ao gravar estado das pastas vigiadas: %v", err)
+	}
+}
+
+// WatchedFolders lista as pastas vigiadas
+func (a *Agent) WatchedFolders() []types.WatchedFolder {
+	return a.config.Folders()
+}
+
+// absDir retorna o caminho absoluto de uma pasta existente
+func absDir(dir string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("pasta não informada")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("caminho inválido: %w", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("pasta inacessível: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s não é uma pasta", abs)
+	}
+	return abs, nil
+}
+
+// validatePatterns verifica a sintaxe de padrões de inclusão e exclusão
+func validatePatterns(lists ...[]string) error {
+	for _, patterns := range lists {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("padrão inválido: %s", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeFolder valida uma pasta vigiada e preenche os valores padrão
+func normalizeFolder(folder *types.WatchedFolder) error {
+	abs, err := absDir(folder.Path)
+	if err != nil {
+		return err
+	}
+	folder.Path = abs
+
+	if err := validatePatterns(folder.Include, folder.Exclude); err != nil {
+		return err
+	}
+	if folder.Exclude == nil {
+		folder.Exclude = defaultWatchExclude
+	}
+	if folder.StableSeconds <= 0 {
+		folder.StableSeconds = defaultStableSeconds
+	}
+	return nil
+}
+
+// AddWatchedFolder passa a vigiar uma pasta, já habilitada
+func (a *Agent) AddWatchedFolder(folder types.WatchedFolder) (*types.WatchedFolder, error) {
+	if err := normalizeFolder(&folder); err != nil {
+		return nil, err
+	}
+
+	folders := a.config.Folders()
+	for _, f := range folders {
+		if f.Path == folder.Path {
+			return nil, fmt.Errorf("a pasta %s já é vigiada", folder.Path)
+		}
+	}
+	folder.ID = uuid.NewString()
+	folder.Enabled = true
+
+	if err := a.config.SetFolders(append(folders, folder)); err != nil {
+		return nil, err
+	}
+	a.watcher.wake()
+	return &folder, nil
+}
+
+// UpdateWatchedFolder altera as regras de uma pasta vigiada
+func (a *Agent) UpdateWatchedFolder(folder types.WatchedFolder) (*types.WatchedFolder, error) {
+	if err := normalizeFolder(&folder); err != nil {
+		return nil, err
+	}
+
+	folders := a.config.Folders()
+	for i, f := range folders {
+		if f.ID == folder.ID {
+			folders[i] = folder
+			if err := a.config.SetFolders(folders); err != nil {
+				return nil, err
+			}
+			a.watcher.wake()
+			return &folder, nil
+		}
+	}
+	return nil, fmt.Errorf("pasta vigiada não encontrada: %s", folder.ID)
+}
+
+// RemoveWatchedFolder deixa de vigiar uma pasta. Os arquivos já
+// encriptados permanecem armazenados.
+func (a *Agent) RemoveWatchedFolder(id string) error {
+	folders := a.config.Folders()
+	for i, f := range folders {
+		if f.ID != id {
+			continue
+		}
+		if err := a.config.SetFolders(append(folders[:i], folders[i+1:]...)); err != nil {
+			return err
+		}
+
+		w := a.watcher
+		w.mutex.Lock()
+		w.loadLocked()
+		delete(w.state.Files, id)
+		delete(w.state.Activity, id)
+		w.saveLocked()
+		w.mutex.Unlock()
+		return nil
+	}
+	return fmt.Errorf("pasta vigiada não encontrada: %s", id)
+}
+
+// WatchActivity retorna o registro de atividade de uma pasta vigiada, do
+// mais recente ao mais antigo
+func (a *Agent) WatchActivity(id string) []types.WatchActivity {
+	w := a.watcher
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.loadLocked()
+
+	entries := w.state.Activity[id]
+	result := make([]types.WatchActivity, len(entries))
+	for i, entry := range entries {
+		result[len(entries)-1-i] = entry
+	}
+	return result
+}
+
+// recordActivity acrescenta uma entrada ao registro da pasta e a publica
+func (a *Agent) recordActivity(entry types.WatchActivity) {
+	entry.Time = time.Now().UTC().Format(time.RFC3339)
+
+	w := a.watcher
+	w.mutex.Lock()
+	w.loadLocked()
+	entries := append(w.state.Activity[entry.FolderID], entry)
+	if len(entries) > maxWatchActivity {
+		entries = entries[len(entries)-maxWatchActivity:]
+	}
+	w.state.Activity[entry.FolderID] = entries
+	w.saveLocked()
+	w.mutex.Unlock()
+
+	a.emit(WatchActivityEvent, entry)
+}
+
+// runWatcher é o worker das pastas vigiadas
+func (a *Agent) runWatcher(ctx context.Context) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		a.scanWatched(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.watcher.wakeup:
+		case <-ticker.C:
+		}
+	}
+}
+
+// matchesAny verifica se rel, um caminho relativo com "/", casa com algum
+// dos padrões
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		target := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			target = rel
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles retorna os arquivos regulares sob root que casam com as regras,
+// por caminho absoluto
+func listFiles(root string, include, exclude []string, recursive bool) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			// Entradas ilegíveis são tentadas de novo na próxima varredura
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if !recursive || matchesAny(exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || matchesAny(exclude, rel) {
+			return nil
+		}
+		if len(include) > 0 && !matchesAny(include, rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err == nil {
+			files[p] = info
+		}
+		return nil
+	})
+	return files, err
+}
+
+// watchCandidate é um arquivo estável pronto para ser encriptado, ou cujo
+// pacote na fila de saída deve ser verificado
+type watchCandidate struct {
+	folder types.WatchedFolder
+	path   string
+	info   fs.FileInfo
+
+	queued *types.EncryptionSummary
+	digest string
+}
+
+// scanWatched varre as pastas vigiadas e encripta os arquivos novos ou
+// alterados que estão estáveis há pelo menos StableSeconds
+func (a *Agent) scanWatched(ctx context.Context) {
+	folders := a.config.Folders()
+	if len(folders) == 0 {
+		return
+	}
+
+	// Sem dispositivo inicializado ainda não há como encriptar; os arquivos
+	// continuam sendo acompanhados
+	deviceUUID, _ := a.tpmMgr.GetDeviceUUID(ctx)
+
+	now := time.Now()
+	var candidates []watchCandidate
+
+	w := a.watcher
+	w.mutex.Lock()
+	w.loadLocked()
+	for _, folder := range folders {
+		if !folder.Enabled {
+			continue
+		}
+		listed, err := listFiles(folder.Path, folder.Include, folder.Exclude, folder.Recursive)
+		if err != nil {
+			log.Printf("Aviso: erro ao varrer pasta vigiada %s: %v", folder.Path, err)
+			continue
+		}
+
+		known := w.state.Files[folder.ID]
+		if known == nil {
+			known = make(map[string]*watchedFile)
+			w.state.Files[folder.ID] = known
+		}
+		for p := range known {
+			if _, ok := listed[p]; !ok {
+				delete(known, p)
+			}
+		}
+
+		for p, info := range listed {
+			entry := known[p]
+			if entry == nil || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+				known[p] = &watchedFile{Size: info.Size(), ModTime: info.ModTime(), stableSince: now}
+				continue
+			}
+			if entry.stableSince.IsZero() {
+				entry.stableSince = now
+			}
+
+			if entry.Vaulted && !entry.Pending {
+				continue
+			}
+			if deviceUUID == "" || now.Sub(entry.stableSince) < time.Duration(folder.StableSeconds)*time.Second {
+				continue
+			}
+			if now.Before(entry.RetryAt) {
+				continue
+			}
+			c := watchCandidate{folder: folder, path: p, info: info}
+			if entry.Pending {
+				// O original é verificado contra o pacote já na fila, e não
+				// encriptado de novo
+				if entry.Queued == nil {
+					continue
+				}
+				c.queued, c.digest = entry.Queued, entry.Digest
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	w.saveLocked()
+	w.mutex.Unlock()
+
+	for _, c := range candidates {
+		if ctx.Err() != nil {
+			return
+		}
+		if c.queued != nil {
+			a.removeWatched(ctx, c)
+		} else {
+			a.vaultWatched(ctx, c)
+		}
+	}
+}
+
+// vaultWatched encripta um arquivo de uma pasta vigiada e registra o
+// resultado
+func (a *Agent) vaultWatched(ctx context.Context, c watchCandidate) {
+	activity := types.WatchActivity{FolderID: c.folder.ID, Path: c.path}
+	var vaulted, pending, removed bool
+	var queued *types.EncryptionSummary
+	var digest string
+
+	if c.folder.RemoveOriginals {
+		result, err := a.VaultAndRemove(ctx, c.path, nil)
+		switch {
+		case err != nil:
+			activity.Action = "failed"
+			activity.Message = err.Error()
+		case result.Removed:
+			activity.Action = "removed"
+			activity.OperationID = result.Summary.OperationID
+			activity.Message = result.Warning
+			removed = true
+		default:
+			activity.Action = "queued"
+			activity.Message = result.Warning
+			vaulted, pending = true, true
+			queued, digest = result.Summary, result.SourceDigest
+		}
+	} else {
+		summary, err := a.Encrypt(ctx, c.path)
+		switch {
+		case err != nil:
+			activity.Action = "failed"
+			activity.Message = err.Error()
+		case summary.Queued:
+			activity.Action = "queued"
+			vaulted = true
+		default:
+			activity.Action = "vaulted"
+			activity.OperationID = summary.OperationID
+			vaulted = true
+		}
+	}
+
+	w := a.watcher
+	w.mutex.Lock()
+	if known := w.state.Files[c.folder.ID]; known != nil {
+		if entry := known[c.path]; entry != nil && entry.Size == c.info.Size() && entry.ModTime.Equal(c.info.ModTime()) {
+			switch {
+			case removed:
+				delete(known, c.path)
+			case vaulted:
+				entry.Vaulted = true
+				entry.Pending = pending
+				entry.Queued = queued
+				entry.Digest = digest
+				entry.Failures, entry.RetryAt = 0, time.Time{}
+			default:
+				// Nova tentativa só depois de uma espera que cresce a cada
+				// falha, ou quando o arquivo mudar
+				entry.failed(time.Duration(c.folder.StableSeconds)*time.Second, time.Now())
+			}
+		}
+	}
+	w.mutex.Unlock()
+
+	log.Printf("Pasta vigiada %s: %s %s", c.folder.Path, activity.Action, c.path)
+	a.recordActivity(activity)
+}
+
+// removeWatched verifica o pacote de um arquivo que foi para a fila de
+// saída e, depois do envio, remove o original. Um envio descartado devolve
+// o arquivo à vigilância para ser encriptado de novo.
+func (a *Agent) removeWatched(ctx context.Context, c watchCandidate) {
+	result, err := a.removeQueued(ctx, c.path, c.queued, c.digest)
+	if errors.Is(err, errTransferPending) {
+		return
+	}
+
+	activity := types.WatchActivity{FolderID: c.folder.ID, Path: c.path}
+	if err != nil {
+		activity.Action = "failed"
+		activity.Message = err.Error()
+	} else {
+		activity.Action = "removed"
+		activity.OperationID = result.Summary.OperationID
+		activity.Message = result.Warning
+	}
+
+	w := a.watcher
+	w.mutex.Lock()
+	if known := w.state.Files[c.folder.ID]; known != nil {
+		if entry := known[c.path]; entry != nil && entry.Size == c.info.Size() && entry.ModTime.Equal(c.info.ModTime()) {
+			switch {
+			case err == nil && result.Removed:
+				delete(known, c.path)
+			case errors.Is(err, errTransferDiscarded):
+				entry.Vaulted, entry.Pending = false, false
+				entry.Queued, entry.Digest = nil, ""
+				entry.Failures, entry.RetryAt = 0, time.Time{}
+				entry.stableSince = time.Now()
+			default:
+				// Nova verificação só depois de uma espera que cresce a cada
+				// falha, ou quando o arquivo mudar
+				entry.failed(time.Duration(c.folder.StableSeconds)*time.Second, time.Now())
+			}
+		}
+	}
+	w.mutex.Unlock()
+
+	log.Printf("Pasta vigiada %s: %s %s", c.folder.Path, activity.Action, c.path)
+	a.recordActivity(activity)
+}
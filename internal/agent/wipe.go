@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// wipeBufferSize é o tamanho do bloco usado para sobrescrever arquivos
+const wipeBufferSize = 64 * 1024
+
+// secureRemove sobrescreve com dados aleatórios e remove um arquivo ou,
+// recursivamente, um diretório. Links simbólicos são apenas removidos.
+func secureRemove(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return wipeFile(path, info)
+	}
+
+	var firstErr error
+	walkErr := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := wipeFile(p, info); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return nil
+	})
+	if walkErr != nil && firstErr == nil {
+		firstErr = walkErr
+	}
+
+	if err := os.RemoveAll(path); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// wipeFile sobrescreve o conteúdo de um arquivo regular antes de removê-lo.
+// Em sistemas de arquivos copy-on-write, com journaling de dados ou em SSDs,
+// a sobrescrita não garante que os blocos originais sejam apagados.
+func wipeFile(path string, info fs.FileInfo) error {
+	if info.Mode().IsRegular() {
+		// Arquivos somente leitura precisam de escrita para a sobrescrita
+		if info.Mode().Perm()&0200 == 0 {
+			os.Chmod(path, info.Mode().Perm()|0200)
+		}
+		if err := overwriteFile(path, info.Size()); err != nil {
+			os.Remove(path)
+			return fmt.Errorf("erro ao sobrescrever %s: %w", path, err)
+		}
+	}
+	return os.Remove(path)
+}
+
+// overwriteFile sobrescreve size bytes do arquivo com dados aleatórios e
+// força a gravação em disco
+func overwriteFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, wipeBufferSize)
+	for remaining := size; remaining > 0; {
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(rand.Reader, buf[:n]); err != nil {
+			return err
+		}
+		if _, err := f.Write(buf[:n]); err != nil {
+			return err
+		}
+		remaining -= n
+	}
+	return f.Sync()
+}
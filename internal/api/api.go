@@ -5,11 +5,14 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 	"tpm-bunker/internal/types"
@@ -22,24 +25,70 @@ type APIClient struct {
 }
 
 type DeviceRegistration struct {
-	UUID      string `json:"uuid"`
-	EKCert    string `json:"ek_certificate"`
-	AIK       string `json:"aik"`
-	PublicKey string `json:"public_key"`
+	UUID          string `json:"uuid"`
+	EKCert        string `json:"ek_certificate"`
+	AIK           string `json:"aik"`
+	PublicKey     string `json:"public_key"`
+	EncryptionKey string `json:"encryption_public_key"`
+}
+
+// DeviceRecord representa um dispositivo do registro da API
+type DeviceRecord struct {
+	UUID          string `json:"uuid"`
+	PublicKey     string `json:"public_key"`
+	EncryptionKey string `json:"encryption_public_key"`
+	IsActive      bool   `json:"is_active"`
 }
 
 type EncryptionRequest struct {
-	EncryptedData    []byte            `json:"encrypted_data"`
-	EncryptedKey     string            `json:"encrypted_symmetric_key "`
-	DigitalSignature string            `json:"digital_signature"`
-	HashOriginal     string            `json:"hash_original"`
-	Metadata         map[string]string `json:"metadata"`
+	EncryptedData    []byte             `json:"encrypted_data"`
+	EncryptedKey     string             `json:"encrypted_symmetric_key "`
+	WrappedKeys      []types.WrappedKey `json:"wrapped_keys"`
+	DigitalSignature string             `json:"digital_signature"`
+	HashOriginal     string             `json:"hash_original"`
+	Metadata         map[string]string  `json:"metadata"`
+	// Repetir o envio com a mesma chave retorna a operação já criada
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 type EncryptionResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
-	FileID  string `json:"file_id"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	FileID      string `json:"file_id"`
+	OperationID string `json:"operation_id"`
+}
+
+// StatusError é a resposta de erro da API, com o status HTTP recebido
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("requisição falhou com status %d: %s", e.StatusCode, e.Body)
+}
+
+// HasStatus informa se err é uma resposta da API com o status code
+func HasStatus(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == code
+}
+
+// IsClientError informa se err é uma resposta 4xx da API, que não muda ao
+// repetir a mesma requisição. Timeout (408), conflito com um envio da mesma
+// chave ainda em processamento (409) e excesso de requisições (429) não
+// contam.
+func IsClientError(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	code := statusErr.StatusCode
+	switch code {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return code >= 400 && code < 500
 }
 
 func NewAPIClient(ctx context.Context) *APIClient {
@@ -90,10 +139,11 @@ func (c *APIClient) IsDeviceRegistered(ctx context.Context, uuid string) (bool,
 
 func (c *APIClient) RegisterDevice(ctx context.Context, deviceInfo *types.DeviceInfo) error {
 	registration := DeviceRegistration{
-		UUID:      deviceInfo.UUID,
-		EKCert:    base64.StdEncoding.EncodeToString(deviceInfo.EK),
-		AIK:       base64.StdEncoding.EncodeToString(deviceInfo.AIK),
-		PublicKey: deviceInfo.PublicKey,
+		UUID:          deviceInfo.UUID,
+		EKCert:        base64.StdEncoding.EncodeToString(deviceInfo.EK),
+		AIK:           base64.StdEncoding.EncodeToString(deviceInfo.AIK),
+		PublicKey:     deviceInfo.PublicKey,
+		EncryptionKey: deviceInfo.EncryptionKey,
 	}
 
 	_, err := c.SendRequest(ctx, http.MethodPost, "devices/", nil, registration)
@@ -105,6 +155,256 @@ func (c *APIClient) RegisterDevice(ctx context.Context, deviceInfo *types.Device
 	return nil
 }
 
+// GetDevice busca um dispositivo registrado pelo UUID
+func (c *APIClient) GetDevice(ctx context.Context, uuid string) (*DeviceRecord, error) {
+	response, err := c.SendRequest(ctx, http.MethodGet, fmt.Sprintf("devices/%s/", uuid), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar dispositivo %s: %w", uuid, err)
+	}
+
+	var device DeviceRecord
+	if err := json.Unmarshal(response, &device); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar dispositivo: %w", err)
+	}
+	return &device, nil
+}
+
+// SetEncryptionKey publica no registro a chave de encriptação do próprio
+// dispositivo. Dispositivos registrados antes da chave existir a enviam
+// depois, para que outros possam encriptar para eles.
+func (c *APIClient) SetEncryptionKey(ctx context.Context, headers map[string]string, uuid string, keyPEM string) error {
+	body := map[string]string{"encryption_public_key": keyPEM}
+	if _, err := c.SendRequest(ctx, http.MethodPut, fmt.Sprintf("devices/%s/encryption_key/", uuid), headers, body); err != nil {
+		return fmt.Errorf("erro ao publicar chave de encriptação: %w", err)
+	}
+	return nil
+}
+
+// GrantRequest concede a outro dispositivo acesso a um pacote já armazenado
+type GrantRequest struct {
+	DeviceUUID   string `json:"device_uuid"`
+	KeyID        string `json:"key_id"`
+	EncryptedKey string `json:"encrypted_key"`
+	GrantedBy    string `json:"granted_by"`
+	Signature    string `json:"signature"`
+}
+
+// GetWrappedKey recupera apenas a chave simétrica encriptada para o
+// dispositivo autenticado, sem baixar os dados do pacote
+func (c *APIClient) GetWrappedKey(ctx context.Context, headers map[string]string, operationID string) (*types.WrappedKey, error) {
+	response, err := c.SendRequest(ctx, http.MethodGet, fmt.Sprintf("operations/%s/key/", operationID), headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao recuperar chave do pacote: %w", err)
+	}
+
+	var wrapped types.WrappedKey
+	if err := json.Unmarshal(response, &wrapped); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar chave do pacote: %w", err)
+	}
+	return &wrapped, nil
+}
+
+// CreateGrant registra uma nova concessão de acesso a um pacote
+func (c *APIClient) CreateGrant(ctx context.Context, headers map[string]string, operationID string, grant *GrantRequest) (*types.Grant, error) {
+	response, err := c.SendRequest(ctx, http.MethodPost, fmt.Sprintf("operations/%s/grants/", operationID), headers, grant)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar concessão: %w", err)
+	}
+
+	var created types.Grant
+	if err := json.Unmarshal(response, &created); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar concessão: %w", err)
+	}
+	return &created, nil
+}
+
+// ListGrants lista os dispositivos com acesso a um pacote
+func (c *APIClient) ListGrants(ctx context.Context, headers map[string]string, operationID string) ([]types.Grant, error) {
+	response, err := c.SendRequest(ctx, http.MethodGet, fmt.Sprintf("operations/%s/grants/", operationID), headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar concessões: %w", err)
+	}
+
+	var grants []types.Grant
+	if err := json.Unmarshal(response, &grants); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar concessões: %w", err)
+	}
+	return grants, nil
+}
+
+// RevokeGrant remove o acesso de um dispositivo a um pacote
+func (c *APIClient) RevokeGrant(ctx context.Context, headers map[string]string, operationID string, deviceUUID string) error {
+	_, err := c.SendRequest(ctx, http.MethodDelete, fmt.Sprintf("operations/%s/grants/%s/", operationID, deviceUUID), headers, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao revogar concessão: %w", err)
+	}
+	return nil
+}
+
+// DeleteRequest é o pedido assinado de remoção de um pacote
+type DeleteRequest struct {
+	OperationID string `json:"operation_id"`
+	DeviceUUID  string `json:"device_uuid"`
+	RequestedAt string `json:"requested_at"`
+	Signature   string `json:"signature"`
+}
+
+// DeleteOperation remove um pacote armazenado
+func (c *APIClient) DeleteOperation(ctx context.Context, headers map[string]string, request *DeleteRequest) error {
+	_, err := c.SendRequest(ctx, http.MethodDelete, fmt.Sprintf("operations/%s/", request.OperationID), headers, request)
+	if err != nil {
+		return fmt.Errorf("erro ao remover operação: %w", err)
+	}
+	return nil
+}
+
+// AnnotationRecord são as anotações de um pacote, cifradas com a chave do
+// pacote e assinadas pelo dispositivo que as editou
+type AnnotationRecord struct {
+	Sealed     string `json:"sealed"`
+	SignerUUID string `json:"signer_uuid"`
+	SignedAt   string `json:"signed_at"`
+	Signature  string `json:"signature"`
+}
+
+// SetAnnotation substitui as anotações de um pacote
+func (c *APIClient) SetAnnotation(ctx context.Context, headers map[string]string, operationID string, record *AnnotationRecord) error {
+	_, err := c.SendRequest(ctx, http.MethodPut, fmt.Sprintf("operations/%s/annotation/", operationID), headers, record)
+	if err != nil {
+		return fmt.Errorf("erro ao salvar anotações: %w", err)
+	}
+	return nil
+}
+
+// OperationQuery são os parâmetros aceitos pela listagem de operações.
+// Campos vazios não são enviados. O servidor filtra por tipo, estado e data
+// de criação; filtros sobre nomes e anotações, opacos para ele, são
+// aplicados no cliente.
+type OperationQuery struct {
+	Page     int
+	PageSize int
+
+	Type   string
+	Status string
+	// Intervalo de criação [CreatedFrom, CreatedTo)
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// created_at ou -created_at
+	Ordering string
+
+	// Com Sync, a API lista as alterações em ordem de alteração, a partir
+	// de Since: o cursor retornado pela listagem anterior, ou vazio para
+	// todas. A página seguinte é pedida com o Cursor da resposta
+	Sync  bool
+	Since string
+}
+
+func (q *OperationQuery) values() url.Values {
+	values := url.Values{}
+	if q.Page > 0 {
+		values.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PageSize > 0 {
+		values.Set("page_size", strconv.Itoa(q.PageSize))
+	}
+	if q.Type != "" {
+		values.Set("operation_type", q.Type)
+	}
+	if q.Status != "" {
+		values.Set("status", q.Status)
+	}
+	if !q.CreatedFrom.IsZero() {
+		values.Set("created_from", q.CreatedFrom.UTC().Format(time.RFC3339))
+	}
+	if !q.CreatedTo.IsZero() {
+		values.Set("created_to", q.CreatedTo.UTC().Format(time.RFC3339))
+	}
+	if q.Ordering != "" {
+		values.Set("ordering", q.Ordering)
+	}
+	if q.Sync || q.Since != "" {
+		values.Set("since", q.Since)
+	}
+	return values
+}
+
+// OperationRecord é uma operação como retornada pela API
+type OperationRecord struct {
+	ID            string                 `json:"id"`
+	Device        string                 `json:"device"`
+	OperationType string                 `json:"operation_type"`
+	Status        string                 `json:"status"`
+	ErrorMessage  string                 `json:"error_message"`
+	CreatedAt     string                 `json:"created_at"`
+	UpdatedAt     string                 `json:"updated_at"`
+	FileName      string                 `json:"file_name"`
+	FileSize      float64                `json:"file_size"`
+	Metadata      map[string]interface{} `json:"metadata"`
+	Annotation    *AnnotationRecord      `json:"annotation"`
+}
+
+// OperationPage é uma página da listagem de operações
+type OperationPage struct {
+	Count   int               `json:"count"`
+	Next    string            `json:"next"`
+	Results []OperationRecord `json:"results"`
+
+	// Operações removidas desde o cursor informado em Since, e o cursor do
+	// último pacote retornado
+	Deleted []string `json:"deleted"`
+	Cursor  string   `json:"cursor"`
+}
+
+// ListOperations retorna uma página de operações. Servidores sem paginação
+// retornam uma lista simples, tratada como página única.
+func (c *APIClient) ListOperations(ctx context.Context, headers map[string]string, query *OperationQuery) (*OperationPage, error) {
+	endpoint := "operations/"
+	if values := query.values(); len(values) > 0 {
+		endpoint += "?" + values.Encode()
+	}
+
+	response, err := c.SendRequest(ctx, http.MethodGet, endpoint, headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar operações: %w", err)
+	}
+
+	var page OperationPage
+	if trimmed := bytes.TrimSpace(response); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &page.Results); err != nil {
+			return nil, fmt.Errorf("erro ao decodificar operações: %w", err)
+		}
+		page.Count = len(page.Results)
+		return &page, nil
+	}
+
+	if err := json.Unmarshal(response, &page); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar operações: %w", err)
+	}
+	return &page, nil
+}
+
+// LookupResponse indica se já existe um pacote com a etiqueta de conteúdo
+type LookupResponse struct {
+	Found       bool   `json:"found"`
+	OperationID string `json:"operation_id"`
+}
+
+// FindByTag procura um pacote deste dispositivo com a etiqueta de conteúdo
+// informada
+func (c *APIClient) FindByTag(ctx context.Context, headers map[string]string, tag string) (*LookupResponse, error) {
+	endpoint := "operations/lookup/?tag=" + url.QueryEscape(tag)
+	response, err := c.SendRequest(ctx, http.MethodGet, endpoint, headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao procurar pacote: %w", err)
+	}
+
+	var lookup LookupResponse
+	if err := json.Unmarshal(response, &lookup); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar busca: %w", err)
+	}
+	return &lookup, nil
+}
+
 type LoginRequest struct {
 	UUID   string `json:"uuid"`
 	EKCert string `json:"ek_certificate"`
@@ -198,7 +498,7 @@ func (c *APIClient) SendRequest(ctx context.Context, method string, endpoint str
 		}
 
 		if result.resp.StatusCode < 200 || result.resp.StatusCode > 299 {
-			return nil, fmt.Errorf("requisição falhou com status %d: %s", result.resp.StatusCode, string(respBody))
+			return nil, &StatusError{StatusCode: result.resp.StatusCode, Body: string(respBody)}
 		}
 
 		return respBody, nil
@@ -229,10 +529,19 @@ func (c *APIClient) EncryptRequest(ctx context.Context, method string, endpoint
 	_ = writer.WriteField("digital_signature", payload.DigitalSignature)
 	_ = writer.WriteField("hash_original", payload.HashOriginal)
 
+	if len(payload.WrappedKeys) > 0 {
+		wrappedKeysJSON, _ := json.Marshal(payload.WrappedKeys)
+		_ = writer.WriteField("wrapped_keys", string(wrappedKeysJSON))
+	}
+
 	// Convert metadata to JSON
 	metadataJSON, _ := json.Marshal(payload.Metadata)
 	_ = writer.WriteField("metadata", string(metadataJSON))
 
+	if payload.IdempotencyKey != "" {
+		_ = writer.WriteField("idempotency_key", payload.IdempotencyKey)
+	}
+
 	// Close the multipart writer
 	err = writer.Close()
 	if err != nil {
@@ -289,7 +598,7 @@ func (c *APIClient) EncryptRequest(ctx context.Context, method string, endpoint
 		}
 
 		if result.resp.StatusCode < 200 || result.resp.StatusCode > 299 {
-			return nil, fmt.Errorf("requisição falhou com status %d: %s", result.resp.StatusCode, string(respBody))
+			return nil, &StatusError{StatusCode: result.resp.StatusCode, Body: string(respBody)}
 		}
 
 		return respBody, nil
@@ -344,7 +653,7 @@ func (c *APIClient) DecryptRequest(ctx context.Context, method string, endpoint
 		// Check status code
 		if result.resp.StatusCode < 200 || result.resp.StatusCode > 299 {
 			body, _ := io.ReadAll(result.resp.Body)
-			return nil, fmt.Errorf("requisição falhou com status %d: %s", result.resp.StatusCode, string(body))
+			return nil, &StatusError{StatusCode: result.resp.StatusCode, Body: string(body)}
 		}
 
 		// Read metadata from header
@@ -355,9 +664,11 @@ func (c *APIClient) DecryptRequest(ctx context.Context, method string, endpoint
 
 		// Parse metadata
 		var metadata struct {
-			FileName              string `json:"file_name"`
-			EncryptedSymmetricKey string `json:"encrypted_symmetric_key"`
-			DigitalSignature      string `json:"digital_signature"`
+			FileName              string             `json:"file_name"`
+			EncryptedSymmetricKey string             `json:"encrypted_symmetric_key"`
+			WrappedKeys           []types.WrappedKey `json:"wrapped_keys"`
+			DigitalSignature      string             `json:"digital_signature"`
+			DeviceUUID            string             `json:"device_uuid"`
 		}
 
 		if err := json.Unmarshal([]byte(metadataJSON), &metadata); err != nil {
@@ -378,7 +689,9 @@ func (c *APIClient) DecryptRequest(ctx context.Context, method string, endpoint
 		response := &types.DecryptResponse{
 			EncryptedData:         encryptedData,
 			EncryptedSymmetricKey: encryptedSymmetricKey,
+			WrappedKeys:           metadata.WrappedKeys,
 			DigitalSignature:      metadata.DigitalSignature,
+			SignerUUID:            metadata.DeviceUUID,
 			FileName:              metadata.FileName,
 		}
 
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"tpm-bunker/internal/types"
+)
+
+// UploadInit abre um envio em partes. Os campos do pacote são os mesmos de
+// EncryptionRequest; os dados seguem depois, parte a parte.
+type UploadInit struct {
+	Size         int64    `json:"size"`
+	ChunkSize    int      `json:"chunk_size"`
+	ChunkDigests []string `json:"chunk_digests"`
+	Digest       string   `json:"sha256"`
+
+	EncryptedKey     string             `json:"encrypted_symmetric_key"`
+	WrappedKeys      []types.WrappedKey `json:"wrapped_keys"`
+	DigitalSignature string             `json:"digital_signature"`
+	HashOriginal     string             `json:"hash_original"`
+	Metadata         map[string]string  `json:"metadata"`
+	// Repetido com a mesma chave, o servidor retoma a sessão aberta ou
+	// informa a operação já criada
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// UploadStatus é o estado de um envio em partes no servidor
+type UploadStatus struct {
+	UploadID string `json:"upload_id"`
+	Received []int  `json:"received"`
+	// Operação já criada por um envio com a mesma chave
+	OperationID string `json:"operation_id,omitempty"`
+}
+
+// DownloadManifest descreve as partes de um pacote armazenado
+type DownloadManifest struct {
+	Size         int64    `json:"size"`
+	ChunkSize    int      `json:"chunk_size"`
+	ChunkDigests []string `json:"chunk_digests"`
+	Digest       string   `json:"sha256"`
+
+	FileName              string             `json:"file_name"`
+	EncryptedSymmetricKey string             `json:"encrypted_symmetric_key"`
+	WrappedKeys           []types.WrappedKey `json:"wrapped_keys"`
+	DigitalSignature      string             `json:"digital_signature"`
+	DeviceUUID            string             `json:"device_uuid"`
+}
+
+// StoredDigest é o digest que o servidor calcula sobre o conteúdo
+// armazenado de um pacote, e não o declarado no envio
+type StoredDigest struct {
+	Digest     string `json:"sha256"`
+	Size       int64  `json:"size"`
+	ComputedAt string `json:"computed_at"`
+}
+
+// CreateUpload abre um envio em partes
+func (c *APIClient) CreateUpload(ctx context.Context, headers map[string]string, init *UploadInit) (*UploadStatus, error) {
+	response, err := c.SendRequest(ctx, http.MethodPost, "operations/uploads/", headers, init)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao iniciar envio: %w", err)
+	}
+
+	var status UploadStatus
+	if err := json.Unmarshal(response, &status); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar envio: %w", err)
+	}
+	return &status, nil
+}
+
+// GetUpload retorna as partes já recebidas de um envio
+func (c *APIClient) GetUpload(ctx context.Context, headers map[string]string, uploadID string) (*UploadStatus, error) {
+	response, err := c.SendRequest(ctx, http.MethodGet, fmt.Sprintf("operations/uploads/%s/", uploadID), headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar envio: %w", err)
+	}
+
+	var status UploadStatus
+	if err := json.Unmarshal(response, &status); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar envio: %w", err)
+	}
+	return &status, nil
+}
+
+// PutChunk envia uma parte. O servidor confere o digest antes de aceitá-la.
+func (c *APIClient) PutChunk(ctx context.Context, headers map[string]string, uploadID string, index int, data []byte, digest string) error {
+	endpoint := fmt.Sprintf("operations/uploads/%s/chunks/%d/", uploadID, index)
+	extra := map[string]string{"X-Chunk-SHA256": digest}
+	for k, v := range headers {
+		extra[k] = v
+	}
+
+	if _, err := c.rawRequest(ctx, http.MethodPut, endpoint, extra, data); err != nil {
+		return fmt.Errorf("erro ao enviar parte %d: %w", index, err)
+	}
+	return nil
+}
+
+// CompleteUpload pede ao servidor que monte o pacote a partir das partes
+func (c *APIClient) CompleteUpload(ctx context.Context, headers map[string]string, uploadID, idempotencyKey string) (*EncryptionResponse, error) {
+	body := map[string]string{"idempotency_key": idempotencyKey}
+	response, err := c.SendRequest(ctx, http.MethodPost, fmt.Sprintf("operations/uploads/%s/complete/", uploadID), headers, body)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao concluir envio: %w", err)
+	}
+
+	var stored EncryptionResponse
+	if err := json.Unmarshal(response, &stored); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar envio: %w", err)
+	}
+	return &stored, nil
+}
+
+// AbortUpload descarta um envio em partes e as partes já recebidas
+func (c *APIClient) AbortUpload(ctx context.Context, headers map[string]string, uploadID string) error {
+	if _, err := c.SendRequest(ctx, http.MethodDelete, fmt.Sprintf("operations/uploads/%s/", uploadID), headers, nil); err != nil {
+		return fmt.Errorf("erro ao cancelar envio: %w", err)
+	}
+	return nil
+}
+
+// GetManifest retorna a descrição das partes de um pacote
+func (c *APIClient) GetManifest(ctx context.Context, headers map[string]string, operationID string) (*DownloadManifest, error) {
+	response, err := c.SendRequest(ctx, http.MethodGet, fmt.Sprintf("operations/%s/manifest/", operationID), headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter manifesto: %w", err)
+	}
+
+	var manifest DownloadManifest
+	if err := json.Unmarshal(response, &manifest); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar manifesto: %w", err)
+	}
+	return &manifest, nil
+}
+
+// GetStoredDigest pede ao servidor o digest do conteúdo armazenado de um
+// pacote, sem baixá-lo
+func (c *APIClient) GetStoredDigest(ctx context.Context, headers map[string]string, operationID string) (*StoredDigest, error) {
+	response, err := c.SendRequest(ctx, http.MethodGet, fmt.Sprintf("operations/%s/digest/", operationID), headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter digest armazenado: %w", err)
+	}
+
+	var digest StoredDigest
+	if err := json.Unmarshal(response, &digest); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar digest armazenado: %w", err)
+	}
+	return &digest, nil
+}
+
+// GetChunk baixa uma parte de um pacote
+func (c *APIClient) GetChunk(ctx context.Context, headers map[string]string, operationID string, index int) ([]byte, error) {
+	data, err := c.rawRequest(ctx, http.MethodGet, fmt.Sprintf("operations/%s/chunks/%d/", operationID, index), headers, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao baixar parte %d: %w", index, err)
+	}
+	return data, nil
+}
+
+// rawRequest envia e recebe bytes sem serialização JSON
+func (c *APIClient) rawRequest(ctx context.Context, method string, endpoint string, headers map[string]string, data []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar requisição: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if c.authToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.authToken))
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao enviar requisição: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler resposta: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return respBody, nil
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"tpm-bunker/internal/types"
+)
+
+const (
+	appDirName     = "tpm-bunker"
+	configFileName = "config.json"
+)
+
+// Config contém as preferências locais do agente
+type Config struct {
+	// Compression define a compressão aplicada antes da encriptação:
+	// "auto", "none", "gzip" ou "zstd"
+	Compression string `json:"compression"`
+
+	// DefaultRecipients são UUIDs de outros dispositivos para os quais os
+	// arquivos são encriptados além deste
+	DefaultRecipients []string `json:"default_recipients"`
+
+	// TrustedDevices são os outros dispositivos cujas assinaturas são
+	// aceitas, com as chaves fixadas localmente
+	TrustedDevices []types.TrustedDevice `json:"trusted_devices"`
+
+	// DecryptDir é o diretório padrão dos arquivos decriptados. Se vazio,
+	// usa a pasta Downloads.
+	DecryptDir string `json:"decrypt_dir"`
+
+	// ScratchTTLMinutes é o tempo de vida padrão das cópias decriptadas
+	// temporárias
+	ScratchTTLMinutes int `json:"scratch_ttl_minutes"`
+
+	// RestorePolicy define o que fazer com metadados do arquivo original
+	// que não podem ser restaurados nesta plataforma: "best_effort",
+	// "strict" ou "none"
+	RestorePolicy string `json:"restore_policy"`
+
+	// Padding esconde o tamanho exato dos arquivos no servidor: "none",
+	// "padme" ou "pow2"
+	Padding string `json:"padding"`
+
+	// Deduplicate evita reenviar conteúdo já armazenado por este dispositivo
+	Deduplicate bool `json:"deduplicate"`
+
+	// KeepVersions é o número máximo de versões mantidas por arquivo e
+	// KeepDays a idade máxima de uma versão; zero desativa cada limite. A
+	// versão mais recente nunca é removida.
+	KeepVersions int `json:"keep_versions"`
+	KeepDays     int `json:"keep_days"`
+
+	// WatchedFolders são as pastas cujos arquivos são encriptados
+	// automaticamente
+	WatchedFolders []types.WatchedFolder `json:"watched_folders"`
+
+	// BackupJobs são os backups agendados
+	BackupJobs []types.BackupJob `json:"backup_jobs"`
+
+	// AuditIntervalHours é o intervalo entre auditorias de integridade
+	// automáticas, zero as desativa; AuditMode é "quick" ou "full"
+	AuditIntervalHours int    `json:"audit_interval_hours"`
+	AuditMode          string `json:"audit_mode"`
+
+	mutex sync.Mutex
+	path  string
+}
+
+// Default retorna a configuração padrão
+func Default() *Config {
+	return &Config{
+		Compression:        "auto",
+		ScratchTTLMinutes:  15,
+		RestorePolicy:      "best_effort",
+		Padding:            "none",
+		Deduplicate:        true,
+		AuditIntervalHours: 7 * 24,
+		AuditMode:          "quick",
+	}
+}
+
+// Dir retorna o diretório de dados locais do agente, criando-o se necessário
+func Dir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("erro ao obter diretório de configuração: %w", err)
+	}
+
+	dir := filepath.Join(base, appDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("erro ao criar diretório de configuração: %w", err)
+	}
+	return dir, nil
+}
+
+// Load lê a configuração do disco. Campos ausentes mantêm os valores padrão
+// e, se o arquivo não existir, retorna a configuração padrão.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	dir, err := Dir()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.path = filepath.Join(dir, configFileName)
+
+	data, err := os.ReadFile(cfg.path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("erro ao ler configuração: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return cfg, fmt.Errorf("erro ao decodificar configuração: %w", err)
+	}
+	return cfg, nil
+}
+
+// Save grava a configuração no disco
+func (c *Config) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.path == "" {
+		dir, err := Dir()
+		if err != nil {
+			return err
+		}
+		c.path = filepath.Join(dir, configFileName)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("erro ao serializar configuração: %w", err)
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("erro ao gravar configuração: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Trusted retorna uma cópia dos dispositivos confiáveis
+func (c *Config) Trusted() []types.TrustedDevice {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]types.TrustedDevice(nil), c.TrustedDevices...)
+}
+
+// SetTrusted substitui os dispositivos confiáveis e grava a configuração
+func (c *Config) SetTrusted(devices []types.TrustedDevice) error {
+	c.mutex.Lock()
+	c.TrustedDevices = devices
+	c.mutex.Unlock()
+	return c.Save()
+}
+
+// Folders retorna uma cópia das pastas vigiadas
+func (c *Config) Folders() []types.WatchedFolder {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]types.WatchedFolder(nil), c.WatchedFolders...)
+}
+
+// SetFolders substitui as pastas vigiadas e grava a configuração
+func (c *Config) SetFolders(folders []types.WatchedFolder) error {
+	c.mutex.Lock()
+	c.WatchedFolders = folders
+	c.mutex.Unlock()
+	return c.Save()
+}
+
+// Jobs retorna uma cópia dos backups agendados
+func (c *Config) Jobs() []types.BackupJob {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]types.BackupJob(nil), c.BackupJobs...)
+}
+
+// SetJobs substitui os backups agendados e grava a configuração
+func (c *Config) SetJobs(jobs []types.BackupJob) error {
+	c.mutex.Lock()
+	c.BackupJobs = jobs
+	c.mutex.Unlock()
+	return c.Save()
+}
@@ -6,6 +6,8 @@ class Device(Document):
     ek_certificate = StringField(required=True)  # TPM Endorsement Key
     aik = StringField(required=True)  # Attestation Identity Key
     public_key = StringField(required=True)
+    # Chave RSA usada por outros dispositivos para encriptar para este
+    encryption_public_key = StringField(null=True)
     is_active = BooleanField(default=True)
 
     registered_at = DateTimeField()
@@ -1,5 +1,7 @@
 from datetime import datetime
 
+from cryptography.hazmat.primitives import serialization
+from cryptography.hazmat.primitives.asymmetric import rsa
 from rest_framework.serializers import (
     BooleanField,
     CharField,
@@ -19,6 +21,11 @@ class DeviceRegistrationSerializer(Serializer):
     )
     aik = CharField(help_text="Attestation Identity Key do dispositivo")
     public_key = CharField(help_text="Chave pública do dispositivo")
+    encryption_public_key = CharField(
+        required=False,
+        allow_null=True,
+        help_text="Chave pública de encriptação do dispositivo",
+    )
 
     def validate_uuid(self, value):
         if Device.objects(uuid=value).count() > 0:
@@ -50,3 +57,18 @@ class DeviceSerializer(DeviceRegistrationSerializer):
     last_access = DateTimeField(
         read_only=True, help_text="Último acesso do dispositivo"
     )
+
+
+class EncryptionKeySerializer(Serializer):
+    encryption_public_key = CharField(
+        help_text="Chave pública de encriptação do dispositivo"
+    )
+
+    def validate_encryption_public_key(self, value):
+        try:
+            key = serialization.load_pem_public_key(value.encode())
+        except ValueError:
+            raise ValidationError("Chave pública inválida")
+        if not isinstance(key, rsa.RSAPublicKey):
+            raise ValidationError("A chave de encriptação deve ser RSA")
+        return value
@@ -18,6 +18,7 @@ class DevicesService:
             ek_certificate=serializer_data["ek_certificate"],
             aik=serializer_data["aik"],
             public_key=serializer_data["public_key"],
+            encryption_public_key=serializer_data.get("encryption_public_key"),
             registered_at=datetime.now(),
         )
 
@@ -27,3 +28,8 @@ class DevicesService:
         # Implementar validação do certificado EK
         # Por enquanto retorna True
         return True
+
+    def set_encryption_key(self, device, encryption_public_key):
+        device.encryption_public_key = encryption_public_key
+        device.save()
+        return DeviceSerializer(device).data
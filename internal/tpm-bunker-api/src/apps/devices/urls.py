@@ -30,4 +30,8 @@ urlpatterns = [
             }
         ),
     ),
+    path(
+        "<uuid:uuid>/encryption_key/",
+        DeviceViewSet.as_view({"put": "set_encryption_key"}),
+    ),
 ]
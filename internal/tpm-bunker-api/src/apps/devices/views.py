@@ -5,7 +5,11 @@ from rest_framework.response import Response
 from rest_framework.serializers import ValidationError
 
 from .models import Device
-from .serializers import DeviceRegistrationSerializer, DeviceSerializer
+from .serializers import (
+    DeviceRegistrationSerializer,
+    DeviceSerializer,
+    EncryptionKeySerializer,
+)
 from .services import DevicesService
 
 
@@ -36,6 +40,14 @@ from .services import DevicesService
     destroy=extend_schema(
         summary="Delete device", description="Remove um dispositivo do sistema."
     ),
+    set_encryption_key=extend_schema(
+        summary="Set device encryption key",
+        description="""
+       Publica a chave pública de encriptação do próprio dispositivo.
+       Usado por dispositivos registrados antes de a chave existir.
+       """,
+        request=EncryptionKeySerializer,
+    ),
 )
 class DeviceViewSet(viewsets.ModelViewSet):
     permission_classes = [IsAuthenticated]
@@ -51,6 +63,8 @@ class DeviceViewSet(viewsets.ModelViewSet):
     def get_serializer_class(self):
         if self.action == "create":
             return DeviceRegistrationSerializer
+        if self.action == "set_encryption_key":
+            return EncryptionKeySerializer
         return super().get_serializer_class()
 
     def get_permissions(self):
@@ -71,3 +85,26 @@ class DeviceViewSet(viewsets.ModelViewSet):
             return Response(device, status=status.HTTP_201_CREATED)
         except ValidationError as e:
             return Response(e.detail, status=status.HTTP_400_BAD_REQUEST)
+
+    def set_encryption_key(self, request, uuid=None):
+        # Cada dispositivo só publica a própria chave
+        if str(request.user.uuid) != str(uuid):
+            return Response(
+                {"error": "Dispositivo não autorizado"},
+                status=status.HTTP_403_FORBIDDEN,
+            )
+
+        device = Device.objects(uuid=uuid).first()
+        if not device:
+            return Response(
+                {"error": "Dispositivo não encontrado"},
+                status=status.HTTP_404_NOT_FOUND,
+            )
+
+        serializer = self.get_serializer(data=request.data)
+        serializer.is_valid(raise_exception=True)
+
+        data = self.service_class.set_encryption_key(
+            device, serializer.validated_data["encryption_public_key"]
+        )
+        return Response(data, status=status.HTTP_200_OK)
@@ -8,6 +8,8 @@ from mongoengine import (
     DictField,
     Document,
     FloatField,
+    IntField,
+    ListField,
     ObjectIdField,
     ReferenceField,
     StringField,
@@ -24,11 +26,23 @@ class Operation(Document):
     error_message = StringField(null=True, blank=True)
 
     created_at = DateTimeField(default=datetime.now)
+    # Última alteração, usada na sincronização incremental da listagem
+    updated_at = DateTimeField(default=datetime.now)
+
+    # Chave enviada pelo cliente com o pacote; repetir o envio com a mesma
+    # chave retorna esta operação em vez de criar outra
+    idempotency_key = StringField(max_length=100)
 
     meta = {
         "indexes": [
             {"fields": ["device", "operation_type"]},
             {"fields": ["status", "created_at"]},
+            {"fields": ["device", "updated_at"]},
+            {
+                "fields": ["device", "idempotency_key"],
+                "unique": True,
+                "partialFilterExpression": {"idempotency_key": {"$exists": True}},
+            },
         ]
     }
 
@@ -43,6 +57,17 @@ class EncryptedPackage(Document):
     digital_signature = StringField(required=True)
     hash_original = StringField(required=True)  # Hash dos dados originais
     metadata = DictField(default=dict)  # Metadados adicionais
+    # Chave simétrica encriptada para cada destinatário do pacote
+    wrapped_keys = ListField(DictField(), default=list)
+    # Anotações cifradas e assinadas pelo dispositivo que as editou
+    annotation = DictField(null=True)
+
+    # Manifesto do recebimento em partes, calculado sobre o conteúdo
+    # armazenado
+    size = IntField(null=True)
+    sha256 = StringField(null=True)
+    chunk_size = IntField(null=True)
+    chunk_digests = ListField(StringField(), default=list)
 
     created_at = DateTimeField(default=datetime.now)
 
@@ -73,6 +98,57 @@ class EncryptedPackage(Document):
             raise ValidationError(f"Erro ao salvar arquivo no GridFS: {str(e)}")
 
 
+class Grant(Document):
+    """Acesso de outro dispositivo a um pacote, concedido pelo dono"""
+
+    operation = ReferenceField("Operation", required=True)
+    device_uuid = StringField(required=True)
+    key_id = StringField(required=True)
+    encrypted_key = BinaryField(required=True)
+    granted_by = StringField(required=True)
+    signature = StringField(required=True)
+
+    created_at = DateTimeField(default=datetime.now)
+
+    meta = {
+        "indexes": [
+            {"fields": ["operation", "device_uuid"], "unique": True},
+            {"fields": ["device_uuid"]},
+        ]
+    }
+
+
+class UploadSession(Document):
+    """Envio em partes ainda não concluído. As partes ficam no GridFS até o
+    pacote ser montado ou o envio ser cancelado."""
+
+    device = ReferenceField("Device", required=True)
+    upload_id = StringField(required=True, unique=True)
+
+    size = IntField(required=True)
+    chunk_size = IntField(required=True)
+    chunk_digests = ListField(StringField(), required=True)
+    sha256 = StringField(required=True)
+    # Índice da parte -> arquivo no GridFS
+    chunk_ids = DictField(default=dict)
+
+    encrypted_symmetric_key = StringField(required=True)
+    wrapped_keys = ListField(DictField(), default=list)
+    digital_signature = StringField(required=True)
+    hash_original = StringField(required=True)
+    metadata = DictField(default=dict)
+    idempotency_key = StringField(max_length=100)
+
+    created_at = DateTimeField(default=datetime.now)
+
+    meta = {
+        "indexes": [
+            {"fields": ["device", "created_at"]},
+            {"fields": ["device", "idempotency_key"]},
+        ]
+    }
+
+
 class OperationLog(Document):
     operation = ReferenceField("Operation", required=True)
     action = StringField(max_length=100, required=True)
@@ -3,13 +3,20 @@ from rest_framework.serializers import (
     DateTimeField,
     FileField,
     FloatField,
+    IntegerField,
     JSONField,
+    ListField,
+    RegexField,
     Serializer,
     UUIDField,
 )
 
 from .models import EncryptedPackage
 
+# Limite das partes de um envio, abaixo de DATA_UPLOAD_MAX_MEMORY_SIZE para
+# que o corpo de cada parte possa ser lido de uma vez
+MAX_UPLOAD_CHUNK_SIZE = 2 * 1024 * 1024
+
 
 class OperationSerializer(Serializer):
     id = UUIDField(read_only=True)
@@ -40,9 +47,15 @@ class OperationSerializer(Serializer):
         if encrypted_package:
             representation["file_name"] = encrypted_package.file_name
             representation["file_size"] = encrypted_package.file_size
+            # Metadados cifrados pelo cliente, decriptados localmente na
+            # listagem
+            representation["metadata"] = encrypted_package.metadata
+            representation["annotation"] = encrypted_package.annotation or None
         else:
             representation["file_name"] = None
             representation["file_size"] = None
+            representation["metadata"] = None
+            representation["annotation"] = None
 
         return representation
 
@@ -63,13 +76,115 @@ class OperationLogSerializer(Serializer):
     timestamp = DateTimeField(read_only=True, help_text="Data e hora do log")
 
 
+class WrappedKeySerializer(Serializer):
+    device_uuid = CharField(help_text="UUID do dispositivo destinatário")
+    key_id = CharField(
+        allow_blank=True, help_text="Impressão digital da chave do destinatário"
+    )
+    encrypted_key = CharField(help_text="Chave simétrica encriptada, em base64")
+
+
 class StoreDataSerializer(Serializer):
     encrypted_data = FileField(help_text="Arquivo contendo os dados criptografados")
     encrypted_symmetric_key = CharField(help_text="Chave simétrica criptografada")
     digital_signature = CharField(help_text="Assinatura digital do dispositivo")
     hash_original = CharField(help_text="Hash dos dados originais")
     metadata = JSONField(required=False, help_text="Metadados adicionais")
+    wrapped_keys = JSONField(
+        required=False, help_text="Chave simétrica encriptada por destinatário"
+    )
+    idempotency_key = CharField(
+        required=False,
+        max_length=100,
+        help_text="Chave do envio; repeti-la retorna a operação já criada",
+    )
+
+    def validate_wrapped_keys(self, value):
+        serializer = WrappedKeySerializer(data=value, many=True)
+        serializer.is_valid(raise_exception=True)
+        return serializer.validated_data
+
+
+class UploadInitSerializer(Serializer):
+    size = IntegerField(min_value=1, help_text="Tamanho do pacote, em bytes")
+    chunk_size = IntegerField(
+        min_value=1, max_value=MAX_UPLOAD_CHUNK_SIZE, help_text="Tamanho das partes"
+    )
+    chunk_digests = ListField(
+        child=RegexField(r"^[0-9a-fA-F]{64}$"),
+        allow_empty=False,
+        help_text="SHA-256 de cada parte, em hexadecimal",
+    )
+    sha256 = RegexField(
+        r"^[0-9a-fA-F]{64}$", help_text="SHA-256 do pacote, em hexadecimal"
+    )
+    encrypted_symmetric_key = CharField(help_text="Chave simétrica criptografada")
+    digital_signature = CharField(help_text="Assinatura digital do dispositivo")
+    hash_original = CharField(help_text="Hash dos dados originais")
+    metadata = JSONField(required=False, help_text="Metadados adicionais")
+    wrapped_keys = JSONField(
+        required=False, help_text="Chave simétrica encriptada por destinatário"
+    )
+    idempotency_key = CharField(
+        required=False,
+        max_length=100,
+        help_text="Chave do envio; repeti-la retorna a operação já criada",
+    )
+
+    def validate_wrapped_keys(self, value):
+        serializer = WrappedKeySerializer(data=value, many=True)
+        serializer.is_valid(raise_exception=True)
+        return serializer.validated_data
+
+
+class UploadStatusSerializer(Serializer):
+    upload_id = CharField(read_only=True)
+    received = ListField(child=IntegerField(), read_only=True)
+    # Preenchido quando a chave do envio já criou uma operação
+    operation_id = CharField(read_only=True, required=False)
+
+
+class UploadCompleteSerializer(Serializer):
+    idempotency_key = CharField(
+        required=False,
+        max_length=100,
+        help_text="Chave do envio; repeti-la retorna a operação já criada",
+    )
 
 
 class RetrieveDataSerializer(Serializer):
     operation_id = CharField(help_text="ID da operação para recuperação de dados")
+
+
+class GrantRequestSerializer(Serializer):
+    device_uuid = CharField(help_text="UUID do dispositivo que recebe o acesso")
+    key_id = CharField(help_text="Impressão digital da chave do destinatário")
+    encrypted_key = CharField(help_text="Chave simétrica encriptada, em base64")
+    granted_by = CharField(help_text="UUID do dispositivo que concede o acesso")
+    signature = CharField(help_text="Assinatura da concessão pelo dono do pacote")
+
+
+class GrantSerializer(Serializer):
+    device_uuid = CharField(read_only=True)
+    key_id = CharField(read_only=True)
+    granted_by = CharField(read_only=True)
+    created_at = DateTimeField(read_only=True)
+
+    def to_representation(self, instance):
+        representation = super().to_representation(instance)
+        representation["operation_id"] = str(instance.operation.id)
+        return representation
+
+
+class DeleteRequestSerializer(Serializer):
+    operation_id = CharField(help_text="ID da operação a remover")
+    device_uuid = CharField(help_text="UUID do dispositivo que pede a remoção")
+    requested_at = DateTimeField(help_text="Momento do pedido, em UTC")
+    signature = CharField(help_text="Assinatura do pedido pelo dispositivo")
+
+
+class AnnotationSerializer(Serializer):
+    sealed = CharField(help_text="Anotações cifradas com a chave do pacote")
+    signer_uuid = CharField(help_text="UUID do dispositivo que editou")
+    signed_at = DateTimeField(help_text="Momento da edição, em UTC")
+    signature = CharField(help_text="Assinatura das anotações")
@@ -1,20 +1,90 @@
 import hashlib
 import traceback
+from datetime import datetime, timedelta, timezone
+from uuid import uuid4
 from base64 import b64decode
 
+from base64 import b64encode
+
 from bson.objectid import ObjectId
+from gridfs import GridFS
+from mongoengine.connection import get_db
+from mongoengine.queryset.visitor import Q
 from cryptography.hazmat.primitives import hashes, serialization
 from cryptography.hazmat.primitives.asymmetric import padding, utils
+from devices.models import Device
+from mongoengine.errors import NotUniqueError
+from rest_framework import status
+from rest_framework.exceptions import APIException, NotFound, PermissionDenied
 from rest_framework.serializers import ValidationError
 
 from .enums import OperationTypes, StatusChoices
-from .models import EncryptedPackage, Operation, OperationLog
+from .models import EncryptedPackage, Grant, Operation, OperationLog, UploadSession
+
+# Janela em que um pedido de remoção assinado é aceito, contra reenvios
+DELETE_REQUEST_WINDOW = timedelta(minutes=10)
+
+# Tamanho das partes oferecidas no recebimento em partes
+MANIFEST_CHUNK_SIZE = 1024 * 1024
+
+# Tempo após o qual um envio ainda em processamento é considerado
+# interrompido, liberando sua chave para uma nova tentativa
+STALE_PROCESSING = timedelta(minutes=15)
+
+
+class Conflict(APIException):
+    status_code = status.HTTP_409_CONFLICT
+    default_detail = "Envio com a mesma chave em processamento"
+    default_code = "conflict"
+
+
+def parse_cursor(value):
+    """Interpreta o cursor da sincronização, no formato
+    "<updated_at ISO>|<ID>". Vazio indica o início da listagem; cursores
+    antigos, só com o instante, são aceitos sem o ID."""
+    if not value:
+        return None
+    updated_at, _, operation_id = value.partition("|")
+    try:
+        return (
+            datetime.fromisoformat(updated_at),
+            ObjectId(operation_id) if operation_id else None,
+        )
+    except Exception:
+        raise ValueError("cursor inválido")
+
+
+def parse_filter_datetime(value):
+    """Interpreta um limite do filtro de datas. As datas das operações são
+    gravadas sem fuso, no horário local do servidor, e instantes com fuso
+    são convertidos para ele."""
+    if not value:
+        return None
+    try:
+        parsed = datetime.fromisoformat(value)
+    except ValueError:
+        raise ValidationError({"error": f"Data inválida: {value}"})
+    if parsed.tzinfo is not None:
+        parsed = parsed.astimezone().replace(tzinfo=None)
+    return parsed
+
+
+def format_cursor(cursor):
+    if not cursor:
+        return ""
+    updated_at, operation_id = cursor
+    if operation_id is None:
+        return updated_at.isoformat()
+    return f"{updated_at.isoformat()}|{operation_id}"
 
 
 def _verify_signature(device, encrypted_data, signature):
+    return _verify_digest(device, hashlib.sha256(encrypted_data).digest(), signature)
+
+
+def _verify_digest(device, hashed_data, signature):
     try:
         # Preparação dos dados
-        hashed_data = hashlib.sha256(encrypted_data).digest()
         decoded_signature = b64decode(signature)
 
         # Carregar a chave pública
@@ -38,21 +108,91 @@ def _verify_signature(device, encrypted_data, signature):
         return False
 
 
+def _set_manifest(encrypted_package, encrypted_data):
+    """Divide o pacote em partes para o recebimento em partes"""
+    encrypted_package.size = len(encrypted_data)
+    encrypted_package.sha256 = hashlib.sha256(encrypted_data).hexdigest()
+    encrypted_package.chunk_size = MANIFEST_CHUNK_SIZE
+    encrypted_package.chunk_digests = [
+        hashlib.sha256(encrypted_data[start : start + MANIFEST_CHUNK_SIZE]).hexdigest()
+        for start in range(0, len(encrypted_data), MANIFEST_CHUNK_SIZE)
+    ]
+
+
+def _upload_status(upload):
+    return {
+        "upload_id": upload.upload_id,
+        "received": sorted(int(index) for index in upload.chunk_ids),
+    }
+
+
+def _as_utc(value):
+    if value.tzinfo is None:
+        return value.replace(tzinfo=timezone.utc)
+    return value
+
+
+def _stored_response(operation):
+    return {"operation_id": str(operation.id), "status": "success"}
+
+
 class OperationService:
     def store_data(self, device, serializer_data):
+        if not hasattr(serializer_data["encrypted_data"], "read"):
+            raise ValidationError({"error": "Invalid file format"})
+
+        key = serializer_data.get("idempotency_key")
+        existing = self._keyed_operation(device, key)
+        if existing:
+            return _stored_response(existing)
+
+        return self._store_package(
+            device,
+            serializer_data["encrypted_data"].read(),
+            serializer_data["encrypted_data"].name,
+            serializer_data,
+            key,
+        )
+
+    def _keyed_operation(self, device, key):
+        """Operação já concluída com a chave de envio informada. Uma em
+        processamento ainda pode concluir, e a nova tentativa é recusada;
+        uma que falhou ou foi interrompida libera a chave."""
+        if not key:
+            return None
+        operation = Operation.objects(device=device, idempotency_key=key).first()
+        if not operation:
+            return None
+        if operation.status == StatusChoices.COMPLETED:
+            return operation
+        if (
+            operation.status == StatusChoices.PROCESSING
+            and datetime.now() - operation.updated_at < STALE_PROCESSING
+        ):
+            raise Conflict()
+        operation.update(unset__idempotency_key=True)
+        return None
+
+    def _store_package(
+        self, device, encrypted_data, file_name, serializer_data, key=None
+    ):
         operation = Operation(
             device=device,
             operation_type=OperationTypes.STORE,
             status=StatusChoices.PROCESSING,
-        ).save()
+            idempotency_key=key,
+        )
+        try:
+            operation.save()
+        except NotUniqueError:
+            # Outra requisição com a mesma chave criou a operação
+            existing = self._keyed_operation(device, key)
+            if existing:
+                return _stored_response(existing)
+            raise Conflict()
 
         try:
-            if hasattr(serializer_data["encrypted_data"], "read"):
-                encrypted_data = serializer_data["encrypted_data"].read()
-                file_name = serializer_data["encrypted_data"].name
-                file_size = len(encrypted_data) / (1024 * 1024)
-            else:
-                raise ValidationError({"error": "Invalid file format"})
+            file_size = len(encrypted_data) / (1024 * 1024)
 
             try:
                 encrypted_symmetric_key = b64decode(
@@ -77,12 +217,18 @@ class OperationService:
                 digital_signature=serializer_data["digital_signature"],
                 hash_original=serializer_data["hash_original"],
                 metadata=serializer_data.get("metadata", {}),
+                wrapped_keys=[
+                    dict(wrapped) for wrapped in serializer_data.get("wrapped_keys", [])
+                ],
             )
+            _set_manifest(encrypted_package, encrypted_data)
             # Use o setter do encrypted_data que salvará no GridFS
             encrypted_package.encrypted_data = encrypted_data
             encrypted_package.save()
 
-            operation.update(set__status=StatusChoices.COMPLETED)
+            operation.update(
+                set__status=StatusChoices.COMPLETED, set__updated_at=datetime.now()
+            )
 
             OperationLog(
                 operation=operation,
@@ -90,34 +236,515 @@ class OperationService:
                 details={"package_id": str(encrypted_package.id)},
             ).save()
 
-            return {"operation_id": str(operation.id), "status": "success"}
+            return _stored_response(operation)
 
         except Exception as e:
             operation.update(
-                set__status=StatusChoices.FAILED, set__error_message=str(e)
+                set__status=StatusChoices.FAILED,
+                set__error_message=str(e),
+                set__updated_at=datetime.now(),
             )
             OperationLog(
                 operation=operation, action="STORE_FAILED", details={"error": str(e)}
             ).save()
             raise ValidationError({"error": str(e)})
 
-    def retrieve_data(self, device, operation_id):
-        try:
-            if not ObjectId.is_valid(operation_id):
-                raise ValidationError({"error": "ID de operação inválido"})
+    def create_upload(self, device, serializer_data):
+        # Repetido com a mesma chave, o envio retoma a sessão aberta ou
+        # informa a operação já criada
+        key = serializer_data.get("idempotency_key")
+        existing = self._keyed_operation(device, key)
+        if existing:
+            return {"upload_id": "", "received": [], "operation_id": str(existing.id)}
+        if key:
+            upload = UploadSession.objects(device=device, idempotency_key=key).first()
+            if upload:
+                return _upload_status(upload)
+
+        size = serializer_data["size"]
+        chunk_size = serializer_data["chunk_size"]
+        chunk_digests = serializer_data["chunk_digests"]
+        if -(-size // chunk_size) != len(chunk_digests):
+            raise ValidationError({"error": "Número de partes não confere com o tamanho"})
+
+        upload = UploadSession(
+            device=device,
+            upload_id=str(uuid4()),
+            size=size,
+            chunk_size=chunk_size,
+            chunk_digests=[digest.lower() for digest in chunk_digests],
+            sha256=serializer_data["sha256"].lower(),
+            encrypted_symmetric_key=serializer_data["encrypted_symmetric_key"],
+            wrapped_keys=[
+                dict(wrapped) for wrapped in serializer_data.get("wrapped_keys", [])
+            ],
+            digital_signature=serializer_data["digital_signature"],
+            hash_original=serializer_data["hash_original"],
+            metadata=serializer_data.get("metadata", {}),
+            idempotency_key=key,
+        ).save()
+        return _upload_status(upload)
+
+    def upload_status(self, device, upload_id):
+        return _upload_status(self._upload(device, upload_id))
+
+    def put_chunk(self, device, upload_id, index, data, declared_digest):
+        upload = self._upload(device, upload_id)
+        if index < 0 or index >= len(upload.chunk_digests):
+            raise NotFound("Parte inexistente")
+
+        start = index * upload.chunk_size
+        expected_size = min(upload.chunk_size, upload.size - start)
+        digest = hashlib.sha256(data).hexdigest()
+        if len(data) != expected_size:
+            raise ValidationError({"error": "Tamanho da parte não confere"})
+        if digest != upload.chunk_digests[index] or (
+            declared_digest and declared_digest.lower() != digest
+        ):
+            raise ValidationError({"error": "Digest da parte não confere"})
+
+        fs = GridFS(get_db())
+        previous = upload.chunk_ids.get(str(index))
+        upload.chunk_ids[str(index)] = fs.put(data)
+        upload.save()
+        if previous:
+            fs.delete(previous)
+
+    def complete_upload(self, device, upload_id, key=None):
+        # Uma conclusão repetida, com a sessão já descartada, retorna a
+        # operação criada pela primeira
+        existing = self._keyed_operation(device, key)
+        if existing:
+            upload = UploadSession.objects(upload_id=upload_id, device=device).first()
+            if upload:
+                self._discard_upload(upload)
+            return _stored_response(existing)
+
+        upload = self._upload(device, upload_id)
+        missing = [
+            index
+            for index in range(len(upload.chunk_digests))
+            if str(index) not in upload.chunk_ids
+        ]
+        if missing:
+            raise ValidationError({"error": f"Partes pendentes: {missing}"})
+
+        # O pacote é montado no servidor a partir das partes
+        fs = GridFS(get_db())
+        encrypted_data = b"".join(
+            fs.get(upload.chunk_ids[str(index)]).read()
+            for index in range(len(upload.chunk_digests))
+        )
+        if hashlib.sha256(encrypted_data).hexdigest() != upload.sha256:
+            raise ValidationError({"error": "Digest do pacote não confere"})
+
+        response = self._store_package(
+            device,
+            encrypted_data,
+            upload.metadata.get("filename") or f"{upload.upload_id}.bin",
+            {
+                "encrypted_symmetric_key": upload.encrypted_symmetric_key,
+                "digital_signature": upload.digital_signature,
+                "hash_original": upload.hash_original,
+                "metadata": upload.metadata,
+                "wrapped_keys": upload.wrapped_keys,
+            },
+            upload.idempotency_key,
+        )
+        self._discard_upload(upload)
+        return response
+
+    def abort_upload(self, device, upload_id):
+        self._discard_upload(self._upload(device, upload_id))
+
+    def manifest(self, device, operation_id):
+        operation = self._readable_operation(device, operation_id)
+        encrypted_package = EncryptedPackage.objects(operation=operation).first()
+        if not encrypted_package:
+            raise NotFound("Pacote não encontrado")
+
+        # Pacotes anteriores ao envio em partes ganham o manifesto aqui
+        if not encrypted_package.sha256:
+            _set_manifest(encrypted_package, encrypted_package.encrypted_data)
+            encrypted_package.save()
+
+        return {
+            "size": encrypted_package.size,
+            "chunk_size": encrypted_package.chunk_size,
+            "chunk_digests": encrypted_package.chunk_digests,
+            "sha256": encrypted_package.sha256,
+            "file_name": encrypted_package.file_name,
+            "encrypted_symmetric_key": b64encode(
+                encrypted_package.encrypted_symmetric_key
+            ).decode("utf-8"),
+            "wrapped_keys": self.recipient_keys(encrypted_package),
+            "digital_signature": encrypted_package.digital_signature,
+            "device_uuid": str(operation.device.uuid),
+        }
+
+    def stored_digest(self, device, operation_id):
+        operation = self._readable_operation(device, operation_id)
+        encrypted_package = EncryptedPackage.objects(operation=operation).first()
+        if not encrypted_package:
+            raise NotFound("Pacote não encontrado")
+
+        # Calculado agora sobre o conteúdo armazenado, e não o declarado no
+        # envio, para que a auditoria detecte corrupção do armazenamento
+        digest = hashlib.sha256()
+        size = 0
+        grid_file = GridFS(get_db()).get(encrypted_package.encrypted_data_id)
+        for block in iter(lambda: grid_file.read(MANIFEST_CHUNK_SIZE), b""):
+            digest.update(block)
+            size += len(block)
+
+        return {
+            "sha256": digest.hexdigest(),
+            "size": size,
+            "computed_at": datetime.now(timezone.utc).isoformat(),
+        }
 
-            operation = Operation.objects(
-                id=operation_id, device=device, status=StatusChoices.COMPLETED
-            ).first()
+    def chunk(self, device, operation_id, index):
+        operation = self._readable_operation(device, operation_id)
+        encrypted_package = EncryptedPackage.objects(operation=operation).first()
+        if not encrypted_package or not encrypted_package.chunk_size:
+            raise NotFound("Pacote não encontrado")
+        if index < 0 or index >= len(encrypted_package.chunk_digests):
+            raise NotFound("Parte inexistente")
 
-            if not operation:
-                raise Operation.DoesNotExist()
+        grid_file = GridFS(get_db()).get(encrypted_package.encrypted_data_id)
+        grid_file.seek(index * encrypted_package.chunk_size)
+        return grid_file.read(encrypted_package.chunk_size)
+
+    def _upload(self, device, upload_id):
+        upload = UploadSession.objects(upload_id=upload_id, device=device).first()
+        if not upload:
+            raise NotFound("Envio não encontrado")
+        return upload
+
+    def _discard_upload(self, upload):
+        fs = GridFS(get_db())
+        for chunk_id in upload.chunk_ids.values():
+            fs.delete(chunk_id)
+        upload.delete()
+
+    def retrieve_data(self, device, operation_id):
+        try:
+            operation = self._readable_operation(device, operation_id)
 
             encrypted_package = EncryptedPackage.objects(operation=operation).first()
             if not encrypted_package:
-                raise EncryptedPackage.DoesNotExist()
+                raise NotFound("Pacote não encontrado")
 
             return encrypted_package
 
+        except NotFound:
+            raise
         except Exception as e:
             raise ValidationError({"error": f"Erro inesperado: {str(e)}"}, code=500)
+
+    def list_operations(
+        self,
+        device,
+        operation_type=None,
+        status=None,
+        created_from=None,
+        created_to=None,
+        ordering="-created_at",
+    ):
+        """Pacotes do dispositivo, filtrados por tipo, estado e intervalo de
+        criação ([created_from, created_to)) e ordenados por data de criação.
+        Nomes e anotações são opacos aqui; filtrá-los cabe ao cliente."""
+        if ordering not in ("created_at", "-created_at"):
+            raise ValidationError({"error": f"Ordenação inválida: {ordering}"})
+
+        # Remoções são registradas como operações, mas não são pacotes
+        operations = Operation.objects(
+            device=device, operation_type__ne=OperationTypes.DELETE
+        )
+        if operation_type:
+            operations = operations.filter(operation_type=operation_type.upper())
+        if status:
+            operations = operations.filter(status=status.upper())
+        if created_from:
+            operations = operations.filter(created_at__gte=created_from)
+        if created_to:
+            operations = operations.filter(created_at__lt=created_to)
+
+        direction = "-" if ordering.startswith("-") else ""
+        return operations.order_by(ordering, f"{direction}id")
+
+    def list_changes(self, device, cursor, limit):
+        """Até limit pacotes alterados após o cursor, em ordem de alteração,
+        e os IDs dos removidos desde então. O cursor é o updated_at e o ID
+        do último pacote entregue: um pacote alterado durante a
+        sincronização passa para depois do cursor, em vez de ser pulado.
+        Retorna também o novo cursor e se há mais alterações."""
+        operations = Operation.objects(
+            device=device, operation_type__ne=OperationTypes.DELETE
+        )
+        deleted = []
+        if cursor:
+            updated_at, last_id = cursor
+            if last_id is None:
+                operations = operations.filter(updated_at__gte=updated_at)
+            else:
+                operations = operations.filter(
+                    Q(updated_at__gt=updated_at)
+                    | Q(updated_at=updated_at, id__gt=last_id)
+                )
+            deletions = Operation.objects(
+                device=device,
+                operation_type=OperationTypes.DELETE,
+                created_at__gte=updated_at,
+            )
+            deleted = [
+                log.details.get("deleted_operation_id")
+                for log in OperationLog.objects(
+                    operation__in=deletions, action="DELETE_COMPLETED"
+                )
+            ]
+
+        page = list(operations.order_by("updated_at", "id")[: limit + 1])
+        more = len(page) > limit
+        page = page[:limit]
+        if page:
+            cursor = (page[-1].updated_at, page[-1].id)
+        return page, deleted, format_cursor(cursor), more
+
+    def find_by_tag(self, device, tag):
+        """Pacote mais recente do dispositivo com a etiqueta de conteúdo"""
+        operations = Operation.objects(device=device, status=StatusChoices.COMPLETED)
+        encrypted_package = (
+            EncryptedPackage.objects(
+                operation__in=operations, metadata__dedup_tag=tag
+            )
+            .order_by("-created_at")
+            .first()
+        )
+        if not encrypted_package:
+            return {"found": False, "operation_id": ""}
+        return {"found": True, "operation_id": str(encrypted_package.operation.id)}
+
+    def recipient_keys(self, encrypted_package):
+        """Chaves do pacote para todos os destinatários, inclusive concessões"""
+        wrapped_keys = list(encrypted_package.wrapped_keys)
+        for grant in Grant.objects(operation=encrypted_package.operation):
+            wrapped_keys.append(
+                {
+                    "device_uuid": grant.device_uuid,
+                    "key_id": grant.key_id,
+                    "encrypted_key": b64encode(grant.encrypted_key).decode("utf-8"),
+                }
+            )
+        return wrapped_keys
+
+    def wrapped_key(self, device, operation_id):
+        operation = self._readable_operation(device, operation_id)
+        encrypted_package = EncryptedPackage.objects(operation=operation).first()
+        if not encrypted_package:
+            raise NotFound("Pacote não encontrado")
+
+        device_uuid = str(device.uuid)
+        for wrapped in self.recipient_keys(encrypted_package):
+            if wrapped["device_uuid"] == device_uuid:
+                return wrapped
+
+        if operation.device.id != device.id:
+            raise NotFound("Pacote não possui chave para este dispositivo")
+
+        # Pacotes sem lista de destinatários usam a chave principal
+        return {
+            "device_uuid": device_uuid,
+            "key_id": "",
+            "encrypted_key": b64encode(
+                encrypted_package.encrypted_symmetric_key
+            ).decode("utf-8"),
+        }
+
+    def create_grant(self, device, operation_id, serializer_data):
+        operation = self._owned_operation(device, operation_id)
+
+        device_uuid = serializer_data["device_uuid"]
+        if serializer_data["granted_by"] != str(device.uuid):
+            raise PermissionDenied("Concessão deve ser feita pelo dono do pacote")
+        if device_uuid == str(device.uuid):
+            raise ValidationError({"error": "Dispositivo de destino inválido"})
+        if not Device.objects(uuid=device_uuid, is_active=True).first():
+            raise ValidationError({"error": "Dispositivo de destino não encontrado"})
+
+        try:
+            encrypted_key = b64decode(serializer_data["encrypted_key"])
+        except Exception:
+            raise ValidationError({"error": "Invalid encrypted_key format"})
+
+        # Mesmo digest assinado pelo cliente, ligando a chave à operação e
+        # ao destinatário
+        digest = hashlib.sha256(
+            (
+                f"tpm-bunker-grant-v1\n{operation.id}\n{device_uuid}\n"
+                f"{serializer_data['key_id']}\n"
+            ).encode()
+            + encrypted_key
+        ).digest()
+        if not _verify_digest(device, digest, serializer_data["signature"]):
+            raise ValidationError("Assinatura digital inválida")
+
+        Grant.objects(operation=operation, device_uuid=device_uuid).delete()
+        grant = Grant(
+            operation=operation,
+            device_uuid=device_uuid,
+            key_id=serializer_data["key_id"],
+            encrypted_key=encrypted_key,
+            granted_by=serializer_data["granted_by"],
+            signature=serializer_data["signature"],
+        ).save()
+
+        OperationLog(
+            operation=operation,
+            action="GRANT_CREATED",
+            details={"device_uuid": device_uuid},
+        ).save()
+        return grant
+
+    def list_grants(self, device, operation_id):
+        operation = self._owned_operation(device, operation_id)
+        return Grant.objects(operation=operation).order_by("created_at")
+
+    def revoke_grant(self, device, operation_id, device_uuid):
+        operation = self._owned_operation(device, operation_id)
+
+        revoked = Grant.objects(operation=operation, device_uuid=device_uuid).delete()
+        # Destinatários incluídos na encriptação perdem o acesso da mesma forma
+        revoked += EncryptedPackage.objects(
+            operation=operation, wrapped_keys__device_uuid=device_uuid
+        ).update(pull__wrapped_keys={"device_uuid": device_uuid})
+        if not revoked:
+            raise NotFound("Concessão não encontrada")
+
+        OperationLog(
+            operation=operation,
+            action="GRANT_REVOKED",
+            details={"device_uuid": device_uuid},
+        ).save()
+
+    def delete_operation(self, device, operation_id, serializer_data, raw_requested_at):
+        operation = self._owned_operation(device, operation_id)
+
+        if serializer_data["operation_id"] != operation_id:
+            raise ValidationError({"error": "Pedido não corresponde à operação"})
+        if serializer_data["device_uuid"] != str(device.uuid):
+            raise PermissionDenied("Remoção deve ser pedida pelo dono do pacote")
+
+        requested_at = _as_utc(serializer_data["requested_at"])
+        if abs(datetime.now(timezone.utc) - requested_at) > DELETE_REQUEST_WINDOW:
+            raise ValidationError({"error": "Pedido de remoção expirado"})
+
+        # Mesmo digest assinado pelo cliente, com o horário como foi enviado
+        digest = hashlib.sha256(
+            (
+                f"tpm-bunker-delete-v1\n{operation_id}\n"
+                f"{serializer_data['device_uuid']}\n{raw_requested_at}\n"
+            ).encode()
+        ).digest()
+        if not _verify_digest(device, digest, serializer_data["signature"]):
+            raise ValidationError("Assinatura digital inválida")
+
+        fs = GridFS(get_db())
+        for encrypted_package in EncryptedPackage.objects(operation=operation):
+            fs.delete(encrypted_package.encrypted_data_id)
+            encrypted_package.delete()
+        Grant.objects(operation=operation).delete()
+        OperationLog.objects(operation=operation).delete()
+        operation.delete()
+
+        # A remoção fica registrada em uma operação própria, com o pedido
+        # assinado
+        deletion = Operation(
+            device=device,
+            operation_type=OperationTypes.DELETE,
+            status=StatusChoices.COMPLETED,
+        ).save()
+        OperationLog(
+            operation=deletion,
+            action="DELETE_COMPLETED",
+            details={
+                "deleted_operation_id": operation_id,
+                "requested_at": raw_requested_at,
+                "signature": serializer_data["signature"],
+            },
+        ).save()
+
+    def set_annotation(self, device, operation_id, serializer_data, raw_signed_at):
+        # Só o dono anota; dispositivos com acesso compartilhado apenas leem
+        operation = self._owned_operation(device, operation_id)
+        encrypted_package = EncryptedPackage.objects(operation=operation).first()
+        if not encrypted_package:
+            raise NotFound("Pacote não encontrado")
+
+        if serializer_data["signer_uuid"] != str(device.uuid):
+            raise PermissionDenied("Anotações devem ser assinadas por quem as envia")
+
+        # Uma anotação mais antiga que a atual seria um reenvio
+        signed_at = serializer_data["signed_at"]
+        current = encrypted_package.annotation or {}
+        if current.get("signed_at"):
+            try:
+                current_at = datetime.fromisoformat(current["signed_at"])
+            except ValueError:
+                current_at = None
+            if current_at and _as_utc(signed_at) < _as_utc(current_at):
+                raise ValidationError({"error": "Anotações mais antigas que as atuais"})
+
+        # Mesmo digest assinado pelo cliente
+        sealed_hash = hashlib.sha256(serializer_data["sealed"].encode()).hexdigest()
+        digest = hashlib.sha256(
+            (
+                f"tpm-bunker-annotation-v1\n{operation_id}\n"
+                f"{serializer_data['signer_uuid']}\n{raw_signed_at}\n{sealed_hash}\n"
+            ).encode()
+        ).digest()
+        if not _verify_digest(device, digest, serializer_data["signature"]):
+            raise ValidationError("Assinatura digital inválida")
+
+        encrypted_package.update(
+            set__annotation={
+                "sealed": serializer_data["sealed"],
+                "signer_uuid": serializer_data["signer_uuid"],
+                "signed_at": raw_signed_at,
+                "signature": serializer_data["signature"],
+            }
+        )
+        operation.update(set__updated_at=datetime.now())
+
+    def _owned_operation(self, device, operation_id):
+        if not ObjectId.is_valid(operation_id):
+            raise NotFound("Operação não encontrada")
+
+        operation = Operation.objects(
+            id=operation_id, device=device, status=StatusChoices.COMPLETED
+        ).first()
+        if not operation:
+            raise NotFound("Operação não encontrada")
+        return operation
+
+    def _readable_operation(self, device, operation_id):
+        """Operação do próprio dispositivo ou compartilhada com ele"""
+        if not ObjectId.is_valid(operation_id):
+            raise NotFound("Operação não encontrada")
+
+        operation = Operation.objects(
+            id=operation_id, status=StatusChoices.COMPLETED
+        ).first()
+        if not operation:
+            raise NotFound("Operação não encontrada")
+        if operation.device.id == device.id:
+            return operation
+
+        device_uuid = str(device.uuid)
+        if Grant.objects(operation=operation, device_uuid=device_uuid).first():
+            return operation
+        if EncryptedPackage.objects(
+            operation=operation, wrapped_keys__device_uuid=device_uuid
+        ).first():
+            return operation
+        raise NotFound("Operação não encontrada")
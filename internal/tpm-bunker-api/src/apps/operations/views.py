@@ -11,24 +11,81 @@ from drf_spectacular.utils import (
 )
 from rest_framework import status, viewsets
 from rest_framework.decorators import action
-from rest_framework.parsers import MultiPartParser
+from rest_framework.parsers import JSONParser, MultiPartParser
 from rest_framework.permissions import IsAuthenticated
 from rest_framework.response import Response
+from rest_framework.utils.urls import replace_query_param
 
 from .models import Operation
 from .serializers import (
+    AnnotationSerializer,
+    DeleteRequestSerializer,
+    GrantRequestSerializer,
+    GrantSerializer,
     OperationSerializer,
     RetrieveDataSerializer,
     StoreDataSerializer,
+    UploadCompleteSerializer,
+    UploadInitSerializer,
+    UploadStatusSerializer,
+    WrappedKeySerializer,
 )
-from .services import OperationService
+from .services import OperationService, parse_cursor, parse_filter_datetime
 
 
 @extend_schema_view(
     list=extend_schema(
         summary="Retorna uma lista de operações",
-        description="Retorna uma lista de todas as operações do dispositivo autenticado.",
+        description="""
+       Retorna, paginada, a lista de operações do dispositivo autenticado,
+       filtrada por tipo, estado e data de criação e ordenada por data de
+       criação. Com since, retorna em ordem de alteração as operações alteradas após
+       o cursor informado (vazio para todas), os IDs das removidas e o
+       cursor a usar na próxima página, indicada em next.
+       """,
         parameters=[
+            OpenApiParameter(
+                name="operation_type",
+                description="Tipo da operação",
+                required=False,
+                type=OpenApiTypes.STR,
+                location=OpenApiParameter.QUERY,
+            ),
+            OpenApiParameter(
+                name="status",
+                description="Estado da operação",
+                required=False,
+                type=OpenApiTypes.STR,
+                location=OpenApiParameter.QUERY,
+            ),
+            OpenApiParameter(
+                name="created_from",
+                description="Criadas a partir deste instante (ISO 8601)",
+                required=False,
+                type=OpenApiTypes.DATETIME,
+                location=OpenApiParameter.QUERY,
+            ),
+            OpenApiParameter(
+                name="created_to",
+                description="Criadas antes deste instante (ISO 8601)",
+                required=False,
+                type=OpenApiTypes.DATETIME,
+                location=OpenApiParameter.QUERY,
+            ),
+            OpenApiParameter(
+                name="ordering",
+                description="created_at ou -created_at (padrão)",
+                required=False,
+                type=OpenApiTypes.STR,
+                location=OpenApiParameter.QUERY,
+            ),
+            OpenApiParameter(
+                name="since",
+                description="Cursor retornado pela listagem anterior",
+                required=False,
+                type=OpenApiTypes.STR,
+                location=OpenApiParameter.QUERY,
+            ),
             OpenApiParameter(
                 name="X-Device-UUID",
                 description="UUID único do dispositivo",
@@ -43,6 +100,8 @@ from .services import OperationService
         description="""
        Armazena dados criptografados enviados pelo dispositivo.
        Valida a assinatura digital e cria um novo pacote criptografado.
+       Um envio repetido com a mesma idempotency_key retorna a operação já
+       criada.
        """,
         parameters=[
             OpenApiParameter(
@@ -77,18 +136,143 @@ from .services import OperationService
             ),
         ],
     ),
+    uploads=extend_schema(
+        summary="Inicia um envio em partes",
+        description="""
+       Abre um envio em partes com os campos do pacote e o digest de cada
+       parte. As partes seguem em requisições separadas. Repetido com a
+       mesma idempotency_key, retoma a sessão aberta ou informa em
+       operation_id a operação já criada.
+       """,
+        request=UploadInitSerializer,
+        responses=UploadStatusSerializer,
+    ),
+    upload=extend_schema(
+        summary="Consulta ou cancela um envio em partes",
+        description="Retorna as partes já recebidas ou descarta o envio.",
+        responses=UploadStatusSerializer,
+    ),
+    upload_chunk=extend_schema(
+        summary="Envia uma parte",
+        description="""
+       Recebe uma parte em octet-stream. A parte só é aceita se o tamanho e o
+       digest conferirem com os declarados ao iniciar o envio.
+       """,
+        parameters=[
+            OpenApiParameter(
+                name="X-Chunk-SHA256",
+                description="SHA-256 da parte, em hexadecimal",
+                required=False,
+                type=OpenApiTypes.STR,
+                location=OpenApiParameter.HEADER,
+            ),
+        ],
+    ),
+    complete_upload=extend_schema(
+        summary="Conclui um envio em partes",
+        description="""
+       Monta o pacote a partir das partes, confere o digest e a assinatura e
+       o armazena como em store_data. Repetida com a mesma idempotency_key,
+       retorna a operação já criada.
+       """,
+        request=UploadCompleteSerializer,
+    ),
+    manifest=extend_schema(
+        summary="Descreve as partes de um pacote",
+        description="""
+       Retorna o tamanho, o digest de cada parte e a chave do pacote, para o
+       recebimento em partes.
+       """,
+    ),
+    digest=extend_schema(
+        summary="Calcula o digest do pacote armazenado",
+        description="""
+       Retorna o SHA-256 e o tamanho do conteúdo armazenado, calculados no
+       momento do pedido, para auditoria sem download.
+       """,
+    ),
+    chunk=extend_schema(
+        summary="Recupera uma parte de um pacote",
+        description="Retorna uma parte do pacote em octet-stream.",
+    ),
+    lookup=extend_schema(
+        summary="Procura um pacote pela etiqueta de conteúdo",
+        description="""
+       Indica se o dispositivo autenticado já armazenou um pacote com a
+       etiqueta de deduplicação informada.
+       """,
+        parameters=[
+            OpenApiParameter(
+                name="tag",
+                description="Etiqueta de deduplicação",
+                required=True,
+                type=OpenApiTypes.STR,
+                location=OpenApiParameter.QUERY,
+            ),
+        ],
+    ),
+    destroy=extend_schema(
+        summary="Remove um pacote armazenado",
+        description="""
+       Remove os dados, a chave e as concessões de um pacote do dispositivo
+       autenticado. O pedido deve ser assinado pelo dispositivo.
+       """,
+        request=DeleteRequestSerializer,
+    ),
+    annotation=extend_schema(
+        summary="Substitui as anotações do pacote",
+        description="""
+       Armazena as anotações cifradas e assinadas pelo dispositivo dono do
+       pacote. Anotações mais antigas que as atuais são rejeitadas.
+       """,
+        request=AnnotationSerializer,
+    ),
+    key=extend_schema(
+        summary="Recupera a chave do pacote",
+        description="""
+       Retorna apenas a chave simétrica encriptada para o dispositivo
+       autenticado, sem os dados do pacote.
+       """,
+        responses=WrappedKeySerializer,
+    ),
+    grants=extend_schema(
+        summary="Lista ou cria concessões de acesso",
+        description="""
+       Lista os dispositivos com acesso ao pacote ou concede acesso a outro
+       dispositivo. A concessão deve ser assinada pelo dono do pacote.
+       """,
+        request=GrantRequestSerializer,
+        responses=GrantSerializer,
+    ),
+    revoke_grant=extend_schema(
+        summary="Revoga uma concessão de acesso",
+        description="Remove o acesso de um dispositivo ao pacote.",
+    ),
 )
 class OperationViewSet(viewsets.GenericViewSet):
     serializer_class = OperationSerializer
     permission_classes = [IsAuthenticated]
     service_class = OperationService()
-    parser_classes = [MultiPartParser]
+    # O envio de pacotes usa multipart; os demais pedidos, JSON
+    parser_classes = [MultiPartParser, JSONParser]
 
     def get_serializer_class(self):
         if self.action == "store_data":
             return StoreDataSerializer
+        elif self.action == "uploads":
+            return UploadInitSerializer
         elif self.action == "retrieve_data":
             return RetrieveDataSerializer
+        elif self.action == "destroy":
+            return DeleteRequestSerializer
+        elif self.action == "annotation":
+            return AnnotationSerializer
+        elif self.action == "key":
+            return WrappedKeySerializer
+        elif self.action == "grants":
+            if self.request.method == "POST":
+                return GrantRequestSerializer
+            return GrantSerializer
         return OperationSerializer
 
     def get_queryset(self):
@@ -97,9 +281,53 @@ class OperationViewSet(viewsets.GenericViewSet):
         return Operation.objects.filter(device=self.request.device)
 
     def list(self, request, *args, **kwargs):
-        queryset = self.get_queryset()
-        serializer = self.get_serializer(queryset, many=True)
-        return Response(serializer.data)
+        if "since" in request.query_params:
+            return self._list_changes(request)
+
+        params = request.query_params
+        queryset = self.service_class.list_operations(
+            device=request.device,
+            operation_type=params.get("operation_type"),
+            status=params.get("status"),
+            created_from=parse_filter_datetime(params.get("created_from")),
+            created_to=parse_filter_datetime(params.get("created_to")),
+            ordering=params.get("ordering") or "-created_at",
+        )
+        page = self.paginate_queryset(queryset)
+        serializer = self.get_serializer(page, many=True)
+        return self.get_paginated_response(serializer.data)
+
+    def _list_changes(self, request):
+        # Paginação por cursor: cada resposta traz o cursor do último pacote
+        # entregue, e next segue a partir dele enquanto houver alterações
+        try:
+            cursor = parse_cursor(request.query_params.get("since"))
+        except ValueError:
+            return Response(
+                {"error": "since inválido"}, status=status.HTTP_400_BAD_REQUEST
+            )
+
+        limit = self.paginator.get_page_size(request)
+        operations, deleted, cursor, more = self.service_class.list_changes(
+            device=request.device, cursor=cursor, limit=limit
+        )
+
+        next_url = None
+        if more:
+            next_url = replace_query_param(
+                request.build_absolute_uri(), "since", cursor
+            )
+
+        serializer = self.get_serializer(operations, many=True)
+        return Response(
+            {
+                "count": len(serializer.data),
+                "next": next_url,
+                "results": serializer.data,
+                "deleted": deleted,
+                "cursor": cursor,
+            }
+        )
 
     @action(detail=False, methods=["post"])
     def store_data(self, request):
@@ -112,6 +340,87 @@ class OperationViewSet(viewsets.GenericViewSet):
 
         return Response(response, status=status.HTTP_201_CREATED)
 
+    @action(detail=False, methods=["post"])
+    def uploads(self, request):
+        serializer = self.get_serializer(data=request.data)
+        serializer.is_valid(raise_exception=True)
+
+        upload = self.service_class.create_upload(
+            device=request.device, serializer_data=serializer.validated_data
+        )
+        return Response(
+            UploadStatusSerializer(upload).data, status=status.HTTP_201_CREATED
+        )
+
+    @action(
+        detail=False,
+        methods=["get", "delete"],
+        url_path=r"uploads/(?P<upload_id>[^/.]+)",
+    )
+    def upload(self, request, upload_id=None):
+        if request.method == "DELETE":
+            self.service_class.abort_upload(device=request.device, upload_id=upload_id)
+            return Response(status=status.HTTP_204_NO_CONTENT)
+
+        upload = self.service_class.upload_status(
+            device=request.device, upload_id=upload_id
+        )
+        return Response(UploadStatusSerializer(upload).data)
+
+    @action(
+        detail=False,
+        methods=["put"],
+        url_path=r"uploads/(?P<upload_id>[^/.]+)/chunks/(?P<index>[0-9]+)",
+    )
+    def upload_chunk(self, request, upload_id=None, index=None):
+        # O corpo é a parte em bytes, lido sem passar pelos parsers
+        self.service_class.put_chunk(
+            device=request.device,
+            upload_id=upload_id,
+            index=int(index),
+            data=request.body,
+            declared_digest=request.headers.get("X-Chunk-SHA256"),
+        )
+        return Response(status=status.HTTP_204_NO_CONTENT)
+
+    @action(
+        detail=False,
+        methods=["post"],
+        url_path=r"uploads/(?P<upload_id>[^/.]+)/complete",
+    )
+    def complete_upload(self, request, upload_id=None):
+        serializer = UploadCompleteSerializer(data=request.data)
+        serializer.is_valid(raise_exception=True)
+
+        response = self.service_class.complete_upload(
+            device=request.device,
+            upload_id=upload_id,
+            key=serializer.validated_data.get("idempotency_key"),
+        )
+        return Response(response, status=status.HTTP_201_CREATED)
+
+    @action(detail=True, methods=["get"])
+    def manifest(self, request, pk=None):
+        return Response(
+            self.service_class.manifest(device=request.device, operation_id=pk)
+        )
+
+    @action(detail=True, methods=["get"])
+    def digest(self, request, pk=None):
+        return Response(
+            self.service_class.stored_digest(device=request.device, operation_id=pk)
+        )
+
+    @action(detail=True, methods=["get"], url_path=r"chunks/(?P<index>[0-9]+)")
+    def chunk(self, request, pk=None, index=None):
+        data = self.service_class.chunk(
+            device=request.device, operation_id=pk, index=int(index)
+        )
+        response = HttpResponse(data, content_type="application/octet-stream")
+        response["Content-Length"] = str(len(data))
+        response["Cache-Control"] = "no-cache, no-store, must-revalidate"
+        return response
+
     @action(detail=False, methods=["get"])
     def retrieve_data(self, request):
         operation_id = request.query_params.get("OperationID")
@@ -135,6 +444,8 @@ class OperationViewSet(viewsets.GenericViewSet):
                 encrypted_package.encrypted_symmetric_key
             ).decode("utf-8"),
             "digital_signature": encrypted_package.digital_signature,
+            "wrapped_keys": self.service_class.recipient_keys(encrypted_package),
+            "device_uuid": str(encrypted_package.operation.device.uuid),
         }
 
         # Definir headers explicitamente
@@ -152,3 +463,72 @@ class OperationViewSet(viewsets.GenericViewSet):
         response["Expires"] = "0"
 
         return response
+
+    def destroy(self, request, pk=None):
+        serializer = self.get_serializer(data=request.data)
+        serializer.is_valid(raise_exception=True)
+
+        self.service_class.delete_operation(
+            device=request.device,
+            operation_id=pk,
+            serializer_data=serializer.validated_data,
+            raw_requested_at=request.data.get("requested_at"),
+        )
+        return Response(status=status.HTTP_204_NO_CONTENT)
+
+    @action(detail=False, methods=["get"])
+    def lookup(self, request):
+        tag = request.query_params.get("tag")
+        if not tag:
+            return Response(
+                {"error": "tag is required"}, status=status.HTTP_400_BAD_REQUEST
+            )
+
+        return Response(self.service_class.find_by_tag(device=request.device, tag=tag))
+
+    @action(detail=True, methods=["get"])
+    def key(self, request, pk=None):
+        wrapped = self.service_class.wrapped_key(device=request.device, operation_id=pk)
+        return Response(WrappedKeySerializer(wrapped).data)
+
+    @action(detail=True, methods=["get", "post"])
+    def grants(self, request, pk=None):
+        if request.method == "GET":
+            grants = self.service_class.list_grants(
+                device=request.device, operation_id=pk
+            )
+            return Response(GrantSerializer(grants, many=True).data)
+
+        serializer = self.get_serializer(data=request.data)
+        serializer.is_valid(raise_exception=True)
+
+        grant = self.service_class.create_grant(
+            device=request.device,
+            operation_id=pk,
+            serializer_data=serializer.validated_data,
+        )
+        return Response(GrantSerializer(grant).data, status=status.HTTP_201_CREATED)
+
+    @action(
+        detail=True,
+        methods=["delete"],
+        url_path=r"grants/(?P<device_uuid>[^/.]+)",
+    )
+    def revoke_grant(self, request, pk=None, device_uuid=None):
+        self.service_class.revoke_grant(
+            device=request.device, operation_id=pk, device_uuid=device_uuid
+        )
+        return Response(status=status.HTTP_204_NO_CONTENT)
+
+    @action(detail=True, methods=["put"])
+    def annotation(self, request, pk=None):
+        serializer = self.get_serializer(data=request.data)
+        serializer.is_valid(raise_exception=True)
+
+        self.service_class.set_annotation(
+            device=request.device,
+            operation_id=pk,
+            serializer_data=serializer.validated_data,
+            raw_signed_at=request.data.get("signed_at"),
+        )
+        return Response(status=status.HTTP_204_NO_CONTENT)
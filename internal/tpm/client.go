@@ -11,6 +11,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 	"tpm-bunker/internal/types"
 
@@ -21,8 +22,12 @@ import (
 
 type TPMClient struct {
 	rwc io.ReadWriteCloser
-	ek  []byte
-	aik []byte
+
+	// O TPM atende um comando por vez; mutex serializa o acesso ao
+	// dispositivo entre goroutines
+	mutex sync.Mutex
+	ek    []byte
+	aik   []byte
 
 	// Handles persistentes
 	ekHandle      tpmutil.Handle
@@ -32,6 +37,9 @@ type TPMClient struct {
 }
 
 func (c *TPMClient) SignData(ctx context.Context, hash []byte) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	caps, _, err := tpm2.GetCapability(c.rwc, tpm2.CapabilityAlgs, 100, 0)
 	if err != nil {
 		log.Printf("[SignData] Erro ao listar algoritmos suportados: %v", err)
@@ -77,6 +85,25 @@ func (c *TPMClient) SignData(ctx context.Context, hash []byte) ([]byte, error) {
 	return signature.RSA.Signature, nil
 }
 
+// ParsePublicKeyPEM decodifica uma chave pública RSA no formato PEM
+func ParsePublicKeyPEM(pubPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pubPEM))
+	if block == nil {
+		return nil, fmt.Errorf("chave pública PEM inválida")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao decodificar chave pública: %w", err)
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("chave pública não é RSA")
+	}
+	return rsaPub, nil
+}
+
 func GetPublicKeyPEM(pubKey *rsa.PublicKey) string {
 	pubASN1, err := x509.MarshalPKIXPublicKey(pubKey)
 	if err != nil {
@@ -307,7 +334,17 @@ func (c *TPMClient) InitializeDevice(ctx context.Context) (*types.DeviceInfo, er
 			// Convertendo chave pública para formato PEM
 			pubKeyPEM := GetPublicKeyPEM(pubKey)
 			log.Println("[InitializeDevice] Chave pública convertida para formato PEM")
-			log.Println("PUBKEYPEM %s", pubKeyPEM)
+			log.Printf("PUBKEYPEM %s", pubKeyPEM)
+
+			// Recuperando chave pública RSA de encriptação, usada por outros
+			// dispositivos para encriptar chaves de arquivos para este
+			log.Println("[InitializeDevice] Recuperando chave pública RSA de encriptação...")
+			encryptKey, err := c.RetrieveRSADecryptKey(ctx)
+			if err != nil {
+				lastErr = fmt.Errorf("falha ao recuperar chave de encriptação: %v", err)
+				log.Println("[InitializeDevice] Erro ao recuperar chave de encriptação:", err)
+				continue
+			}
 
 			// Gerando UUID baseado na EK
 			log.Println("[InitializeDevice] Gerando UUID baseado na EK...")
@@ -321,10 +358,11 @@ func (c *TPMClient) InitializeDevice(ctx context.Context) (*types.DeviceInfo, er
 			// Retornando informações do dispositivo
 			log.Println("[InitializeDevice] Inicialização do dispositivo concluída com sucesso!")
 			return &types.DeviceInfo{
-				UUID:      deviceUUID,
-				EK:        ek,
-				AIK:       aik,
-				PublicKey: pubKeyPEM,
+				UUID:          deviceUUID,
+				EK:            ek,
+				AIK:           aik,
+				PublicKey:     pubKeyPEM,
+				EncryptionKey: GetPublicKeyPEM(encryptKey),
 			}, nil
 		}
 	}
@@ -528,6 +566,9 @@ func (c *TPMClient) RetrieveRSASignKey(ctx context.Context) (*rsa.PublicKey, err
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
 		// Read public key from signing handle
 		pub, _, _, err := tpm2.ReadPublic(c.rwc, c.signHandle)
 		if err != nil {
@@ -557,24 +598,27 @@ func (c *TPMClient) RetrieveRSASignKey(ctx context.Context) (*rsa.PublicKey, err
 }
 
 func (c *TPMClient) RetrieveRSADecryptKey(ctx context.Context) (*rsa.PublicKey, error) {
-    select {
-    case <-ctx.Done():
-        return nil, ctx.Err()
-    default:
-        // Read public key from decrypt handle
-        pub, _, _, err := tpm2.ReadPublic(c.rwc, c.decryptHandle)
-        if err != nil {
-            return nil, fmt.Errorf("failed to read RSA key from TPM: %v", err)
-        }
-
-        // Convert to rsa.PublicKey
-        pubKey := rsa.PublicKey{
-            N: pub.RSAParameters.Modulus(),
-            E: 65537,
-        }
-
-        return &pubKey, nil
-    }
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		// Read public key from decrypt handle
+		pub, _, _, err := tpm2.ReadPublic(c.rwc, c.decryptHandle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RSA key from TPM: %v", err)
+		}
+
+		// Convert to rsa.PublicKey
+		pubKey := rsa.PublicKey{
+			N: pub.RSAParameters.Modulus(),
+			E: 65537,
+		}
+
+		return &pubKey, nil
+	}
 }
 
 // RSADecrypt decrypts data using the TPM's RSA key
@@ -583,6 +627,9 @@ func (c *TPMClient) RSADecrypt(ctx context.Context, ciphertext []byte) ([]byte,
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
 		// Using decryptHandle directly, removed reference to rsaHandle
 		pub, _, _, err := tpm2.ReadPublic(c.rwc, c.decryptHandle)
 		if err != nil {
@@ -15,10 +15,11 @@ type Manager struct {
 	cancel context.CancelFunc // Adicionado para controle de cancelamento
 
 	// Estado do dispositivo
-	DeviceUUID string
-	PublicKey  string
-	EK         []byte
-	AIK        []byte
+	DeviceUUID    string
+	PublicKey     string
+	EncryptionKey string
+	EK            []byte
+	AIK           []byte
 }
 
 func NewManager(ctx context.Context) *Manager {
@@ -80,6 +81,7 @@ func (m *Manager) InitializeDevice(ctx context.Context) error {
 	default:
 		m.DeviceUUID = creds.UUID
 		m.PublicKey = creds.PublicKey
+		m.EncryptionKey = creds.EncryptionKey
 		m.EK = creds.EK
 		m.AIK = creds.AIK
 		return nil
@@ -125,6 +127,17 @@ func (m *Manager) GetPublicKey(ctx context.Context) (string, error) {
 	}
 }
 
+func (m *Manager) GetEncryptionKey(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+		m.mutex.RLock()
+		defer m.mutex.RUnlock()
+		return m.EncryptionKey, nil
+	}
+}
+
 // Método para limpar recursos quando não mais necessários
 func (m *Manager) Close() {
 	if m.cancel != nil {
@@ -2,10 +2,11 @@ package types
 
 // DeviceInfo contém informações sobre o dispositivo
 type DeviceInfo struct {
-	UUID      string
-	PublicKey string
-	EK        []byte
-	AIK       []byte
+	UUID          string
+	PublicKey     string
+	EncryptionKey string
+	EK            []byte
+	AIK           []byte
 }
 
 // APIResponse representa uma resposta da API
@@ -29,6 +30,424 @@ type TPMStatus struct {
 type DecryptResponse struct {
 	EncryptedData         []byte
 	EncryptedSymmetricKey []byte
+	WrappedKeys           []WrappedKey
 	DigitalSignature      string
+	SignerUUID            string
 	FileName              string
 }
+
+// WrappedKey é a chave simétrica de um pacote encriptada para um dispositivo
+type WrappedKey struct {
+	DeviceUUID   string `json:"device_uuid"`
+	KeyID        string `json:"key_id"`
+	EncryptedKey []byte `json:"encrypted_key"`
+}
+
+// EncryptionSummary resume o resultado de uma encriptação enviada à API
+type EncryptionSummary struct {
+	OperationID      string   `json:"operation_id"`
+	FileName         string   `json:"file_name"`
+	Compression      string   `json:"compression"`
+	OriginalSize     int64    `json:"original_size"`
+	StoredSize       int64    `json:"stored_size"`
+	CompressionRatio float64  `json:"compression_ratio"`
+	Recipients       []string `json:"recipients"`
+
+	// Tamanho enviado ao servidor e quanto dele é padding
+	CiphertextSize  int64  `json:"ciphertext_size"`
+	Padding         string `json:"padding"`
+	PaddingOverhead int64  `json:"padding_overhead"`
+
+	// Deduplicated indica que o conteúdo já estava armazenado e o envio foi
+	// ignorado
+	Deduplicated bool `json:"deduplicated"`
+
+	// Arquivo lógico e versão criada pelo envio
+	FileID  string `json:"file_id,omitempty"`
+	Version int    `json:"version,omitempty"`
+
+	// Queued indica que o pacote foi gravado na fila de saída e será
+	// enviado quando houver conexão; OperationID fica vazio até lá
+	Queued bool `json:"queued"`
+	// TransferID é o envio da fila de saída que criou o pacote
+	TransferID string `json:"transfer_id,omitempty"`
+}
+
+// Grant representa o acesso de um dispositivo a um pacote armazenado
+type Grant struct {
+	OperationID string `json:"operation_id"`
+	DeviceUUID  string `json:"device_uuid"`
+	KeyID       string `json:"key_id"`
+	GrantedBy   string `json:"granted_by"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// TrustedDevice é um dispositivo cuja chave de assinatura foi confirmada
+// pelo usuário. Fingerprint é o SHA-256 da chave em PKIX e SignKey a chave
+// em PEM, fixada no momento da confirmação. A chave de encriptação, exigida
+// para incluir o dispositivo como destinatário, é fixada da mesma forma.
+type TrustedDevice struct {
+	UUID               string `json:"uuid"`
+	Name               string `json:"name"`
+	Fingerprint        string `json:"fingerprint"`
+	SignKey            string `json:"sign_key"`
+	EncryptFingerprint string `json:"encrypt_fingerprint,omitempty"`
+	EncryptKey         string `json:"encrypt_key,omitempty"`
+	AddedAt            string `json:"added_at"`
+}
+
+// SignatureVerification é o resultado da verificação de uma assinatura
+// destacada
+type SignatureVerification struct {
+	Valid      bool   `json:"valid"`
+	SignerUUID string `json:"signer_uuid"`
+	SignedAt   string `json:"signed_at"`
+	FileDigest string `json:"file_digest"`
+	KeySource  string `json:"key_source"`
+	// Trusted indica que a chave é a local ou uma chave fixada; com a chave
+	// do servidor, SignerFingerprint deve ser conferida com o assinante
+	Trusted           bool   `json:"trusted"`
+	SignerFingerprint string `json:"signer_fingerprint,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// OpenedFile descreve o conteúdo decriptado de um pacote mantido apenas em
+// memória para visualização no frontend. O conteúdo é lido em partes em
+// URL, pelo servidor de assets da interface, até ser fechado pelo ID.
+type OpenedFile struct {
+	ID       string `json:"id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url"`
+}
+
+// ScratchCopy é uma cópia decriptada temporária, apagada ao expirar
+type ScratchCopy struct {
+	Path             string `json:"path"`
+	OperationID      string `json:"operation_id"`
+	FileName         string `json:"file_name"`
+	CreatedAt        string `json:"created_at"`
+	ExpiresAt        string `json:"expires_at"`
+	RemainingSeconds int64  `json:"remaining_seconds"`
+
+	// Metadados não restaurados na criação da cópia
+	SkippedAttributes []string `json:"skipped_attributes,omitempty"`
+}
+
+// DecryptResult é o resultado de decriptar um pacote em disco.
+// SkippedAttributes lista os metadados do original que não puderam ser
+// restaurados sob a política best_effort.
+type DecryptResult struct {
+	Path              string   `json:"path"`
+	SkippedAttributes []string `json:"skipped_attributes,omitempty"`
+}
+
+// VaultResult é o resultado de encriptar um arquivo e remover o original
+type VaultResult struct {
+	Summary      *EncryptionSummary `json:"summary"`
+	Verified     bool               `json:"verified"`
+	SourceDigest string             `json:"source_digest"`
+	Removed      bool               `json:"removed"`
+	Overwritten  bool               `json:"overwritten"`
+	Filesystem   string             `json:"filesystem"`
+	Warning      string             `json:"warning,omitempty"`
+}
+
+// FileVersion é uma versão armazenada de um arquivo lógico
+type FileVersion struct {
+	FileID              string `json:"file_id"`
+	Version             int    `json:"version"`
+	OperationID         string `json:"operation_id"`
+	PreviousOperationID string `json:"previous_operation_id,omitempty"`
+	FileName            string `json:"file_name"`
+	Size                int64  `json:"size"`
+	CreatedAt           string `json:"created_at"`
+}
+
+// LogicalFile é um arquivo local acompanhado por versões
+type LogicalFile struct {
+	FileID   string        `json:"file_id"`
+	Path     string        `json:"path"`
+	Versions []FileVersion `json:"versions"`
+	// Maior versão já atribuída, inclusive a pacotes ainda não enviados
+	Reserved int `json:"reserved,omitempty"`
+}
+
+// DeleteResult é o resultado da remoção de um pacote
+type DeleteResult struct {
+	OperationID string `json:"operation_id"`
+	Deleted     bool   `json:"deleted"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Operation é uma operação armazenada na API, com os dados descritivos do
+// pacote já decriptados localmente
+type Operation struct {
+	ID            string `json:"id"`
+	OperationType string `json:"operation_type"`
+	Status        string `json:"status"`
+	ErrorMessage  string `json:"error_message,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at,omitempty"`
+
+	// Pacote da operação; vazio em operações sem pacote
+	FileName     string `json:"file_name"`
+	FileSize     int64  `json:"file_size"`
+	Kind         string `json:"kind,omitempty"`
+	OriginalSize int64  `json:"original_size,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileID       string `json:"file_id,omitempty"`
+	Version      int    `json:"version,omitempty"`
+
+	// Anotações do usuário
+	Tags           []string `json:"tags,omitempty"`
+	Notes          string   `json:"notes,omitempty"`
+	Classification string   `json:"classification,omitempty"`
+}
+
+// OperationFilter seleciona, ordena e pagina a listagem de operações. From
+// e To aceitam datas (2006-01-02) ou RFC 3339; Sort aceita created_at,
+// file_name e file_size, com prefixo "-" para ordem decrescente.
+type OperationFilter struct {
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	From           string `json:"from"`
+	To             string `json:"to"`
+	Name           string `json:"name"`
+	Tag            string `json:"tag"`
+	Classification string `json:"classification"`
+	Sort           string `json:"sort"`
+	Page           int    `json:"page"`
+	PageSize       int    `json:"page_size"`
+}
+
+// OperationPage é uma página da listagem de operações
+type OperationPage struct {
+	Operations []Operation `json:"operations"`
+	Total      int         `json:"total"`
+	Page       int         `json:"page"`
+	PageSize   int         `json:"page_size"`
+}
+
+// Annotation são as etiquetas, notas e classificação de um pacote
+type Annotation struct {
+	Tags           []string `json:"tags"`
+	Notes          string   `json:"notes"`
+	Classification string   `json:"classification"`
+
+	// Dispositivo que fez a última edição e quando
+	UpdatedBy string `json:"updated_by,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// Transfer é uma transferência em partes pendente
+type Transfer struct {
+	ID          string `json:"id"`
+	Direction   string `json:"direction"`
+	FileName    string `json:"file_name,omitempty"`
+	OperationID string `json:"operation_id,omitempty"`
+	Size        int64  `json:"size"`
+	ChunksDone  int    `json:"chunks_done"`
+	ChunkCount  int    `json:"chunk_count"`
+	Complete    bool   `json:"complete"`
+	Active      bool   `json:"active"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// OutboxState é o estado da fila de saída de pacotes aguardando envio
+type OutboxState struct {
+	Pending     int    `json:"pending"`
+	Syncing     bool   `json:"syncing"`
+	Online      bool   `json:"online"`
+	LastError   string `json:"last_error,omitempty"`
+	NextAttempt string `json:"next_attempt,omitempty"`
+}
+
+// BatchProgress é o andamento de um arquivo de uma encriptação em lote.
+// Status é encrypting, uploading, done, queued, failed ou cancelled.
+type BatchProgress struct {
+	BatchID   string `json:"batch_id"`
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	Completed int    `json:"completed"`
+	Total     int    `json:"total"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BatchFileResult é o resultado de um arquivo de uma encriptação em lote
+type BatchFileResult struct {
+	Path      string             `json:"path"`
+	Summary   *EncryptionSummary `json:"summary,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Cancelled bool               `json:"cancelled"`
+}
+
+// BatchResult é o resultado de uma encriptação em lote
+type BatchResult struct {
+	BatchID   string            `json:"batch_id"`
+	Results   []BatchFileResult `json:"results"`
+	Cancelled bool              `json:"cancelled"`
+}
+
+// OperationProgress é o andamento de uma encriptação ou decriptação. Phase
+// é read, encrypt, sign ou upload ao encriptar e download, verify, decrypt
+// ou write ao decriptar; BytesTotal é 0 quando o total não é conhecido.
+type OperationProgress struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Target     string `json:"target"`
+	Phase      string `json:"phase"`
+	BytesDone  int64  `json:"bytes_done"`
+	BytesTotal int64  `json:"bytes_total"`
+	ETASeconds int64  `json:"eta_seconds"`
+	Done       bool   `json:"done"`
+	Error      string `json:"error,omitempty"`
+	Cancelled  bool   `json:"cancelled"`
+}
+
+// WatchedFolder é uma pasta vigiada: arquivos novos ou alterados que casam
+// com Include, e não com Exclude, são encriptados automaticamente depois de
+// StableSeconds sem mudanças. Padrões com "/" casam com o caminho relativo à
+// pasta; os demais, só com o nome do arquivo.
+type WatchedFolder struct {
+	ID              string   `json:"id"`
+	Path            string   `json:"path"`
+	Include         []string `json:"include"`
+	Exclude         []string `json:"exclude"`
+	Recursive       bool     `json:"recursive"`
+	StableSeconds   int      `json:"stable_seconds"`
+	RemoveOriginals bool     `json:"remove_originals"`
+	Enabled         bool     `json:"enabled"`
+}
+
+// WatchActivity é uma entrada do registro de atividade de uma pasta vigiada.
+// Action é vaulted, queued, removed ou failed.
+type WatchActivity struct {
+	FolderID    string `json:"folder_id"`
+	Path        string `json:"path"`
+	Action      string `json:"action"`
+	OperationID string `json:"operation_id,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Time        string `json:"time"`
+}
+
+// BackupJob é um backup agendado de uma pasta. Roda em Time (HH:MM, hora
+// local) nos dias de Weekdays (0 é domingo; vazio é todos os dias) e envia
+// apenas os arquivos alterados desde a execução anterior. KeepVersions e
+// KeepDays são a retenção das versões dos arquivos do job; zero desativa
+// cada limite.
+type BackupJob struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Path         string   `json:"path"`
+	Include      []string `json:"include"`
+	Exclude      []string `json:"exclude"`
+	Time         string   `json:"time"`
+	Weekdays     []int    `json:"weekdays"`
+	KeepVersions int      `json:"keep_versions"`
+	KeepDays     int      `json:"keep_days"`
+	Enabled      bool     `json:"enabled"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+// BackupFileError é um arquivo que falhou em uma execução de backup
+type BackupFileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// BackupReport é o relatório de uma execução de um backup agendado.
+// Trigger é scheduled, catch_up (execução perdida, feita depois) ou manual.
+type BackupReport struct {
+	RunID      string            `json:"run_id"`
+	JobID      string            `json:"job_id"`
+	Trigger    string            `json:"trigger"`
+	StartedAt  string            `json:"started_at"`
+	FinishedAt string            `json:"finished_at,omitempty"`
+	Running    bool              `json:"running"`
+	Scanned    int               `json:"scanned"`
+	Unchanged  int               `json:"unchanged"`
+	Uploaded   int               `json:"uploaded"`
+	Queued     int               `json:"queued"`
+	Failed     int               `json:"failed"`
+	Pruned     int               `json:"pruned"`
+	Bytes      int64             `json:"bytes"`
+	Errors     []BackupFileError `json:"errors,omitempty"`
+	Cancelled  bool              `json:"cancelled"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// BackupJobStatus é um backup agendado com o estado de suas execuções
+type BackupJobStatus struct {
+	Job        BackupJob     `json:"job"`
+	LastRun    string        `json:"last_run,omitempty"`
+	NextRun    string        `json:"next_run,omitempty"`
+	Running    bool          `json:"running"`
+	LastReport *BackupReport `json:"last_report,omitempty"`
+}
+
+// AuditResult é a verificação de um pacote armazenado. Status é ok,
+// corrupted (assinatura ou digest não conferem), missing (o pacote não está
+// no servidor) ou error (não foi possível verificar). Method é digest
+// (digest calculado pelo servidor) ou download.
+type AuditResult struct {
+	OperationID string `json:"operation_id"`
+	FileName    string `json:"file_name"`
+	Status      string `json:"status"`
+	Method      string `json:"method,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	// LocalPath é a cópia local da qual o pacote pode ser reenviado
+	LocalPath string `json:"local_path,omitempty"`
+	Repaired  bool   `json:"repaired,omitempty"`
+}
+
+// AuditReport é o relatório de uma auditoria de integridade. Mode é quick
+// (digest do servidor quando disponível) ou full (download de cada pacote).
+// Results traz apenas os pacotes com problema.
+type AuditReport struct {
+	AuditID    string        `json:"audit_id"`
+	Mode       string        `json:"mode"`
+	StartedAt  string        `json:"started_at"`
+	FinishedAt string        `json:"finished_at,omitempty"`
+	Running    bool          `json:"running"`
+	Cancelled  bool          `json:"cancelled"`
+	Total      int           `json:"total"`
+	Checked    int           `json:"checked"`
+	Passed     int           `json:"passed"`
+	Corrupted  int           `json:"corrupted"`
+	Missing    int           `json:"missing"`
+	Errors     int           `json:"errors"`
+	Error      string        `json:"error,omitempty"`
+	Results    []AuditResult `json:"results"`
+}
+
+// SecurityEvent é uma entrada do registro de segurança local. Cada entrada
+// leva o hash da anterior; as entradas checkpoint levam ainda a assinatura
+// do TPM sobre o próprio hash, que cobre toda a cadeia até ali.
+type SecurityEvent struct {
+	Seq         uint64 `json:"seq"`
+	Time        string `json:"time"`
+	Type        string `json:"type"`
+	Outcome     string `json:"outcome"`
+	DeviceUUID  string `json:"device_uuid,omitempty"`
+	OperationID string `json:"operation_id,omitempty"`
+	Target      string `json:"target,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+	PrevHash    string `json:"prev_hash"`
+	Hash        string `json:"hash"`
+	Signature   string `json:"signature,omitempty"`
+}
+
+// SecurityLogVerification é o resultado da verificação do registro de
+// segurança. Unanchored são as entradas posteriores ao último checkpoint,
+// protegidas apenas pela cadeia de hashes.
+type SecurityLogVerification struct {
+	Valid             bool     `json:"valid"`
+	Entries           int      `json:"entries"`
+	Checkpoints       int      `json:"checkpoints"`
+	LastCheckpointSeq uint64   `json:"last_checkpoint_seq"`
+	Unanchored        int      `json:"unanchored"`
+	Problems          []string `json:"problems"`
+}